@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	internalagent "github.com/easeaico/project-her/internal/agent"
+	"github.com/easeaico/project-her/internal/card"
+)
+
+const cardUsage = `usage:
+  platform card import <card.json|card.png>...
+  platform card export [-spec v2|v3] <character-id> <out.json|out.png>`
+
+// runCardCommand handles the "card" subcommand: importing and exporting
+// Character Card V2/V3 files.
+func runCardCommand(ctx context.Context, repo card.Repo, args []string) error {
+	if len(args) == 0 {
+		return errors.New(cardUsage)
+	}
+	switch args[0] {
+	case "import":
+		return importCards(ctx, repo, args[1:])
+	case "export":
+		return exportCard(ctx, repo, args[1:])
+	default:
+		return fmt.Errorf("unknown card command %q\n%s", args[0], cardUsage)
+	}
+}
+
+func importCards(ctx context.Context, repo card.Repo, paths []string) error {
+	if len(paths) == 0 {
+		return errors.New(cardUsage)
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read card: %w", err)
+		}
+		character, err := card.Import(ctx, repo, data, path)
+		if err != nil {
+			return fmt.Errorf("failed to import %s: %w", path, err)
+		}
+		fmt.Printf("imported %s as %s\n", character.Name, internalagent.AppName(character.ID))
+	}
+	return nil
+}
+
+func exportCard(ctx context.Context, repo card.Repo, args []string) error {
+	flags := flag.NewFlagSet("card export", flag.ContinueOnError)
+	spec := flags.String("spec", "v3", "card spec for JSON export: v2 or v3")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return errors.New(cardUsage)
+	}
+	id, err := strconv.Atoi(flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("invalid character id %q", flags.Arg(0))
+	}
+	out := flags.Arg(1)
+
+	format := card.FormatJSON
+	if strings.EqualFold(filepath.Ext(out), ".png") {
+		format = card.FormatPNG
+	}
+	specName := card.SpecV3
+	switch strings.ToLower(*spec) {
+	case "v3":
+	case "v2":
+		specName = card.SpecV2
+	default:
+		return fmt.Errorf("unsupported card spec %q", *spec)
+	}
+
+	data, err := card.Export(ctx, repo, id, format, specName)
+	if err != nil {
+		return fmt.Errorf("failed to export character %d: %w", id, err)
+	}
+	if err := os.WriteFile(out, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write card: %w", err)
+	}
+	fmt.Printf("exported character %d to %s\n", id, out)
+	return nil
+}
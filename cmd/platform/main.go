@@ -13,8 +13,8 @@ import (
 	internalagent "github.com/easeaico/project-her/internal/agent"
 	"github.com/easeaico/project-her/internal/config"
 	"github.com/easeaico/project-her/internal/memory"
+	"github.com/easeaico/project-her/internal/models"
 	"github.com/easeaico/project-her/internal/storage"
-	"google.golang.org/adk/agent"
 	"google.golang.org/adk/cmd/launcher"
 	"google.golang.org/adk/cmd/launcher/full"
 	"google.golang.org/adk/session/database"
@@ -40,22 +40,49 @@ func main() {
 	}
 	defer store.Close()
 
-	memoryService := memory.NewService(ctx, &cfg, store.Memories, store.ChatHistories)
+	if len(os.Args) > 1 && os.Args[1] == "card" {
+		if err := runCardCommand(ctx, store.Cards, os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			store.Close()
+			os.Exit(1)
+		}
+		return
+	}
+
+	registry := models.NewRegistry(&cfg)
+	memoryService := memory.NewService(ctx, &cfg, store.Memories, store.ChatHistories, store.SummaryJobs)
+	summaryWorker := memory.NewSummaryWorker(ctx, &cfg, registry, store.Memories, store.ChatHistories, store.SummaryJobs)
+	go summaryWorker.Run(ctx)
 
 	sessionService, err := database.NewSessionService(postgres.Open(cfg.DatabaseURL))
 	if err != nil {
 		log.Fatalf("failed to create session service: %v", err)
 	}
+	sessionService = memory.WithSessionEnd(sessionService, &cfg, store.ChatHistories, store.SummaryJobs)
+
+	story, err := memory.NewStorySummarizer(ctx, &cfg, registry)
+	if err != nil {
+		log.Fatalf("failed to create story summarizer: %v", err)
+	}
 
-	llmAgent, err := internalagent.NewRolePlayAgent(ctx, &cfg, store.Characters, sessionService, memoryService)
+	loader, err := internalagent.NewCharacterLoader(ctx, &cfg, internalagent.RolePlayDeps{
+		Registry:   registry,
+		Characters: store.Characters,
+		Sessions:   sessionService,
+		Memory:     memoryService,
+		Lore:       store.Lorebook,
+		Profiles:   store.Profiles,
+		Story:      story,
+	})
 	if err != nil {
 		log.Fatalf("Failed to initialize agent: %v", err)
 	}
+	go loader.Watch(ctx, cfg.CharacterReloadInterval)
 
 	launcherConfig := &launcher.Config{
 		SessionService: sessionService,
 		MemoryService:  memoryService,
-		AgentLoader:    agent.NewSingleLoader(llmAgent),
+		AgentLoader:    loader,
 	}
 
 	l := full.NewLauncher()
@@ -6,6 +6,7 @@ require (
 	github.com/google/jsonschema-go v0.3.0
 	github.com/openai/openai-go/v3 v3.16.0
 	github.com/pgvector/pgvector-go v0.3.0
+	golang.org/x/sync v0.19.0
 	google.golang.org/adk v0.4.0
 	google.golang.org/genai v1.40.0
 	gorm.io/driver/postgres v1.5.4
@@ -48,7 +49,6 @@ require (
 	go.opentelemetry.io/otel/trace v1.38.0 // indirect
 	golang.org/x/crypto v0.46.0 // indirect
 	golang.org/x/net v0.48.0 // indirect
-	golang.org/x/sync v0.19.0 // indirect
 	golang.org/x/sys v0.39.0 // indirect
 	golang.org/x/text v0.32.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20251213004720-97cd9d5aeac2 // indirect
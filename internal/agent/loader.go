@@ -0,0 +1,264 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/adk/agent"
+
+	"github.com/easeaico/project-her/internal/config"
+)
+
+const appNamePrefix = "project_her_roleplay_"
+
+// missingCharacterTTL 为不存在的角色 ID 的负缓存时长，避免无效名称反复查询数据库。
+const missingCharacterTTL = 30 * time.Second
+
+// CharacterLoader 为 characters 表中的每个角色提供一个角色扮演代理。
+// 代理在首次加载时才构建并缓存，新增角色无需重启即可使用；
+// CHARACTER_ID 指定的角色作为根代理，在启动时构建。
+// 构建在锁外进行，同一角色的并发加载只构建一次，不影响其他角色与已缓存代理的读取。
+//
+// Watch 轮询 characters.updated_at，角色定义变化后重建代理并替换缓存。
+// 进行中的对话继续使用旧代理完成当前轮次，下一轮通过 LoadAgent 取得新代理；
+// 会话与记忆按 app_name 存储，名称不变，因此对话不会中断。
+// console 启动器只在启动时读取一次 RootAgent，热加载仅对 web/api 启动器生效。
+type CharacterLoader struct {
+	ctx  context.Context
+	cfg  *config.Config
+	deps RolePlayDeps
+
+	mu     sync.Mutex
+	agents map[int]*loadedAgent
+	root   agent.Agent
+	// missing 记录不存在的角色 ID 及其负缓存的过期时间。
+	missing  map[int]time.Time
+	inflight singleflight.Group
+}
+
+// loadedAgent 为缓存的代理及其构建时角色定义的修改时间。
+type loadedAgent struct {
+	agent     agent.Agent
+	updatedAt time.Time
+}
+
+var _ agent.Loader = (*CharacterLoader)(nil)
+
+// NewCharacterLoader 创建多角色代理加载器，依赖与 NewRolePlayAgent 相同。
+func NewCharacterLoader(ctx context.Context, cfg *config.Config, deps RolePlayDeps) (*CharacterLoader, error) {
+	l := &CharacterLoader{
+		ctx:     ctx,
+		cfg:     cfg,
+		deps:    deps,
+		agents:  make(map[int]*loadedAgent),
+		missing: make(map[int]time.Time),
+	}
+
+	root, err := l.load(cfg.CharacterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load root agent: %w", err)
+	}
+	l.mu.Lock()
+	l.root = root
+	l.mu.Unlock()
+	return l, nil
+}
+
+// ListAgents 返回当前全部角色对应的代理名称。查询失败时退回到已缓存的代理。
+func (l *CharacterLoader) ListAgents() []string {
+	var ids []int
+	versions, err := l.deps.Characters.ListUpdatedAt(l.ctx)
+	if err != nil {
+		slog.Warn("failed to list characters, using cached agents", "error", err)
+		l.mu.Lock()
+		for id := range l.agents {
+			ids = append(ids, id)
+		}
+		l.mu.Unlock()
+	}
+	for id := range versions {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	names := make([]string, 0, len(ids))
+	for _, id := range ids {
+		names = append(names, AppName(id))
+	}
+	return names
+}
+
+// LoadAgent 按名称返回代理，名称为空时返回根代理。
+func (l *CharacterLoader) LoadAgent(name string) (agent.Agent, error) {
+	if name == "" {
+		return l.RootAgent(), nil
+	}
+	id, ok := parseAppName(name)
+	if !ok {
+		return nil, fmt.Errorf("agent %q not found", name)
+	}
+	return l.load(id)
+}
+
+// RootAgent 返回 CHARACTER_ID 对应的代理。
+func (l *CharacterLoader) RootAgent() agent.Agent {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.root
+}
+
+// Watch 每隔 interval 调用一次 Refresh，直到 ctx 结束。interval 不大于 0 时立即返回。
+func (l *CharacterLoader) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := l.Refresh(ctx); err != nil {
+				slog.Warn("failed to refresh characters", "error", err)
+			}
+		}
+	}
+}
+
+// Refresh 重建定义已变化的缓存代理，并移除已删除角色的代理（根代理除外）。
+// 重建失败时保留旧代理，待下次刷新重试。
+func (l *CharacterLoader) Refresh(ctx context.Context) error {
+	versions, err := l.deps.Characters.ListUpdatedAt(ctx)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	// 新增的角色不再受负缓存影响，过期条目一并清理。
+	now := time.Now()
+	for id, until := range l.missing {
+		if _, ok := versions[id]; ok || !now.Before(until) {
+			delete(l.missing, id)
+		}
+	}
+	stale := make(map[int]time.Time)
+	for id, loaded := range l.agents {
+		updatedAt, ok := versions[id]
+		if !ok {
+			if id != l.cfg.CharacterID {
+				delete(l.agents, id)
+				slog.Info("roleplay agent removed", "agent", loaded.agent.Name())
+			}
+			continue
+		}
+		if updatedAt.After(loaded.updatedAt) {
+			stale[id] = loaded.updatedAt
+		}
+	}
+	l.mu.Unlock()
+
+	for id, previous := range stale {
+		loaded, err := l.build(ctx, id)
+		if err != nil {
+			slog.Warn("failed to reload roleplay agent, keeping previous version", "agent", AppName(id), "error", err)
+			continue
+		}
+
+		l.mu.Lock()
+		// 刷新期间若已有更新的版本被加载，则不覆盖。
+		if current, ok := l.agents[id]; ok && !current.updatedAt.After(loaded.updatedAt) {
+			l.agents[id] = loaded
+			if id == l.cfg.CharacterID {
+				l.root = loaded.agent
+			}
+			slog.Info("roleplay agent reloaded", "agent", loaded.agent.Name(), "previous", previous, "updated_at", loaded.updatedAt)
+		}
+		l.mu.Unlock()
+	}
+	return nil
+}
+
+// load 返回缓存的代理，不存在时为该角色构建一个。
+func (l *CharacterLoader) load(id int) (agent.Agent, error) {
+	if a, ok, err := l.cached(id); ok {
+		return a, err
+	}
+	v, err, _ := l.inflight.Do(strconv.Itoa(id), func() (any, error) {
+		// 等待期间可能已由其他请求构建完成。
+		if a, ok, err := l.cached(id); ok {
+			return a, err
+		}
+		loaded, err := l.build(l.ctx, id)
+		if err != nil {
+			if errors.Is(err, ErrCharacterNotFound) {
+				l.mu.Lock()
+				l.missing[id] = time.Now().Add(missingCharacterTTL)
+				l.mu.Unlock()
+			}
+			return nil, err
+		}
+
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		// 构建期间 Refresh 可能已放入同一角色的代理，以缓存为准。
+		if current, ok := l.agents[id]; ok {
+			return current.agent, nil
+		}
+		l.agents[id] = loaded
+		delete(l.missing, id)
+		slog.Info("roleplay agent loaded", "agent", loaded.agent.Name())
+		return loaded.agent, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(agent.Agent), nil
+}
+
+// cached 返回已缓存的代理或负缓存中的不存在错误，两者都没有时 ok 为 false。
+func (l *CharacterLoader) cached(id int) (agent.Agent, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if loaded, ok := l.agents[id]; ok {
+		return loaded.agent, true, nil
+	}
+	if until, ok := l.missing[id]; ok && time.Now().Before(until) {
+		return nil, true, fmt.Errorf("agent %q: %w", AppName(id), ErrCharacterNotFound)
+	}
+	return nil, false, nil
+}
+
+// build 读取最新的角色定义并构建代理。
+func (l *CharacterLoader) build(ctx context.Context, id int) (*loadedAgent, error) {
+	character, err := l.deps.Characters.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get character: %w", err)
+	}
+	a, err := newRolePlayAgent(l.ctx, l.cfg, character, l.deps)
+	if err != nil {
+		return nil, err
+	}
+	return &loadedAgent{agent: a, updatedAt: character.UpdatedAt}, nil
+}
+
+// parseAppName 从代理名称中解析角色 ID。
+func parseAppName(name string) (int, bool) {
+	raw, ok := strings.CutPrefix(name, appNamePrefix)
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.Atoi(raw)
+	if err != nil || id <= 0 {
+		return 0, false
+	}
+	return id, true
+}
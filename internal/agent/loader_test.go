@@ -0,0 +1,242 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/adk/agent"
+	adkmemory "google.golang.org/adk/memory"
+	"google.golang.org/adk/runner"
+	"google.golang.org/adk/session"
+	"google.golang.org/genai"
+
+	"github.com/easeaico/project-her/internal/config"
+	"github.com/easeaico/project-her/internal/types"
+)
+
+// tableCharacterRepo 按 ID 返回角色，并统计 GetByID 调用次数；release 非空时 GetByID 会等待其关闭。
+type tableCharacterRepo struct {
+	characters map[int]*types.Character
+	gets       int
+	release    chan struct{}
+	mu         sync.Mutex
+}
+
+func (r *tableCharacterRepo) GetByID(ctx context.Context, id int) (*types.Character, error) {
+	if r.release != nil {
+		<-r.release
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.gets++
+	character, ok := r.characters[id]
+	if !ok {
+		return nil, fmt.Errorf("character %d: %w", id, ErrCharacterNotFound)
+	}
+	return character, nil
+}
+
+func (r *tableCharacterRepo) GetDefault(ctx context.Context) (*types.Character, error) {
+	return r.GetByID(ctx, 1)
+}
+
+func (r *tableCharacterRepo) ListUpdatedAt(ctx context.Context) (map[int]time.Time, error) {
+	versions := make(map[int]time.Time, len(r.characters))
+	for id, character := range r.characters {
+		versions[id] = character.UpdatedAt
+	}
+	return versions, nil
+}
+
+func TestCharacterLoaderBuildsAgentsLazily(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{ChatModel: "xai/grok-4-fast", CharacterID: 1, ModelMaxAttempts: 1}
+	registry := newTestRegistry(cfg, &promptLLM{})
+	characters := &tableCharacterRepo{characters: map[int]*types.Character{
+		1: {ID: 1, Name: "Ava"},
+		2: {ID: 2, Name: "小雪"},
+	}}
+
+	loader, err := NewCharacterLoader(ctx, cfg, RolePlayDeps{Registry: registry, Characters: characters, Sessions: session.InMemoryService(), Memory: adkmemory.InMemoryService()})
+	if err != nil {
+		t.Fatalf("failed to create loader: %v", err)
+	}
+	if loader.RootAgent().Name() != "project_her_roleplay_1" || characters.gets != 1 {
+		t.Fatalf("expected only the root agent to be built, got %q after %d loads", loader.RootAgent().Name(), characters.gets)
+	}
+
+	// 新增角色无需重启即可列出并加载。
+	characters.characters[3] = &types.Character{ID: 3, Name: "Mia"}
+	if got := loader.ListAgents(); !slices.Equal(got, []string{"project_her_roleplay_1", "project_her_roleplay_2", "project_her_roleplay_3"}) {
+		t.Fatalf("unexpected agent list %q", got)
+	}
+	mia, err := loader.LoadAgent("project_her_roleplay_3")
+	if err != nil || mia.Name() != "project_her_roleplay_3" {
+		t.Fatalf("failed to load new character: %v", err)
+	}
+	again, err := loader.LoadAgent("project_her_roleplay_3")
+	if err != nil || again != mia || characters.gets != 2 {
+		t.Fatalf("expected cached agent, got %d loads", characters.gets)
+	}
+
+	if root, err := loader.LoadAgent(""); err != nil || root != loader.RootAgent() {
+		t.Fatalf("expected empty name to return the root agent")
+	}
+	for _, name := range []string{"project_her_roleplay_9", "project_her_roleplay_x", "other_app"} {
+		if _, err := loader.LoadAgent(name); err == nil {
+			t.Fatalf("expected %q to fail", name)
+		}
+	}
+}
+
+func TestCharacterLoaderReloadsChangedCharacters(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{ChatModel: "xai/grok-4-fast", CharacterID: 1, ModelMaxAttempts: 1, HistoryMaxTurns: 20}
+	live := &promptLLM{}
+	registry := newTestRegistry(cfg, live)
+	created := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	characters := &tableCharacterRepo{characters: map[int]*types.Character{
+		1: {ID: 1, Name: "Ava", Personality: "温柔", UpdatedAt: created},
+		2: {ID: 2, Name: "小雪", UpdatedAt: created},
+	}}
+	sessionService := session.InMemoryService()
+	memoryService := adkmemory.InMemoryService()
+
+	loader, err := NewCharacterLoader(ctx, cfg, RolePlayDeps{Registry: registry, Characters: characters, Sessions: sessionService, Memory: memoryService})
+	if err != nil {
+		t.Fatalf("failed to create loader: %v", err)
+	}
+	if _, err := loader.LoadAgent("project_her_roleplay_2"); err != nil {
+		t.Fatalf("failed to load agent: %v", err)
+	}
+	if _, err := sessionService.Create(ctx, &session.CreateRequest{AppName: "project_her_roleplay_1", UserID: "tester", SessionID: "s1"}); err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+	runLoaded := func(text string) {
+		t.Helper()
+		a, err := loader.LoadAgent("project_her_roleplay_1")
+		if err != nil {
+			t.Fatalf("failed to load agent: %v", err)
+		}
+		r, err := runner.New(runner.Config{AppName: a.Name(), Agent: a, SessionService: sessionService, MemoryService: memoryService})
+		if err != nil {
+			t.Fatalf("failed to create runner: %v", err)
+		}
+		for _, err := range r.Run(ctx, "tester", "s1", genai.NewContentFromText(text, "user"), agent.RunConfig{}) {
+			if err != nil {
+				t.Fatalf("unexpected run error: %v", err)
+			}
+		}
+	}
+
+	runLoaded("你好")
+	before := loader.RootAgent()
+
+	// 未变化的角色不重建；修改过的角色在下一轮使用新定义，已删除的角色被移除。
+	characters.characters[1] = &types.Character{ID: 1, Name: "Ava", Personality: "傲娇", UpdatedAt: created.Add(time.Minute)}
+	delete(characters.characters, 2)
+	gets := characters.gets
+	if err := loader.Refresh(ctx); err != nil {
+		t.Fatalf("failed to refresh: %v", err)
+	}
+	if characters.gets != gets+1 || loader.RootAgent() == before {
+		t.Fatalf("expected only the changed character to be rebuilt, got %d loads", characters.gets-gets)
+	}
+	if err := loader.Refresh(ctx); err != nil || characters.gets != gets+1 {
+		t.Fatalf("expected unchanged characters to stay cached, got %d loads, err %v", characters.gets-gets, err)
+	}
+
+	runLoaded("你变了吗")
+	if len(live.instructions) != 2 || !strings.Contains(live.instructions[0], "温柔") || !strings.Contains(live.instructions[1], "傲娇") {
+		t.Fatalf("expected the next turn to use the new personality, got %q", live.instructions)
+	}
+	if live.contents[1] < 3 {
+		t.Fatalf("expected the conversation history to survive the reload, got %d contents", live.contents[1])
+	}
+	characters.characters[2] = &types.Character{ID: 2, Name: "小雪", UpdatedAt: created}
+	gets = characters.gets
+	if _, err := loader.LoadAgent("project_her_roleplay_2"); err != nil || characters.gets != gets+1 {
+		t.Fatalf("expected removed agent to be rebuilt on demand, got %d loads, err %v", characters.gets-gets, err)
+	}
+}
+
+func TestCharacterLoaderBuildsOutsideTheLockOnce(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{ChatModel: "xai/grok-4-fast", CharacterID: 1, ModelMaxAttempts: 1}
+	characters := &tableCharacterRepo{characters: map[int]*types.Character{
+		1: {ID: 1, Name: "Ava"},
+		2: {ID: 2, Name: "小雪"},
+	}}
+	loader, err := NewCharacterLoader(ctx, cfg, RolePlayDeps{Registry: newTestRegistry(cfg, &promptLLM{}), Characters: characters, Sessions: session.InMemoryService(), Memory: adkmemory.InMemoryService()})
+	if err != nil {
+		t.Fatalf("failed to create loader: %v", err)
+	}
+
+	// 角色 2 的构建阻塞在数据库查询上时，根代理与已缓存代理仍可立即读取。
+	characters.release = make(chan struct{})
+	var wg sync.WaitGroup
+	loaded := make([]agent.Agent, 8)
+	for i := range loaded {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			loaded[i], _ = loader.LoadAgent("project_her_roleplay_2")
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		loader.RootAgent()
+		_, _ = loader.LoadAgent("project_her_roleplay_1")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("expected cached agents to be served while another character is building")
+	}
+	close(characters.release)
+	wg.Wait()
+
+	for _, a := range loaded {
+		if a == nil || a != loaded[0] {
+			t.Fatalf("expected every concurrent load to share one agent, got %v", loaded)
+		}
+	}
+	if characters.gets != 2 {
+		t.Fatalf("expected character 2 to be built once, got %d loads", characters.gets-1)
+	}
+}
+
+func TestCharacterLoaderCachesMissingCharacters(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{ChatModel: "xai/grok-4-fast", CharacterID: 1, ModelMaxAttempts: 1}
+	characters := &tableCharacterRepo{characters: map[int]*types.Character{1: {ID: 1, Name: "Ava"}}}
+	loader, err := NewCharacterLoader(ctx, cfg, RolePlayDeps{Registry: newTestRegistry(cfg, &promptLLM{}), Characters: characters, Sessions: session.InMemoryService(), Memory: adkmemory.InMemoryService()})
+	if err != nil {
+		t.Fatalf("failed to create loader: %v", err)
+	}
+
+	for range 3 {
+		if _, err := loader.LoadAgent("project_her_roleplay_9"); !errors.Is(err, ErrCharacterNotFound) {
+			t.Fatalf("expected not found error, got %v", err)
+		}
+	}
+	if characters.gets != 2 {
+		t.Fatalf("expected missing character to be queried once, got %d", characters.gets-1)
+	}
+
+	// 角色创建后，下一次刷新即清除负缓存。
+	characters.characters[9] = &types.Character{ID: 9, Name: "Mia"}
+	if err := loader.Refresh(ctx); err != nil {
+		t.Fatalf("failed to refresh: %v", err)
+	}
+	if a, err := loader.LoadAgent("project_her_roleplay_9"); err != nil || a.Name() != "project_her_roleplay_9" {
+		t.Fatalf("expected new character to load after refresh, got %v", err)
+	}
+}
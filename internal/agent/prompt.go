@@ -0,0 +1,104 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/session"
+
+	"github.com/easeaico/project-her/internal/callback"
+	"github.com/easeaico/project-her/internal/config"
+	"github.com/easeaico/project-her/internal/prompt"
+	"github.com/easeaico/project-her/internal/types"
+	"github.com/easeaico/project-her/internal/utils"
+)
+
+// newPromptAssembler 加载段落模板，并按“配置默认预算 → 角色覆盖”的顺序确定各段落预算。
+// Memory 段落默认容纳剧情概要与检索记忆，Few-Shot 段落沿用 FEW_SHOT_MAX_TOKENS，
+// Lore 段落沿用 LOREBOOK_MAX_TOKENS。
+func newPromptAssembler(cfg *config.Config, character *types.Character) (*prompt.Assembler, error) {
+	templates, err := prompt.LoadTemplates(cfg.PromptDir)
+	if err != nil {
+		return nil, err
+	}
+
+	budgets := map[string]int{
+		prompt.SectionFewShot: cfg.FewShotMaxTokens,
+		prompt.SectionLore:    cfg.LorebookMaxTokens,
+	}
+	if cfg.MemoryMaxTokens > 0 {
+		budgets[prompt.SectionMemory] = cfg.MemoryMaxTokens + max(cfg.StoryMaxTokens, 0)
+	}
+	for name, budget := range cfg.PromptSectionBudgets {
+		budgets[name] = budget
+	}
+
+	assembler, err := prompt.NewAssembler(templates, budgets, character.PromptSections)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assemble prompt for character %d: %w", character.ID, err)
+	}
+	return assembler, nil
+}
+
+// contextWindow 根据 History 段落确定历史裁剪规则；禁用 History 时只保留当前轮。
+func contextWindow(cfg *config.Config, assembler *prompt.Assembler) callback.ContextWindow {
+	window := callback.ContextWindow{
+		MaxTokens:        cfg.ContextMaxTokens,
+		HistoryMaxTokens: assembler.Budget(prompt.SectionHistory),
+		MaxTurns:         cfg.HistoryMaxTurns,
+	}
+	if !assembler.Enabled(prompt.SectionHistory) {
+		window.MaxTurns = 1
+	}
+	return window
+}
+
+// promptData 从角色与会话状态中收集段落模板所需的数据。
+// 角色文本中的 {{char}}/{{user}} 会替换为角色名与用户名。
+func promptData(ctx agent.ReadonlyContext, character *types.Character) prompt.Data {
+	state := ctx.ReadonlyState()
+	userName := stateString(state, "UserName")
+	if userName == "" {
+		userName = ctx.UserID()
+	}
+	normalize := func(text string) string {
+		return utils.NormalizePromptText(text, character.Name, userName)
+	}
+
+	return prompt.Data{
+		CharName:                character.Name,
+		UserName:                userName,
+		UserPronouns:            stateString(state, "UserPronouns"),
+		UserDescription:         normalize(stateString(state, "UserDescription")),
+		UserLanguage:            stateString(state, "UserLanguage"),
+		UserPersona:             normalize(stateString(state, "UserPersona")),
+		Personality:             normalize(character.Personality),
+		Description:             normalize(character.Description),
+		Scenario:                normalize(character.Scenario),
+		SystemPrompt:            normalize(character.SystemPrompt),
+		MessageExample:          normalize(character.MessageExample),
+		PostHistoryInstructions: normalize(character.PostHistoryInstructions),
+		Now:                     stateString(state, "Now"),
+		Location:                stateString(state, "Location"),
+		RelationshipLevel:       stateString(state, "RelationshipLevel"),
+		StorySoFar:              stateString(state, "StorySoFar"),
+		Lore:                    stateString(state, callback.StateLore),
+		Facts:                   stateString(state, "Facts"),
+		Memories:                stateString(state, "Memories"),
+	}
+}
+
+// stateString 读取字符串类型的会话状态，不存在或类型不符时返回空字符串。
+func stateString(state session.ReadonlyState, key string) string {
+	val, err := state.Get(key)
+	if err != nil {
+		if !errors.Is(err, session.ErrStateKeyNotExist) {
+			slog.Warn("failed to read session state", "key", key, "error", err.Error())
+		}
+		return ""
+	}
+	text, _ := val.(string)
+	return text
+}
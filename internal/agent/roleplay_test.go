@@ -0,0 +1,320 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/adk/agent"
+	adkmemory "google.golang.org/adk/memory"
+	"google.golang.org/adk/model"
+	"google.golang.org/adk/runner"
+	"google.golang.org/adk/session"
+	"google.golang.org/genai"
+
+	"github.com/easeaico/project-her/internal/config"
+	"github.com/easeaico/project-her/internal/models"
+	"github.com/easeaico/project-her/internal/models/modeltest"
+	"github.com/easeaico/project-her/internal/types"
+	"github.com/easeaico/project-her/internal/utils"
+)
+
+type fakeCharacterRepo struct {
+	character *types.Character
+}
+
+func (r *fakeCharacterRepo) GetByID(ctx context.Context, id int) (*types.Character, error) {
+	return r.character, nil
+}
+
+func (r *fakeCharacterRepo) GetDefault(ctx context.Context) (*types.Character, error) {
+	return r.character, nil
+}
+
+func (r *fakeCharacterRepo) ListUpdatedAt(ctx context.Context) (map[int]time.Time, error) {
+	return map[int]time.Time{r.character.ID: r.character.UpdatedAt}, nil
+}
+
+// newTestRegistry 创建模型注册表，对话模型固定返回 llm。
+func newTestRegistry(cfg *config.Config, llm model.LLM) *models.Registry {
+	registry := models.NewRegistry(cfg)
+	registry.RegisterLLM(models.ProviderXAI, func(ctx context.Context, modelName string, p config.ProviderConfig) (model.LLM, error) {
+		return llm, nil
+	})
+	return registry
+}
+
+// testConversation 在同一个会话中向角色扮演智能体逐条发送消息。
+type testConversation struct {
+	t      *testing.T
+	runner *runner.Runner
+}
+
+// newTestConversation 构建智能体与运行器并创建会话；deps 未设置 Sessions 与 Memory 时使用内存实现。
+func newTestConversation(t *testing.T, cfg *config.Config, deps RolePlayDeps) *testConversation {
+	t.Helper()
+	ctx := context.Background()
+	if deps.Sessions == nil {
+		deps.Sessions = session.InMemoryService()
+	}
+	if deps.Memory == nil {
+		deps.Memory = adkmemory.InMemoryService()
+	}
+
+	roleplay, err := NewRolePlayAgent(ctx, cfg, 1, deps)
+	if err != nil {
+		t.Fatalf("failed to create agent: %v", err)
+	}
+	r, err := runner.New(runner.Config{
+		AppName:        roleplay.Name(),
+		Agent:          roleplay,
+		SessionService: deps.Sessions,
+		MemoryService:  deps.Memory,
+	})
+	if err != nil {
+		t.Fatalf("failed to create runner: %v", err)
+	}
+	if _, err := deps.Sessions.Create(ctx, &session.CreateRequest{AppName: roleplay.Name(), UserID: "tester", SessionID: "s1"}); err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+	return &testConversation{t: t, runner: r}
+}
+
+// send 发送一条用户消息，返回智能体的完整回复。
+func (c *testConversation) send(text string) string {
+	c.t.Helper()
+	var reply strings.Builder
+	for event, err := range c.runner.Run(context.Background(), "tester", "s1", genai.NewContentFromText(text, "user"), agent.RunConfig{}) {
+		if err != nil {
+			c.t.Fatalf("unexpected run error: %v", err)
+		}
+		if event.Content != nil && !event.Partial {
+			for _, part := range event.Content.Parts {
+				reply.WriteString(part.Text)
+			}
+		}
+	}
+	return reply.String()
+}
+
+func runTurn(t *testing.T, cfg *config.Config, registry *models.Registry, text string) string {
+	t.Helper()
+	characters := &fakeCharacterRepo{character: &types.Character{
+		ID:           1,
+		Name:         "Ava",
+		Personality:  "温柔",
+		FirstMessage: "你来啦",
+	}}
+	return newTestConversation(t, cfg, RolePlayDeps{Registry: registry, Characters: characters}).send(text)
+}
+
+func TestRolePlayAgentReplaysRecordedTurnOffline(t *testing.T) {
+	cfg := &config.Config{
+		ChatModel:        "xai/grok-4-fast",
+		MemoryModel:      "gemini/gemini-2.0-flash",
+		ImageModel:       "gemini/gemini-2.0-flash-exp",
+		CharacterID:      1,
+		TopK:             5,
+		MemoryTrunkSize:  100,
+		ModelMaxAttempts: 1,
+		ModelFixtureMode: config.FixtureModeRecord,
+		ModelFixtureDir:  t.TempDir(),
+	}
+
+	live := &modeltest.ScriptedLLM{Model: "grok-4-fast", Reply: "*歪头笑* 早呀，今天也要开心。"}
+	recorded := runTurn(t, cfg, newTestRegistry(cfg, live), "早上好")
+	if recorded != live.Reply || live.Calls() != 1 {
+		t.Fatalf("expected live reply to be recorded, got %q after %d calls", recorded, live.Calls())
+	}
+
+	replayCfg := *cfg
+	replayCfg.ModelFixtureMode = config.FixtureModeReplay
+	replayed := runTurn(t, &replayCfg, models.NewRegistry(&replayCfg), "早上好")
+	if replayed != recorded {
+		t.Fatalf("expected replayed reply %q, got %q", recorded, replayed)
+	}
+	if live.Calls() != 1 {
+		t.Fatalf("expected replay to skip live model, got %d calls", live.Calls())
+	}
+
+	image := runTurn(t, &replayCfg, models.NewRegistry(&replayCfg), "/image 一只在发呆的猫")
+	if !strings.Contains(image, "data:image/png;base64,") {
+		t.Fatalf("expected fake image in reply, got %q", image)
+	}
+}
+
+func TestGenerateContentConfigAppliesCharacterProfile(t *testing.T) {
+	character := &types.Character{Generation: types.GenerationProfile{
+		Temperature:     genai.Ptr[float32](0.4),
+		StopSequences:   []string{"*blushes*"},
+		Seed:            genai.Ptr[int32](7),
+		MaxOutputTokens: 120,
+	}}
+
+	got := generateContentConfig(&config.Config{ReasoningEffort: "low"}, character)
+	if *got.Temperature != 0.4 || *got.Seed != 7 || got.MaxOutputTokens != 120 || got.StopSequences[0] != "*blushes*" {
+		t.Fatalf("expected character profile to be applied, got %+v", got)
+	}
+	if got.TopP != nil || got.PresencePenalty != nil || got.FrequencyPenalty != nil {
+		t.Fatalf("expected unset parameters to stay nil, got %+v", got)
+	}
+	if got.ThinkingConfig == nil || got.ThinkingConfig.ThinkingLevel != genai.ThinkingLevelLow {
+		t.Fatalf("expected reasoning effort to be kept, got %+v", got.ThinkingConfig)
+	}
+}
+
+// promptLLM 记录每次请求的系统提示、历史条数与各条内容。
+type promptLLM struct {
+	instructions []string
+	contents     []int
+	lastUser     []string
+	texts        [][]string
+}
+
+func (m *promptLLM) Name() string { return "grok-4-fast" }
+
+func (m *promptLLM) GenerateContent(ctx context.Context, req *model.LLMRequest, stream bool) iter.Seq2[*model.LLMResponse, error] {
+	m.instructions = append(m.instructions, utils.ExtractContentText(req.Config.SystemInstruction))
+	m.contents = append(m.contents, len(req.Contents))
+	m.lastUser = append(m.lastUser, utils.ExtractContentText(req.Contents[len(req.Contents)-1]))
+	texts := make([]string, 0, len(req.Contents))
+	for _, content := range req.Contents {
+		texts = append(texts, utils.ExtractContentText(content))
+	}
+	m.texts = append(m.texts, texts)
+	return func(yield func(*model.LLMResponse, error) bool) {
+		yield(&model.LLMResponse{Content: genai.NewContentFromText("嗯嗯", "model"), TurnComplete: true}, nil)
+	}
+}
+
+type fakeStoryUpdater struct {
+	transcripts []string
+}
+
+func (u *fakeStoryUpdater) UpdateStory(ctx context.Context, previous, transcript string) (string, error) {
+	u.transcripts = append(u.transcripts, transcript)
+	return previous + fmt.Sprintf("他们聊起了%d件事。", strings.Count(transcript, "user:")), nil
+}
+
+func TestRolePlayAgentFoldsTrimmedTurnsIntoStorySoFar(t *testing.T) {
+	cfg := &config.Config{
+		ChatModel:        "xai/grok-4-fast",
+		CharacterID:      1,
+		ModelMaxAttempts: 1,
+		HistoryMaxTurns:  2,
+	}
+	live := &promptLLM{}
+	story := &fakeStoryUpdater{}
+	characters := &fakeCharacterRepo{character: &types.Character{ID: 1, Name: "Ava"}}
+
+	conversation := newTestConversation(t, cfg, RolePlayDeps{Registry: newTestRegistry(cfg, live), Characters: characters, Story: story})
+	for _, text := range []string{"我养了一只猫", "它叫年糕", "今天下雨了", "你还记得吗"} {
+		conversation.send(text)
+	}
+
+	// 第三轮起最早的轮次被裁剪，每个被裁剪的轮次只并入概要一次。
+	if len(story.transcripts) != 2 || !strings.Contains(story.transcripts[0], "我养了一只猫") || !strings.Contains(story.transcripts[1], "它叫年糕") {
+		t.Fatalf("expected each trimmed turn to be summarized once, got %q", story.transcripts)
+	}
+	if live.contents[3] != 3 {
+		t.Fatalf("expected history to keep the last two turns, got %d contents", live.contents[3])
+	}
+	if last := live.instructions[3]; !strings.Contains(last, "[Story So Far: 他们聊起了1件事。]") {
+		t.Fatalf("expected story so far in instruction, got %q", last)
+	}
+	// Anchor 段落位于历史之后，附在最新的用户消息末尾。
+	if !strings.HasPrefix(live.lastUser[3], "你还记得吗") || !strings.HasSuffix(live.lastUser[3], "Keep reply under 50 words.]") {
+		t.Fatalf("expected anchor after the latest user message, got %q", live.lastUser[3])
+	}
+}
+
+type fakeLorebookRepo struct {
+	entries []types.LoreEntry
+}
+
+func (r *fakeLorebookRepo) ListEntries(ctx context.Context, characterID int) ([]types.LoreEntry, error) {
+	return r.entries, nil
+}
+
+func TestRolePlayAgentInjectsLorebookEntries(t *testing.T) {
+	cfg := &config.Config{ChatModel: "xai/grok-4-fast", ModelMaxAttempts: 1, HistoryMaxTurns: 20, LorebookScanDepth: 2, LorebookMaxRecursion: 1}
+	live := &promptLLM{}
+	characters := &fakeCharacterRepo{character: &types.Character{
+		ID:            1,
+		Name:          "Ava",
+		CharacterBook: []byte(`{"entries":[{"keys":["雾城"],"content":"{{char}} 出生在雾城。","enabled":true}]}`),
+	}}
+	depth := 1
+	lore := &fakeLorebookRepo{entries: []types.LoreEntry{
+		{Name: "rain", Keys: []string{"雾城"}, Content: "雾城总是在下雨。", Depth: &depth},
+		{Name: "umbrella", Keys: []string{"下雨"}, Content: "{{user}} 有一把黄色的伞。"},
+	}}
+
+	conversation := newTestConversation(t, cfg, RolePlayDeps{Registry: newTestRegistry(cfg, live), Characters: characters, Lore: lore})
+	for _, text := range []string{"你好", "讲讲雾城吧"} {
+		conversation.send(text)
+	}
+
+	if strings.Contains(live.instructions[0], "World Info") {
+		t.Fatalf("expected no lore before the keyword appears, got %q", live.instructions[0])
+	}
+	// 角色卡世界书与数据库条目都会生效，深度条目的内容还会递归触发其他条目。
+	last := live.instructions[1]
+	if !strings.Contains(last, "Ava 出生在雾城。") || !strings.Contains(last, "tester 有一把黄色的伞。") {
+		t.Fatalf("expected lore section in instruction, got %q", last)
+	}
+	texts := live.texts[1]
+	if len(texts) < 2 || texts[len(texts)-2] != "[World Info]\n雾城总是在下雨。" || !strings.HasPrefix(texts[len(texts)-1], "讲讲雾城吧") {
+		t.Fatalf("expected depth entry right before the latest message, got %q", texts)
+	}
+}
+
+type fakeProfileRepo struct {
+	profiles map[string]*types.UserProfile
+}
+
+func (r *fakeProfileRepo) GetProfile(ctx context.Context, userID string) (*types.UserProfile, error) {
+	return r.profiles[userID], nil
+}
+
+func (r *fakeProfileRepo) SaveProfile(ctx context.Context, profile *types.UserProfile) error {
+	saved := *profile
+	r.profiles[profile.UserID] = &saved
+	return nil
+}
+
+func TestRolePlayAgentUsesUserProfile(t *testing.T) {
+	cfg := &config.Config{ChatModel: "xai/grok-4-fast", ModelMaxAttempts: 1, HistoryMaxTurns: 20}
+	live := &promptLLM{}
+	characters := &fakeCharacterRepo{character: &types.Character{ID: 1, Name: "Ava", FirstMessage: "{{user}}，你来啦"}}
+	profiles := &fakeProfileRepo{profiles: map[string]*types.UserProfile{}}
+
+	send := newTestConversation(t, cfg, RolePlayDeps{Registry: newTestRegistry(cfg, live), Characters: characters, Profiles: profiles}).send
+
+	if reply := send("/profile timezone Mars/Base"); !strings.Contains(reply, "无法识别的时区") {
+		t.Fatalf("expected invalid timezone to be rejected, got %q", reply)
+	}
+	send("/profile name 小林")
+	send("/profile 代词 他")
+	send("/profile timezone Asia/Tokyo")
+	if reply := send("/profile persona {{char}} 的大学同学"); !strings.Contains(reply, "人设：{{char}} 的大学同学") {
+		t.Fatalf("expected profile reply, got %q", reply)
+	}
+	if len(live.instructions) != 0 {
+		t.Fatalf("expected /profile to skip the model, got %d calls", len(live.instructions))
+	}
+
+	if reply := send("0_0"); reply != "小林，你来啦" {
+		t.Fatalf("expected greeting to use the display name, got %q", reply)
+	}
+	send("你好")
+	instruction := live.instructions[0]
+	for _, want := range []string{"The user's name is 小林. Pronouns: 他.", "Ava 的大学同学", "+09:00]"} {
+		if !strings.Contains(instruction, want) {
+			t.Fatalf("expected %q in instruction, got %q", want, instruction)
+		}
+	}
+}
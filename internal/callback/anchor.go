@@ -0,0 +1,40 @@
+package callback
+
+import (
+	"strings"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/agent/llmagent"
+	"google.golang.org/adk/model"
+	"google.golang.org/genai"
+)
+
+// NewAnchorCallback appends the anchor prompt section after the history, as
+// an extra part of the latest user message, so the tail instruction is the
+// last thing the model reads. Tool follow-up steps are left untouched. The
+// session event itself is not modified.
+func NewAnchorCallback(render func(ctx agent.ReadonlyContext) (string, error)) llmagent.BeforeModelCallback {
+	return func(ctx agent.CallbackContext, req *model.LLMRequest) (*model.LLMResponse, error) {
+		if len(req.Contents) == 0 {
+			return nil, nil
+		}
+		last := req.Contents[len(req.Contents)-1]
+		if last == nil || last.Role != genai.RoleUser || isFunctionResponse(last) {
+			return nil, nil
+		}
+
+		anchor, err := render(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if anchor = strings.TrimSpace(anchor); anchor == "" {
+			return nil, nil
+		}
+
+		parts := make([]*genai.Part, 0, len(last.Parts)+1)
+		parts = append(parts, last.Parts...)
+		parts = append(parts, genai.NewPartFromText("\n\n"+anchor))
+		req.Contents[len(req.Contents)-1] = &genai.Content{Role: last.Role, Parts: parts}
+		return nil, nil
+	}
+}
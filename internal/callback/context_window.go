@@ -0,0 +1,148 @@
+package callback
+
+import (
+	"log/slog"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/agent/llmagent"
+	"google.golang.org/adk/model"
+	"google.golang.org/genai"
+
+	"github.com/easeaico/project-her/internal/utils"
+)
+
+// trimStats describes what trimHistory removed from a request.
+type trimStats struct {
+	SystemTokens  int
+	TurnsBefore   int
+	TurnsDropped  int
+	TokensBefore  int
+	TokensAfter   int
+	OverBudget    bool
+	WindowDropped int
+}
+
+// ContextWindow holds the limits applied to each chat request. A
+// non-positive limit disables the corresponding check.
+type ContextWindow struct {
+	// MaxTokens bounds the system prompt plus history.
+	MaxTokens int
+	// HistoryMaxTokens bounds the history alone.
+	HistoryMaxTokens int
+	// MaxTurns is the sliding window of turns kept in history.
+	MaxTurns int
+}
+
+// NewContextWindowCallback keeps each chat request within the context
+// window. The session history is cut to the last MaxTurns turns, then the
+// oldest turns are dropped until the history fits in HistoryMaxTokens and the
+// system prompt plus history fit in MaxTokens. The current turn is always
+// kept. Dropped turns not yet covered by the story summary are recorded for
+// NewStorySoFarCallback.
+func NewContextWindowCallback(window ContextWindow) llmagent.BeforeModelCallback {
+	return func(ctx agent.CallbackContext, req *model.LLMRequest) (*model.LLMResponse, error) {
+		stats, dropped := trimHistory(req, window)
+		if err := recordTrimmedTurns(ctx, dropped); err != nil {
+			return nil, err
+		}
+		if stats.TurnsDropped > 0 {
+			slog.Info("trimmed conversation history",
+				"app", ctx.AppName(),
+				"session", ctx.SessionID(),
+				"turns_before", stats.TurnsBefore,
+				"turns_dropped", stats.TurnsDropped,
+				"dropped_by_window", stats.WindowDropped,
+				"system_tokens", stats.SystemTokens,
+				"tokens_before", stats.TokensBefore,
+				"tokens_after", stats.TokensAfter,
+			)
+		}
+		if stats.OverBudget {
+			slog.Warn("request exceeds context budget after trimming",
+				"app", ctx.AppName(),
+				"session", ctx.SessionID(),
+				"budget", window.MaxTokens,
+				"history_budget", window.HistoryMaxTokens,
+				"tokens", stats.TokensAfter,
+			)
+		}
+		return nil, nil
+	}
+}
+
+// trimHistory drops whole turns from the front of req.Contents so that tool
+// calls and their responses are never split, and returns the dropped turns.
+func trimHistory(req *model.LLMRequest, window ContextWindow) (trimStats, [][]*genai.Content) {
+	var stats trimStats
+	if req.Config != nil {
+		stats.SystemTokens = utils.EstimateContentTokens(req.Config.SystemInstruction)
+	}
+
+	turns := splitTurns(req.Contents)
+	stats.TurnsBefore = len(turns)
+	tokens := make([]int, len(turns))
+	total := stats.SystemTokens
+	for i, turn := range turns {
+		for _, content := range turn {
+			tokens[i] += utils.EstimateContentTokens(content)
+		}
+		total += tokens[i]
+	}
+	stats.TokensBefore = total
+
+	start := 0
+	if window.MaxTurns > 0 && len(turns) > window.MaxTurns {
+		for ; start < len(turns)-window.MaxTurns; start++ {
+			total -= tokens[start]
+		}
+		stats.WindowDropped = start
+	}
+	overBudget := func() bool {
+		history := total - stats.SystemTokens
+		return (window.MaxTokens > 0 && total > window.MaxTokens) ||
+			(window.HistoryMaxTokens > 0 && history > window.HistoryMaxTokens)
+	}
+	for start < len(turns)-1 && overBudget() {
+		total -= tokens[start]
+		start++
+	}
+	stats.OverBudget = overBudget()
+	stats.TurnsDropped = start
+	stats.TokensAfter = total
+
+	if start > 0 {
+		var kept []*genai.Content
+		for _, turn := range turns[start:] {
+			kept = append(kept, turn...)
+		}
+		req.Contents = kept
+	}
+	return stats, turns[:start]
+}
+
+// splitTurns groups contents into turns, each starting at a user message.
+// Function responses are sent with the user role but belong to the turn of
+// the call that produced them. Contents before the first user message, such
+// as the character greeting, form their own leading turn.
+func splitTurns(contents []*genai.Content) [][]*genai.Content {
+	var turns [][]*genai.Content
+	for _, content := range contents {
+		if content == nil {
+			continue
+		}
+		if len(turns) == 0 || (content.Role == genai.RoleUser && !isFunctionResponse(content)) {
+			turns = append(turns, nil)
+		}
+		turns[len(turns)-1] = append(turns[len(turns)-1], content)
+	}
+	return turns
+}
+
+func isFunctionResponse(content *genai.Content) bool {
+	for _, part := range content.Parts {
+		if part != nil && part.FunctionResponse != nil {
+			return true
+		}
+	}
+	return false
+}
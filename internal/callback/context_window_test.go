@@ -0,0 +1,79 @@
+package callback
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/adk/model"
+	"google.golang.org/genai"
+)
+
+func historyRequest() *model.LLMRequest {
+	return &model.LLMRequest{
+		Config: &genai.GenerateContentConfig{
+			SystemInstruction: genai.NewContentFromText("你是小雪", "system"),
+		},
+		Contents: []*genai.Content{
+			genai.NewContentFromText("你来啦", genai.RoleModel),
+			genai.NewContentFromText("第一轮"+strings.Repeat("很长的话", 50), genai.RoleUser),
+			genai.NewContentFromText("好的", genai.RoleModel),
+			genai.NewContentFromText("查一下天气", genai.RoleUser),
+			{Role: genai.RoleModel, Parts: []*genai.Part{{FunctionCall: &genai.FunctionCall{Name: "weather"}}}},
+			{Role: genai.RoleUser, Parts: []*genai.Part{{FunctionResponse: &genai.FunctionResponse{Name: "weather", Response: map[string]any{"sky": "晴"}}}}},
+			genai.NewContentFromText("今天是晴天", genai.RoleModel),
+			genai.NewContentFromText("现在呢", genai.RoleUser),
+		},
+	}
+}
+
+func TestTrimHistoryKeepsSlidingWindowOfTurns(t *testing.T) {
+	req := historyRequest()
+
+	stats, dropped := trimHistory(req, ContextWindow{MaxTurns: 2})
+	if stats.TurnsBefore != 4 || stats.TurnsDropped != 2 || stats.WindowDropped != 2 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if len(dropped) != 2 || dropped[0][0].Parts[0].Text != "你来啦" {
+		t.Fatalf("expected greeting and first turn to be dropped, got %d turns", len(dropped))
+	}
+	// The tool call and its response stay together with the turn that made them.
+	if len(req.Contents) != 5 || req.Contents[0].Parts[0].Text != "查一下天气" {
+		t.Fatalf("expected last two turns to be kept, got %d contents starting with %q", len(req.Contents), req.Contents[0].Parts[0].Text)
+	}
+}
+
+func TestTrimHistoryDropsOldestTurnsToFitBudget(t *testing.T) {
+	req := historyRequest()
+
+	stats, _ := trimHistory(req, ContextWindow{MaxTokens: 120})
+	if stats.TurnsDropped != 2 || stats.TokensAfter > 120 || stats.OverBudget {
+		t.Fatalf("expected long first turn to be dropped, got %+v", stats)
+	}
+	if req.Contents[0].Parts[0].Text != "查一下天气" {
+		t.Fatalf("unexpected first kept content %q", req.Contents[0].Parts[0].Text)
+	}
+
+	tiny := historyRequest()
+	stats, _ = trimHistory(tiny, ContextWindow{MaxTokens: 1})
+	if !stats.OverBudget || len(tiny.Contents) != 1 || tiny.Contents[0].Parts[0].Text != "现在呢" {
+		t.Fatalf("expected only the current turn to survive, got %+v with %d contents", stats, len(tiny.Contents))
+	}
+}
+
+func TestTrimHistoryAppliesHistoryBudgetSeparately(t *testing.T) {
+	req := historyRequest()
+
+	stats, _ := trimHistory(req, ContextWindow{HistoryMaxTokens: 60})
+	if stats.TurnsDropped != 2 || stats.TokensAfter-stats.SystemTokens > 60 {
+		t.Fatalf("expected history budget to drop the long first turn, got %+v", stats)
+	}
+}
+
+func TestTrimHistoryWithinBudgetLeavesRequestUntouched(t *testing.T) {
+	req := historyRequest()
+
+	stats, dropped := trimHistory(req, ContextWindow{MaxTokens: 100000, MaxTurns: 20})
+	if stats.TurnsDropped != 0 || len(dropped) != 0 || len(req.Contents) != 8 || stats.TokensBefore != stats.TokensAfter {
+		t.Fatalf("expected no trimming, got %+v", stats)
+	}
+}
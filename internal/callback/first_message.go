@@ -3,6 +3,7 @@ package callback
 import (
 	"fmt"
 	"log/slog"
+	"math/rand/v2"
 	"strings"
 
 	"google.golang.org/adk/agent"
@@ -13,7 +14,8 @@ import (
 	"github.com/easeaico/project-her/internal/utils"
 )
 
-// NewFirstMessageCallback returns first_mes on empty first user input.
+// NewFirstMessageCallback returns a greeting on empty first user input, picked
+// at random from first_mes and the card's alternate greetings.
 func NewFirstMessageCallback(character *types.Character) agent.BeforeAgentCallback {
 	return func(cbCtx agent.CallbackContext) (*genai.Content, error) {
 		userText := utils.ExtractContentText(cbCtx.UserContent())
@@ -27,15 +29,34 @@ func NewFirstMessageCallback(character *types.Character) agent.BeforeAgentCallba
 			}
 		}
 
-		if trimmed == "0_0" && character != nil && character.FirstMessage != "" {
-			firstMessage := utils.NormalizePromptText(character.FirstMessage, character.Name, cbCtx.UserID())
-			return genai.NewContentFromText(firstMessage, "model"), nil
+		if trimmed == "0_0" && character != nil {
+			if greeting := pickGreeting(character); greeting != "" {
+				userName, _ := readStringState(state, "UserName")
+				if userName == "" {
+					userName = cbCtx.UserID()
+				}
+				firstMessage := utils.NormalizePromptText(greeting, character.Name, userName)
+				return genai.NewContentFromText(firstMessage, "model"), nil
+			}
 		}
 
 		return nil, nil
 	}
 }
 
+// pickGreeting returns first_mes or one of the alternate greetings.
+func pickGreeting(character *types.Character) string {
+	greetings := make([]string, 0, len(character.AlternateGreetings)+1)
+	if character.FirstMessage != "" {
+		greetings = append(greetings, character.FirstMessage)
+	}
+	greetings = append(greetings, character.AlternateGreetings...)
+	if len(greetings) == 0 {
+		return ""
+	}
+	return greetings[rand.IntN(len(greetings))]
+}
+
 func getStateBool(state session.State, key string) bool {
 	value, err := state.Get(key)
 	if err != nil {
@@ -10,7 +10,6 @@ import (
 	"google.golang.org/adk/agent"
 	"google.golang.org/genai"
 
-	"github.com/easeaico/project-her/internal/config"
 	"github.com/easeaico/project-her/internal/models"
 	"github.com/easeaico/project-her/internal/types"
 	"github.com/easeaico/project-her/internal/utils"
@@ -35,8 +34,8 @@ var defaultTemplatesText = `
 var defaultTemplates = template.Must(template.New("command").Parse(defaultTemplatesText))
 
 // NewCommandCallback 创建 /image 命令的前置处理回调。
-func NewCommandCallback(ctx context.Context, cfg *config.Config, character *types.Character) agent.BeforeAgentCallback {
-	imageService, err := models.NewGeminiImageGenerator(ctx, cfg.GoogleAPIKey, cfg.ImageModel, cfg.AspectRatio)
+func NewCommandCallback(ctx context.Context, registry *models.Registry, character *types.Character) agent.BeforeAgentCallback {
+	imageService, err := registry.ImageGenerator(ctx)
 	if err != nil {
 		slog.Error("failed to create image generator", "error", err.Error())
 		return nil
@@ -55,7 +54,7 @@ func NewCommandCallback(ctx context.Context, cfg *config.Config, character *type
 	}
 }
 
-func processImageCommand(ctx context.Context, input string, character *types.Character, imageService *models.ImageGenerator) (*genai.Content, error) {
+func processImageCommand(ctx context.Context, input string, character *types.Character, imageService models.ImageGenerator) (*genai.Content, error) {
 	prompt := strings.TrimSpace(strings.TrimPrefix(input, "/image"))
 	if prompt == "" {
 		return renderResponse(tplUsage, nil)
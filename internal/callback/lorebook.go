@@ -0,0 +1,183 @@
+package callback
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/agent/llmagent"
+	"google.golang.org/adk/model"
+	"google.golang.org/adk/session"
+	"google.golang.org/genai"
+
+	"github.com/easeaico/project-her/internal/lorebook"
+	"github.com/easeaico/project-her/internal/types"
+	"github.com/easeaico/project-her/internal/utils"
+)
+
+// Lorebook state keys. Both are recomputed every turn, so they are temp: keys
+// and never persisted with the session.
+const (
+	// StateLore holds the entries rendered into the lore prompt section.
+	StateLore = session.KeyPrefixTemp + "Lore"
+	// stateLoreDepth holds the JSON-encoded entries inserted into the history.
+	stateLoreDepth = session.KeyPrefixTemp + "LoreDepth"
+)
+
+// loreInsert is the text inserted Depth messages from the end of the history.
+type loreInsert struct {
+	Depth int    `json:"depth"`
+	Text  string `json:"text"`
+}
+
+// NewLorebookCallback scans the recent messages against the character's
+// lorebook (entries from repo plus the card's character_book) and stores the
+// activated entries in session state for the prompt and NewLoreDepthCallback.
+// repo may be nil, in which case only the character_book is used.
+func NewLorebookCallback(sessionService session.Service, repo lorebook.Repo, character *types.Character, opts lorebook.Options) agent.BeforeAgentCallback {
+	book, err := lorebook.FromCharacterBook(character.CharacterBook)
+	if err != nil {
+		slog.Warn("ignoring character_book", "character_id", character.ID, "error", err)
+	}
+
+	return func(ctx agent.CallbackContext) (*genai.Content, error) {
+		entries := append([]types.LoreEntry(nil), book...)
+		if repo != nil {
+			stored, err := repo.ListEntries(ctx, character.ID)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, stored...)
+		}
+
+		var result lorebook.Result
+		if len(entries) > 0 {
+			messages, err := recentMessages(ctx, sessionService, scanDepth(entries, opts.ScanDepth))
+			if err != nil {
+				return nil, err
+			}
+			result = lorebook.Activate(entries, messages, opts)
+		}
+
+		userName, _ := readStringState(ctx.State(), "UserName")
+		if userName == "" {
+			userName = ctx.UserID()
+		}
+		normalize := func(entry types.LoreEntry) string {
+			return strings.TrimSpace(utils.NormalizePromptText(entry.Content, character.Name, userName))
+		}
+
+		var lore []string
+		for _, entry := range result.Prompt {
+			lore = append(lore, normalize(entry))
+		}
+		byDepth := make(map[int][]string)
+		for _, entry := range result.Depth {
+			byDepth[*entry.Depth] = append(byDepth[*entry.Depth], normalize(entry))
+		}
+		inserts := make([]loreInsert, 0, len(byDepth))
+		for depth, texts := range byDepth {
+			inserts = append(inserts, loreInsert{Depth: depth, Text: strings.Join(texts, "\n")})
+		}
+		sort.Slice(inserts, func(i, j int) bool { return inserts[i].Depth < inserts[j].Depth })
+		encoded, err := json.Marshal(inserts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode lorebook inserts: %w", err)
+		}
+
+		if len(lore) > 0 || len(inserts) > 0 {
+			slog.Info("lorebook entries activated", "prompt", len(lore), "depth", len(result.Depth))
+		}
+		if err := ctx.State().Set(StateLore, strings.Join(lore, "\n")); err != nil {
+			return nil, fmt.Errorf("failed to set lore: %w", err)
+		}
+		if err := ctx.State().Set(stateLoreDepth, string(encoded)); err != nil {
+			return nil, fmt.Errorf("failed to set lore: %w", err)
+		}
+		return nil, nil
+	}
+}
+
+// NewLoreDepthCallback inserts the lorebook entries that have a depth into
+// the history, depth messages from the end, without splitting a tool call
+// from its response. The session events are not modified.
+func NewLoreDepthCallback() llmagent.BeforeModelCallback {
+	return func(ctx agent.CallbackContext, req *model.LLMRequest) (*model.LLMResponse, error) {
+		if len(req.Contents) == 0 {
+			return nil, nil
+		}
+		last := req.Contents[len(req.Contents)-1]
+		if last == nil || last.Role != genai.RoleUser || isFunctionResponse(last) {
+			return nil, nil
+		}
+		raw, _ := readStringState(ctx.State(), stateLoreDepth)
+		if raw == "" {
+			return nil, nil
+		}
+		var inserts []loreInsert
+		if err := json.Unmarshal([]byte(raw), &inserts); err != nil {
+			return nil, fmt.Errorf("failed to decode lorebook inserts: %w", err)
+		}
+
+		contents := append([]*genai.Content(nil), req.Contents...)
+		// Inserts are sorted by depth, so later positions are filled first and
+		// the positions computed from req.Contents stay valid.
+		for _, insert := range inserts {
+			idx := max(len(req.Contents)-insert.Depth, 0)
+			for idx > 0 && idx < len(req.Contents) && isFunctionResponse(req.Contents[idx]) {
+				idx--
+			}
+			content := genai.NewContentFromText("[World Info]\n"+insert.Text, genai.RoleUser)
+			contents = append(contents[:idx], append([]*genai.Content{content}, contents[idx:]...)...)
+		}
+		req.Contents = contents
+		return nil, nil
+	}
+}
+
+// scanDepth returns how many recent messages the entries need; 0 means all.
+func scanDepth(entries []types.LoreEntry, defaultDepth int) int {
+	if defaultDepth <= 0 {
+		return 0
+	}
+	depth := defaultDepth
+	for _, entry := range entries {
+		depth = max(depth, entry.ScanDepth)
+	}
+	return depth
+}
+
+// recentMessages returns the text of the last depth messages of the session,
+// oldest first, including the current user message.
+func recentMessages(ctx agent.CallbackContext, sessionService session.Service, depth int) ([]string, error) {
+	req := &session.GetRequest{AppName: ctx.AppName(), UserID: ctx.UserID(), SessionID: ctx.SessionID()}
+	if depth > 0 {
+		// Tool calls and empty events are skipped, so fetch some spare events.
+		req.NumRecentEvents = depth * 2
+	}
+	resp, err := sessionService.Get(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	var messages []string
+	for event := range resp.Session.Events().All() {
+		if event.Partial {
+			continue
+		}
+		if text := strings.TrimSpace(utils.ExtractContentText(event.Content)); text != "" {
+			messages = append(messages, text)
+		}
+	}
+	current := strings.TrimSpace(utils.ExtractContentText(ctx.UserContent()))
+	if current != "" && (len(messages) == 0 || messages[len(messages)-1] != current) {
+		messages = append(messages, current)
+	}
+	if depth > 0 && len(messages) > depth {
+		messages = messages[len(messages)-depth:]
+	}
+	return messages, nil
+}
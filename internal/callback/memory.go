@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/easeaico/project-her/internal/config"
+	"github.com/easeaico/project-her/internal/types"
 	"github.com/easeaico/project-her/internal/utils"
 	"google.golang.org/adk/agent"
 	"google.golang.org/adk/memory"
@@ -38,6 +39,8 @@ func NewAddSessionToMemoryCallback(sessionService session.Service, memoryService
 }
 
 // NewMemoriesStateCallback searches memories and writes them into session state.
+// User facts (entries authored by types.MemoryTypeFacts) go to the Facts state
+// key and are charged to the memory budget first, so they are always kept.
 func NewMemoriesStateCallback(memoryService memory.Service, cfg *config.Config) agent.BeforeAgentCallback {
 	return func(ctx agent.CallbackContext) (*genai.Content, error) {
 		query := strings.TrimSpace(utils.ExtractContentText(ctx.UserContent()))
@@ -57,7 +60,16 @@ func NewMemoriesStateCallback(memoryService memory.Service, cfg *config.Config)
 			return nil, fmt.Errorf("failed to search memories: %w", err)
 		}
 
-		instruction := buildMemoriesBlock(resp, cfg.TopK)
+		facts, rest := splitFacts(resp)
+		factsBlock := buildFactsBlock(facts)
+		maxTokens := cfg.MemoryMaxTokens
+		if maxTokens > 0 {
+			maxTokens = max(maxTokens-utils.EstimateTokens(factsBlock), 1)
+		}
+		instruction := buildMemoriesBlock(rest, cfg.TopK, maxTokens)
+		if err := ctx.State().Set("Facts", factsBlock); err != nil {
+			return nil, fmt.Errorf("failed to set facts: %w", err)
+		}
 		if err := ctx.State().Set("Memories", instruction); err != nil {
 			return nil, fmt.Errorf("failed to set memories: %w", err)
 		}
@@ -66,7 +78,43 @@ func NewMemoriesStateCallback(memoryService memory.Service, cfg *config.Config)
 	}
 }
 
-func buildMemoriesBlock(resp *memory.SearchResponse, maxEntries int) string {
+// splitFacts separates user facts from the other memories, keeping their order.
+func splitFacts(resp *memory.SearchResponse) (facts []memory.Entry, rest *memory.SearchResponse) {
+	rest = &memory.SearchResponse{}
+	if resp == nil {
+		return nil, rest
+	}
+	for _, entry := range resp.Memories {
+		if entry.Author == types.MemoryTypeFacts {
+			facts = append(facts, entry)
+		} else {
+			rest.Memories = append(rest.Memories, entry)
+		}
+	}
+	return facts, rest
+}
+
+// buildFactsBlock renders one fact per line with the date it became true.
+func buildFactsBlock(facts []memory.Entry) string {
+	var b strings.Builder
+	for _, entry := range facts {
+		text := strings.TrimSpace(utils.ExtractContentText(entry.Content))
+		if text == "" {
+			continue
+		}
+		b.WriteString("- ")
+		b.WriteString(text)
+		if !entry.Timestamp.IsZero() {
+			b.WriteString(" (since " + entry.Timestamp.Format(time.DateOnly) + ")")
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// buildMemoriesBlock renders at most maxEntries memories, in ranking order,
+// and stops before the block exceeds maxTokens (0 disables the limit).
+func buildMemoriesBlock(resp *memory.SearchResponse, maxEntries, maxTokens int) string {
 	if resp == nil || len(resp.Memories) == 0 {
 		return ""
 	}
@@ -77,7 +125,8 @@ func buildMemoriesBlock(resp *memory.SearchResponse, maxEntries int) string {
 	}
 
 	var instruction strings.Builder
-	for _, entry := range memories {
+	used := 0
+	for i, entry := range memories {
 		text := strings.TrimSpace(utils.ExtractContentText(entry.Content))
 		if text == "" {
 			continue
@@ -87,7 +136,14 @@ func buildMemoriesBlock(resp *memory.SearchResponse, maxEntries int) string {
 			stamp = entry.Timestamp.Format(time.RFC3339)
 		}
 		author := strings.TrimSpace(entry.Author)
-		instruction.WriteString(formatMemoryLine(stamp, author, text))
+		line := formatMemoryLine(stamp, author, text)
+		cost := utils.EstimateTokens(line)
+		if maxTokens > 0 && used+cost > maxTokens {
+			slog.Info("memories trimmed to token budget", "kept", i, "dropped", len(memories)-i, "budget", maxTokens)
+			break
+		}
+		used += cost
+		instruction.WriteString(line)
 		instruction.WriteString("\n")
 	}
 
@@ -0,0 +1,149 @@
+package callback
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/genai"
+
+	"github.com/easeaico/project-her/internal/types"
+	"github.com/easeaico/project-her/internal/utils"
+)
+
+// UserProfileRepo persists user profiles. GetProfile returns nil without an
+// error when the user has no profile yet.
+type UserProfileRepo interface {
+	GetProfile(ctx context.Context, userID string) (*types.UserProfile, error)
+	SaveProfile(ctx context.Context, profile *types.UserProfile) error
+}
+
+// profileField is one editable field of the /profile command.
+type profileField struct {
+	name     string
+	label    string
+	aliases  []string
+	maxRunes int
+	get      func(*types.UserProfile) string
+	set      func(*types.UserProfile, string)
+	validate func(string) error
+}
+
+var profileFields = []profileField{
+	{
+		name: "name", label: "名字", aliases: []string{"名字", "昵称"}, maxRunes: 64,
+		get: func(p *types.UserProfile) string { return p.DisplayName },
+		set: func(p *types.UserProfile, v string) { p.DisplayName = v },
+	},
+	{
+		name: "pronouns", label: "代词", aliases: []string{"代词"}, maxRunes: 32,
+		get: func(p *types.UserProfile) string { return p.Pronouns },
+		set: func(p *types.UserProfile, v string) { p.Pronouns = v },
+	},
+	{
+		name: "description", label: "简介", aliases: []string{"简介"}, maxRunes: 1000,
+		get: func(p *types.UserProfile) string { return p.Description },
+		set: func(p *types.UserProfile, v string) { p.Description = v },
+	},
+	{
+		name: "language", label: "语言", aliases: []string{"语言"}, maxRunes: 32,
+		get: func(p *types.UserProfile) string { return p.Language },
+		set: func(p *types.UserProfile, v string) { p.Language = v },
+	},
+	{
+		name: "timezone", label: "时区", aliases: []string{"时区"}, maxRunes: 64,
+		get: func(p *types.UserProfile) string { return p.Timezone },
+		set: func(p *types.UserProfile, v string) { p.Timezone = v },
+		validate: func(v string) error {
+			if _, err := time.LoadLocation(v); err != nil {
+				return fmt.Errorf("无法识别的时区 %q，请使用 IANA 名称，例如 Asia/Shanghai", v)
+			}
+			return nil
+		},
+	},
+	{
+		name: "persona", label: "人设", aliases: []string{"人设"}, maxRunes: 1000,
+		get: func(p *types.UserProfile) string { return p.Persona },
+		set: func(p *types.UserProfile, v string) { p.Persona = v },
+	},
+}
+
+const profileUsage = "用法：/profile <字段> <内容>，内容留空则清除该字段。\n字段：name（名字）、pronouns（代词）、description（简介）、language（语言）、timezone（时区）、persona（人设）"
+
+// NewProfileCommandCallback handles the /profile command: "/profile" shows
+// the user's profile and "/profile <field> <value>" edits one field.
+func NewProfileCommandCallback(profiles UserProfileRepo) agent.BeforeAgentCallback {
+	return func(ctx agent.CallbackContext) (*genai.Content, error) {
+		text := strings.TrimSpace(utils.ExtractContentText(ctx.UserContent()))
+		if text != "/profile" && !strings.HasPrefix(text, "/profile ") {
+			return nil, nil
+		}
+
+		profile, err := profiles.GetProfile(ctx, ctx.UserID())
+		if err != nil {
+			return nil, err
+		}
+		if profile == nil {
+			profile = &types.UserProfile{UserID: ctx.UserID()}
+		}
+
+		args := strings.TrimSpace(strings.TrimPrefix(text, "/profile"))
+		if args == "" {
+			return profileReply("当前的用户资料：", profile), nil
+		}
+
+		name, value, _ := strings.Cut(args, " ")
+		value = strings.TrimSpace(value)
+		field, ok := lookupProfileField(name)
+		if !ok {
+			return genai.NewContentFromText(fmt.Sprintf("未知的字段 %q。\n%s", name, profileUsage), genai.RoleModel), nil
+		}
+		if utf8.RuneCountInString(value) > field.maxRunes {
+			return genai.NewContentFromText(fmt.Sprintf("%s最多 %d 个字符。", field.label, field.maxRunes), genai.RoleModel), nil
+		}
+		if value != "" && field.validate != nil {
+			if err := field.validate(value); err != nil {
+				return genai.NewContentFromText(err.Error(), genai.RoleModel), nil
+			}
+		}
+
+		field.set(profile, value)
+		if err := profiles.SaveProfile(ctx, profile); err != nil {
+			return nil, err
+		}
+		return profileReply("用户资料已更新：", profile), nil
+	}
+}
+
+func lookupProfileField(name string) (profileField, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, field := range profileFields {
+		if field.name == name {
+			return field, true
+		}
+		for _, alias := range field.aliases {
+			if alias == name {
+				return field, true
+			}
+		}
+	}
+	return profileField{}, false
+}
+
+func profileReply(title string, profile *types.UserProfile) *genai.Content {
+	var b strings.Builder
+	b.WriteString(title)
+	for _, field := range profileFields {
+		value := field.get(profile)
+		if value == "" {
+			value = "（未设置）"
+		}
+		fmt.Fprintf(&b, "\n%s：%s", field.label, value)
+	}
+	b.WriteString("\n\n")
+	b.WriteString(profileUsage)
+	return genai.NewContentFromText(b.String(), genai.RoleModel)
+}
@@ -0,0 +1,116 @@
+package callback
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/session"
+	"google.golang.org/genai"
+
+	"github.com/easeaico/project-her/internal/utils"
+)
+
+// Session state keys of the rolling "story so far" summary. The pending keys
+// use the temp: prefix so they only live for the current invocation.
+const (
+	stateStorySoFar        = "StorySoFar"
+	stateStoryCoveredTurns = "StoryCoveredTurns"
+	stateStoryPending      = session.KeyPrefixTemp + "StoryPending"
+	stateStoryPendingTurns = session.KeyPrefixTemp + "StoryPendingTurns"
+)
+
+// StoryUpdater folds turns that left the context window into the running
+// story summary of a session.
+type StoryUpdater interface {
+	UpdateStory(ctx context.Context, previous, transcript string) (string, error)
+}
+
+// recordTrimmedTurns stores the dropped turns that the story summary does not
+// cover yet, for NewStorySoFarCallback to fold in once the reply is done.
+func recordTrimmedTurns(ctx agent.CallbackContext, dropped [][]*genai.Content) error {
+	covered, err := readIntState(ctx.State(), stateStoryCoveredTurns)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", stateStoryCoveredTurns, err)
+	}
+	if covered >= len(dropped) {
+		return nil
+	}
+
+	transcript := formatTranscript(dropped[covered:])
+	if err := ctx.State().Set(stateStoryPending, transcript); err != nil {
+		return fmt.Errorf("failed to set %s: %w", stateStoryPending, err)
+	}
+	if err := ctx.State().Set(stateStoryPendingTurns, len(dropped)); err != nil {
+		return fmt.Errorf("failed to set %s: %w", stateStoryPendingTurns, err)
+	}
+	return nil
+}
+
+// NewStorySoFarCallback updates the session's story summary with the turns
+// trimmed from this request. It runs after the reply, so summarization does
+// not delay the response; if it fails, the same turns are retried next time.
+func NewStorySoFarCallback(updater StoryUpdater) agent.AfterAgentCallback {
+	return func(ctx agent.CallbackContext) (*genai.Content, error) {
+		transcript, _ := readStringState(ctx.State(), stateStoryPending)
+		if strings.TrimSpace(transcript) == "" {
+			return nil, nil
+		}
+		turns, err := readIntState(ctx.State(), stateStoryPendingTurns)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", stateStoryPendingTurns, err)
+		}
+		previous, _ := readStringState(ctx.State(), stateStorySoFar)
+
+		story, err := updater.UpdateStory(ctx, previous, transcript)
+		if err != nil {
+			slog.Error("failed to update story so far", "session", ctx.SessionID(), "error", err.Error())
+			return nil, nil
+		}
+		if err := ctx.State().Set(stateStorySoFar, story); err != nil {
+			return nil, fmt.Errorf("failed to set %s: %w", stateStorySoFar, err)
+		}
+		if err := ctx.State().Set(stateStoryCoveredTurns, turns); err != nil {
+			return nil, fmt.Errorf("failed to set %s: %w", stateStoryCoveredTurns, err)
+		}
+		if err := ctx.State().Set(stateStoryPending, ""); err != nil {
+			return nil, fmt.Errorf("failed to set %s: %w", stateStoryPending, err)
+		}
+		slog.Info("story so far updated", "session", ctx.SessionID(), "covered_turns", turns, "story_tokens", utils.EstimateTokens(story))
+		return nil, nil
+	}
+}
+
+// formatTranscript renders turns as "user: ..." / "assistant: ..." lines,
+// skipping tool calls and empty messages.
+func formatTranscript(turns [][]*genai.Content) string {
+	var sb strings.Builder
+	for _, turn := range turns {
+		for _, content := range turn {
+			text := strings.TrimSpace(utils.ExtractContentText(content))
+			if text == "" {
+				continue
+			}
+			role := "user"
+			if content.Role == genai.RoleModel {
+				role = "assistant"
+			}
+			fmt.Fprintf(&sb, "%s: %s\n", role, text)
+		}
+	}
+	return sb.String()
+}
+
+func readStringState(state session.State, key string) (string, error) {
+	val, err := state.Get(key)
+	if err != nil {
+		return "", err
+	}
+	text, ok := val.(string)
+	if !ok {
+		return "", fmt.Errorf("state value for %s has unsupported type %T", key, val)
+	}
+	return text, nil
+}
@@ -0,0 +1,104 @@
+package callback
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/agent/llmagent"
+	"google.golang.org/adk/model"
+	"google.golang.org/adk/session"
+
+	"github.com/easeaico/project-her/internal/models"
+)
+
+// Session state keys holding the running token usage and cost of a conversation.
+const (
+	stateUsagePromptTokens     = "UsagePromptTokens"
+	stateUsageCompletionTokens = "UsageCompletionTokens"
+	stateUsageCostUSD          = "UsageCostUSD"
+)
+
+// NewUsageCallback accumulates token usage and estimated cost of every model
+// call into session state, so each conversation carries its running total.
+func NewUsageCallback() llmagent.AfterModelCallback {
+	return func(ctx agent.CallbackContext, resp *model.LLMResponse, respErr error) (*model.LLMResponse, error) {
+		if respErr != nil || resp == nil || resp.Partial || resp.UsageMetadata == nil {
+			return nil, nil
+		}
+		usage := resp.UsageMetadata
+
+		promptTokens, err := readIntState(ctx.State(), stateUsagePromptTokens)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", stateUsagePromptTokens, err)
+		}
+		completionTokens, err := readIntState(ctx.State(), stateUsageCompletionTokens)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", stateUsageCompletionTokens, err)
+		}
+		cost, err := readFloatState(ctx.State(), stateUsageCostUSD)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", stateUsageCostUSD, err)
+		}
+
+		turnCost, _ := resp.CustomMetadata[models.MetadataCostKey].(float64)
+		promptTokens += int(usage.PromptTokenCount)
+		completionTokens += int(usage.CandidatesTokenCount + usage.ThoughtsTokenCount)
+		cost += turnCost
+
+		if err := ctx.State().Set(stateUsagePromptTokens, promptTokens); err != nil {
+			return nil, fmt.Errorf("failed to set %s: %w", stateUsagePromptTokens, err)
+		}
+		if err := ctx.State().Set(stateUsageCompletionTokens, completionTokens); err != nil {
+			return nil, fmt.Errorf("failed to set %s: %w", stateUsageCompletionTokens, err)
+		}
+		if err := ctx.State().Set(stateUsageCostUSD, cost); err != nil {
+			return nil, fmt.Errorf("failed to set %s: %w", stateUsageCostUSD, err)
+		}
+
+		slog.Info("conversation usage",
+			"app", ctx.AppName(),
+			"user", ctx.UserID(),
+			"session", ctx.SessionID(),
+			"turn_cost_usd", turnCost,
+			"total_prompt_tokens", promptTokens,
+			"total_completion_tokens", completionTokens,
+			"total_cost_usd", cost,
+		)
+		return nil, nil
+	}
+}
+
+func readFloatState(state session.State, key string) (float64, error) {
+	val, err := state.Get(key)
+	if err != nil {
+		if errors.Is(err, session.ErrStateKeyNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	switch cast := val.(type) {
+	case float64:
+		return cast, nil
+	case float32:
+		return float64(cast), nil
+	case int:
+		return float64(cast), nil
+	case int64:
+		return float64(cast), nil
+	case json.Number:
+		return cast.Float64()
+	case string:
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(cast), 64)
+		if err != nil {
+			return 0, fmt.Errorf("state value for %s is not a number: %w", key, err)
+		}
+		return parsed, nil
+	default:
+		return 0, fmt.Errorf("state value for %s has unsupported type %T", key, val)
+	}
+}
@@ -3,21 +3,57 @@ package callback
 import (
 	"errors"
 	"fmt"
+	"log/slog"
 	"time"
 
 	"google.golang.org/adk/agent"
 	"google.golang.org/adk/session"
 	"google.golang.org/genai"
+
+	"github.com/easeaico/project-her/internal/types"
 )
 
 // EnsureUserStateCallback writes required user state fields for prompt injection.
-func EnsureUserStateCallback() agent.BeforeAgentCallback {
+// The user's profile, when profiles is set and the user has one, supplies the
+// name, the other User* fields and the time zone of Now; otherwise the user
+// is addressed by user ID.
+func EnsureUserStateCallback(profiles UserProfileRepo) agent.BeforeAgentCallback {
 	return func(ctx agent.CallbackContext) (*genai.Content, error) {
-		if err := ctx.State().Set("UserName", ctx.UserID()); err != nil {
-			return nil, fmt.Errorf("failed to set UserName: %w", err)
+		profile := &types.UserProfile{UserID: ctx.UserID()}
+		if profiles != nil {
+			stored, err := profiles.GetProfile(ctx, ctx.UserID())
+			if err != nil {
+				return nil, err
+			}
+			if stored != nil {
+				profile = stored
+			}
+		}
+
+		userName := profile.DisplayName
+		if userName == "" {
+			userName = ctx.UserID()
 		}
-		if err := ctx.State().Set("Now", time.Now().Format(time.RFC3339)); err != nil {
-			return nil, fmt.Errorf("failed to set Now: %w", err)
+		now := time.Now()
+		if profile.Timezone != "" {
+			if loc, err := time.LoadLocation(profile.Timezone); err == nil {
+				now = now.In(loc)
+			} else {
+				slog.Warn("ignoring invalid user timezone", "timezone", profile.Timezone, "error", err)
+			}
+		}
+
+		for key, value := range map[string]string{
+			"UserName":        userName,
+			"UserPronouns":    profile.Pronouns,
+			"UserDescription": profile.Description,
+			"UserLanguage":    profile.Language,
+			"UserPersona":     profile.Persona,
+			"Now":             now.Format(time.RFC3339),
+		} {
+			if err := ctx.State().Set(key, value); err != nil {
+				return nil, fmt.Errorf("failed to set %s: %w", key, err)
+			}
 		}
 		if err := ctx.State().Set("Location", "Unknown"); err != nil {
 			return nil, fmt.Errorf("failed to set Location: %w", err)
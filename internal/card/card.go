@@ -0,0 +1,403 @@
+// Package card 实现 Character Card V2/V3 格式的导入与导出。
+//
+// 支持 JSON 角色卡与 PNG 角色卡：PNG 卡将 base64 编码的卡片 JSON 写入 tEXt 块，
+// V2 使用关键字 chara，V3 使用关键字 ccv3。导入时优先读取 ccv3，同时兼容
+// 没有 spec 字段的 V1（TavernAI / Pygmalion）卡片。
+package card
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/easeaico/project-her/internal/types"
+)
+
+// 卡片规范名称与版本。
+const (
+	SpecV2        = "chara_card_v2"
+	SpecV3        = "chara_card_v3"
+	specVersionV2 = "2.0"
+	specVersionV3 = "3.0"
+)
+
+// 导出格式。
+const (
+	FormatJSON = "json"
+	FormatPNG  = "png"
+)
+
+// Repo 定义导入导出所需的角色持久化接口，实现位于 internal/storage。
+type Repo interface {
+	// Create 保存角色与头像，返回新角色的 ID。
+	Create(ctx context.Context, character *types.Character, avatar []byte) (int, error)
+
+	GetByID(ctx context.Context, id int) (*types.Character, error)
+
+	// GetAvatar 返回角色保存的头像，没有头像时返回 nil。
+	GetAvatar(ctx context.Context, id int) ([]byte, error)
+}
+
+// cardFile 为 V2/V3 卡片的顶层结构。V1 卡片的字段直接位于顶层。
+type cardFile struct {
+	Spec        string    `json:"spec,omitempty"`
+	SpecVersion string    `json:"spec_version,omitempty"`
+	Data        *cardData `json:"data,omitempty"`
+
+	// V1（TavernAI）字段。
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	Personality string `json:"personality,omitempty"`
+	Scenario    string `json:"scenario,omitempty"`
+	FirstMes    string `json:"first_mes,omitempty"`
+	MesExample  string `json:"mes_example,omitempty"`
+
+	// V1（Pygmalion）字段。
+	CharName        string `json:"char_name,omitempty"`
+	CharPersona     string `json:"char_persona,omitempty"`
+	WorldScenario   string `json:"world_scenario,omitempty"`
+	CharGreeting    string `json:"char_greeting,omitempty"`
+	ExampleDialogue string `json:"example_dialogue,omitempty"`
+}
+
+// cardData 为 V2/V3 卡片的 data 字段，V3 在 V2 的基础上增加 assets 等字段。
+type cardData struct {
+	Name                    string          `json:"name"`
+	Description             string          `json:"description"`
+	Personality             string          `json:"personality"`
+	Scenario                string          `json:"scenario"`
+	FirstMes                string          `json:"first_mes"`
+	MesExample              string          `json:"mes_example"`
+	CreatorNotes            string          `json:"creator_notes"`
+	SystemPrompt            string          `json:"system_prompt"`
+	PostHistoryInstructions string          `json:"post_history_instructions"`
+	AlternateGreetings      []string        `json:"alternate_greetings"`
+	CharacterBook           json.RawMessage `json:"character_book,omitempty"`
+	Tags                    []string        `json:"tags"`
+	Creator                 string          `json:"creator"`
+	CharacterVersion        string          `json:"character_version"`
+	Extensions              json.RawMessage `json:"extensions"`
+
+	// V3 字段。
+	Assets             []cardAsset `json:"assets,omitempty"`
+	GroupOnlyGreetings []string    `json:"group_only_greetings,omitempty"`
+	CreationDate       int64       `json:"creation_date,omitempty"`
+	ModificationDate   int64       `json:"modification_date,omitempty"`
+}
+
+// cardAsset 为 V3 卡片的资源项；uri 为 ccdefault: 时指向 PNG 卡本身。
+type cardAsset struct {
+	Type string `json:"type"`
+	URI  string `json:"uri"`
+	Name string `json:"name"`
+	Ext  string `json:"ext"`
+}
+
+// Decode 解析 JSON 或 PNG 角色卡，返回角色与头像。PNG 卡的头像为去除卡片数据块后的图片，
+// JSON 卡的头像取自 V3 assets 中以 data URI 内嵌的 icon。
+func Decode(data []byte) (*types.Character, []byte, error) {
+	if !isPNG(data) {
+		return decodeJSON(data)
+	}
+
+	chunks, err := readTextChunks(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	raw, ok := chunks[keywordV3]
+	if !ok {
+		raw, ok = chunks[keywordV2]
+	}
+	if !ok {
+		return nil, nil, errors.New("png has no character card data")
+	}
+	payload, err := decodePayload(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	character, _, err := decodeJSON(payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	avatar, err := stripTextChunks(data, keywordV2, keywordV3)
+	if err != nil {
+		return nil, nil, err
+	}
+	return character, avatar, nil
+}
+
+// decodePayload 解码 PNG 文本块中的卡片数据，通常为 base64，少数工具直接写入 JSON。
+func decodePayload(raw string) ([]byte, error) {
+	raw = strings.TrimSpace(raw)
+	if strings.HasPrefix(raw, "{") {
+		return []byte(raw), nil
+	}
+	payload, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil {
+		payload, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(raw, "="))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode card payload: %w", err)
+	}
+	return payload, nil
+}
+
+func decodeJSON(raw []byte) (*types.Character, []byte, error) {
+	var file cardFile
+	if err := json.Unmarshal(bytes.TrimPrefix(raw, []byte("\xef\xbb\xbf")), &file); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse character card: %w", err)
+	}
+
+	data := file.Data
+	if data == nil {
+		data = file.v1Data()
+	}
+	if strings.TrimSpace(data.Name) == "" {
+		return nil, nil, errors.New("character card has no name")
+	}
+
+	character := &types.Character{
+		Name:                    strings.TrimSpace(data.Name),
+		Description:             data.Description,
+		Personality:             data.Personality,
+		Scenario:                data.Scenario,
+		FirstMessage:            data.FirstMes,
+		MessageExample:          data.MesExample,
+		SystemPrompt:            data.SystemPrompt,
+		PostHistoryInstructions: data.PostHistoryInstructions,
+		AlternateGreetings:      nonEmpty(data.AlternateGreetings),
+		Tags:                    nonEmpty(data.Tags),
+		Creator:                 data.Creator,
+		CreatorNotes:            data.CreatorNotes,
+		CharacterVersion:        data.CharacterVersion,
+		CharacterBook:           nullToEmpty(data.CharacterBook),
+		Extensions:              nullToEmpty(data.Extensions),
+	}
+	return character, data.iconAvatar(), nil
+}
+
+// v1Data 将 V1 顶层字段转换为 data 结构，Pygmalion 字段仅在 TavernAI 字段为空时使用。
+func (f *cardFile) v1Data() *cardData {
+	return &cardData{
+		Name:        firstNonEmpty(f.Name, f.CharName),
+		Description: firstNonEmpty(f.Description, f.CharPersona),
+		Personality: f.Personality,
+		Scenario:    firstNonEmpty(f.Scenario, f.WorldScenario),
+		FirstMes:    firstNonEmpty(f.FirstMes, f.CharGreeting),
+		MesExample:  firstNonEmpty(f.MesExample, f.ExampleDialogue),
+	}
+}
+
+// iconAvatar 返回以 data URI 内嵌的主 icon 资源。
+func (d *cardData) iconAvatar() []byte {
+	for _, asset := range d.Assets {
+		if asset.Type != "icon" || !strings.HasPrefix(asset.URI, "data:") {
+			continue
+		}
+		_, encoded, ok := strings.Cut(asset.URI, ";base64,")
+		if !ok {
+			continue
+		}
+		avatar, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			continue
+		}
+		return avatar
+	}
+	return nil
+}
+
+// EncodeJSON 将角色导出为指定规范的 JSON 角色卡。V3 卡会以 data URI 内嵌头像。
+func EncodeJSON(character *types.Character, avatar []byte, spec string) ([]byte, error) {
+	file, err := newCardFile(character, spec)
+	if err != nil {
+		return nil, err
+	}
+	if spec == SpecV3 && len(avatar) > 0 {
+		mime := http.DetectContentType(avatar)
+		file.Data.Assets = []cardAsset{{
+			Type: "icon",
+			URI:  "data:" + mime + ";base64," + base64.StdEncoding.EncodeToString(avatar),
+			Name: "main",
+			Ext:  strings.TrimPrefix(mime, "image/"),
+		}}
+	}
+	return json.MarshalIndent(file, "", "  ")
+}
+
+// EncodePNG 将角色导出为 PNG 角色卡，同时写入 chara（V2）与 ccv3（V3）数据块，
+// 以兼容只支持 V2 的工具。头像不是 PNG 时会转换格式，没有可用头像时使用占位图。
+func EncodePNG(character *types.Character, avatar []byte) ([]byte, error) {
+	v2, err := newCardFile(character, SpecV2)
+	if err != nil {
+		return nil, err
+	}
+	v3, err := newCardFile(character, SpecV3)
+	if err != nil {
+		return nil, err
+	}
+	v3.Data.Assets = []cardAsset{{Type: "icon", URI: "ccdefault:", Name: "main", Ext: "png"}}
+
+	image, err := avatarPNG(avatar)
+	if err != nil {
+		return nil, err
+	}
+	image, err = stripTextChunks(image, keywordV2, keywordV3)
+	if err != nil {
+		return nil, err
+	}
+
+	chunks := make(map[string][]byte, 2)
+	for keyword, file := range map[string]*cardFile{keywordV2: v2, keywordV3: v3} {
+		payload, err := json.Marshal(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s card: %w", file.Spec, err)
+		}
+		chunks[keyword] = []byte(base64.StdEncoding.EncodeToString(payload))
+	}
+	return insertTextChunks(image, []string{keywordV2, keywordV3}, chunks)
+}
+
+// newCardFile 按规范组装卡片结构，必填的数组与对象字段以空值输出而非 null。
+func newCardFile(character *types.Character, spec string) (*cardFile, error) {
+	file := &cardFile{Spec: spec}
+	switch spec {
+	case SpecV2:
+		file.SpecVersion = specVersionV2
+	case SpecV3:
+		file.SpecVersion = specVersionV3
+	default:
+		return nil, fmt.Errorf("unsupported card spec %q", spec)
+	}
+
+	file.Data = &cardData{
+		Name:                    character.Name,
+		Description:             character.Description,
+		Personality:             character.Personality,
+		Scenario:                character.Scenario,
+		FirstMes:                character.FirstMessage,
+		MesExample:              character.MessageExample,
+		CreatorNotes:            character.CreatorNotes,
+		SystemPrompt:            character.SystemPrompt,
+		PostHistoryInstructions: character.PostHistoryInstructions,
+		AlternateGreetings:      orEmpty(character.AlternateGreetings),
+		CharacterBook:           character.CharacterBook,
+		Tags:                    orEmpty(character.Tags),
+		Creator:                 character.Creator,
+		CharacterVersion:        character.CharacterVersion,
+		Extensions:              character.Extensions,
+	}
+	if len(file.Data.Extensions) == 0 {
+		file.Data.Extensions = json.RawMessage("{}")
+	}
+	if spec == SpecV3 {
+		if !character.CreatedAt.IsZero() {
+			file.Data.CreationDate = character.CreatedAt.Unix()
+		}
+		if !character.UpdatedAt.IsZero() {
+			file.Data.ModificationDate = character.UpdatedAt.Unix()
+		}
+	}
+	return file, nil
+}
+
+// Import 解析角色卡并保存为新角色。filename 用作角色的 avatar 名称。
+func Import(ctx context.Context, repo Repo, data []byte, filename string) (*types.Character, error) {
+	character, avatar, err := Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(avatar) > 0 {
+		character.Avatar = avatarName(filename, avatar)
+	}
+	id, err := repo.Create(ctx, character, avatar)
+	if err != nil {
+		return nil, err
+	}
+	character.ID = id
+	return character, nil
+}
+
+// Export 将角色导出为指定格式的角色卡；spec 仅对 JSON 格式生效。
+func Export(ctx context.Context, repo Repo, id int, format, spec string) ([]byte, error) {
+	character, err := repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	avatar, err := repo.GetAvatar(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case FormatJSON:
+		return EncodeJSON(character, avatar, spec)
+	case FormatPNG:
+		return EncodePNG(character, avatar)
+	default:
+		return nil, fmt.Errorf("unsupported card format %q", format)
+	}
+}
+
+// avatarExtensions 为可识别的头像图片类型对应的扩展名。
+var avatarExtensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+	"image/bmp":  ".bmp",
+}
+
+// avatarName 返回保存在 avatar 字段中的文件名。非 PNG 文件名按图片内容改用对应的扩展名，
+// 无法识别的内容保留原扩展名。VARCHAR(255) 按字符计长，
+// 因此按 rune 截断并保留末尾的扩展名，避免切断多字节字符导致写入失败。
+func avatarName(filename string, avatar []byte) string {
+	name := strings.ToValidUTF8(filepath.Base(filename), "")
+	if ext := filepath.Ext(name); !strings.EqualFold(ext, ".png") {
+		if detected, ok := avatarExtensions[http.DetectContentType(avatar)]; ok {
+			name = strings.TrimSuffix(name, ext) + detected
+		}
+	}
+	if runes := []rune(name); len(runes) > 255 {
+		name = string(runes[len(runes)-255:])
+	}
+	return name
+}
+
+func nonEmpty(values []string) []string {
+	var out []string
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			out = append(out, value)
+		}
+	}
+	return out
+}
+
+func orEmpty(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+func nullToEmpty(raw json.RawMessage) json.RawMessage {
+	if len(raw) == 0 || bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+		return nil
+	}
+	return raw
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,145 @@
+package card
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/easeaico/project-her/internal/types"
+)
+
+func sampleCharacter() *types.Character {
+	return &types.Character{
+		Name:                    "小雪",
+		Description:             "{{char}} 是 {{user}} 的青梅竹马。",
+		FirstMessage:            "*推门进来* 你来啦",
+		PostHistoryInstructions: "[保持害羞的语气]",
+		AlternateGreetings:      []string{"早呀"},
+		Tags:                    []string{"青梅竹马", "校园"},
+		Creator:                 "ava",
+		CreatorNotes:            "适合慢热的故事",
+		CharacterVersion:        "1.2",
+		CharacterBook:           json.RawMessage(`{"entries":[{"keys":["猫"],"content":"小雪养了一只猫"}]}`),
+		Extensions:              json.RawMessage(`{"talkativeness":"0.5"}`),
+	}
+}
+
+func solidPNG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 2, 3))); err != nil {
+		t.Fatalf("failed to encode png: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestPNGCardRoundTrip(t *testing.T) {
+	avatar := solidPNG(t)
+	data, err := EncodePNG(sampleCharacter(), avatar)
+	if err != nil {
+		t.Fatalf("failed to encode card: %v", err)
+	}
+	if _, err := png.Decode(bytes.NewReader(data)); err != nil {
+		t.Fatalf("expected a valid png, got %v", err)
+	}
+
+	chunks, err := readTextChunks(data)
+	if err != nil {
+		t.Fatalf("failed to read chunks: %v", err)
+	}
+	payload, _ := base64.StdEncoding.DecodeString(chunks[keywordV2])
+	if !strings.Contains(string(payload), `"spec":"chara_card_v2"`) || chunks[keywordV3] == "" {
+		t.Fatalf("expected both chara and ccv3 chunks, got %v", chunks)
+	}
+
+	character, gotAvatar, err := Decode(data)
+	if err != nil {
+		t.Fatalf("failed to decode card: %v", err)
+	}
+	want := sampleCharacter()
+	if character.Name != want.Name || character.Description != want.Description || character.PostHistoryInstructions != want.PostHistoryInstructions {
+		t.Fatalf("unexpected character %+v", character)
+	}
+	if len(character.AlternateGreetings) != 1 || len(character.Tags) != 2 || character.CharacterVersion != "1.2" {
+		t.Fatalf("expected card metadata to survive, got %+v", character)
+	}
+	if !bytes.Contains(character.CharacterBook, []byte("小雪养了一只猫")) || !bytes.Contains(character.Extensions, []byte("talkativeness")) {
+		t.Fatalf("expected character_book and extensions to be kept, got %s / %s", character.CharacterBook, character.Extensions)
+	}
+	if !bytes.Equal(gotAvatar, avatar) {
+		t.Fatalf("expected avatar without card chunks to match the original image")
+	}
+}
+
+func TestDecodePrefersV3ChunkAndAcceptsMixedCaseKeywords(t *testing.T) {
+	v2 := base64.StdEncoding.EncodeToString([]byte(`{"spec":"chara_card_v2","spec_version":"2.0","data":{"name":"旧版"}}`))
+	v3 := base64.StdEncoding.EncodeToString([]byte(`{"spec":"chara_card_v3","spec_version":"3.0","data":{"name":"新版","alternate_greetings":null,"tags":["", "猫娘"]}}`))
+	data, err := insertTextChunks(solidPNG(t), []string{"Chara", "CCV3"}, map[string][]byte{"Chara": []byte(v2), "CCV3": []byte(v3)})
+	if err != nil {
+		t.Fatalf("failed to build card: %v", err)
+	}
+
+	character, _, err := Decode(data)
+	if err != nil {
+		t.Fatalf("failed to decode card: %v", err)
+	}
+	if character.Name != "新版" || len(character.Tags) != 1 || character.AlternateGreetings != nil {
+		t.Fatalf("expected the ccv3 chunk to win, got %+v", character)
+	}
+}
+
+func TestDecodeJSONCards(t *testing.T) {
+	// Pygmalion 风格的 V1 卡片没有 spec 字段。
+	character, avatar, err := Decode([]byte(`{"char_name":"Mia","char_persona":"活泼","char_greeting":"嗨！","example_dialogue":"<START>"}`))
+	if err != nil {
+		t.Fatalf("failed to decode v1 card: %v", err)
+	}
+	if character.Name != "Mia" || character.Description != "活泼" || character.FirstMessage != "嗨！" || avatar != nil {
+		t.Fatalf("unexpected v1 character %+v", character)
+	}
+
+	exported, err := EncodeJSON(sampleCharacter(), solidPNG(t), SpecV3)
+	if err != nil {
+		t.Fatalf("failed to encode v3 card: %v", err)
+	}
+	if !bytes.Contains(exported, []byte(`"spec": "chara_card_v3"`)) || !bytes.Contains(exported, []byte("data:image/png;base64,")) {
+		t.Fatalf("expected v3 card with embedded avatar, got %s", exported)
+	}
+	character, avatar, err = Decode(exported)
+	if err != nil || character.Creator != "ava" || !isPNG(avatar) {
+		t.Fatalf("expected v3 json card to round trip, got %+v, err %v", character, err)
+	}
+
+	if _, _, err := Decode([]byte(`{"spec":"chara_card_v2","data":{"name":" "}}`)); err == nil {
+		t.Fatalf("expected card without a name to fail")
+	}
+}
+
+func TestAvatarNameTruncatesByRune(t *testing.T) {
+	name := avatarName(strings.Repeat("雪", 300)+".png", nil)
+	if !utf8.ValidString(name) || utf8.RuneCountInString(name) != 255 || !strings.HasSuffix(name, "雪.png") {
+		t.Fatalf("expected 255 valid runes ending with the extension, got %d runes", utf8.RuneCountInString(name))
+	}
+}
+
+func TestAvatarNameOnlyUsesKnownImageExtensions(t *testing.T) {
+	jpeg := []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00")
+	for _, tc := range []struct {
+		filename string
+		avatar   []byte
+		want     string
+	}{
+		{"card.json", jpeg, "card.jpg"},
+		{"card.json", []byte("plain text"), "card.json"},
+		{"card.webp", []byte{0x00, 0x01, 0x02}, "card.webp"},
+	} {
+		if got := avatarName(tc.filename, tc.avatar); got != tc.want {
+			t.Fatalf("avatarName(%q): expected %q, got %q", tc.filename, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package card
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // 注册 GIF 解码器，用于转换头像格式
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// PNG 文本块关键字，读取时不区分大小写。
+const (
+	keywordV2 = "chara"
+	keywordV3 = "ccv3"
+)
+
+// 占位头像尺寸，与常见角色卡的 2:3 比例一致。
+const (
+	placeholderWidth  = 400
+	placeholderHeight = 600
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+type pngChunk struct {
+	typ  string
+	data []byte
+}
+
+func isPNG(data []byte) bool {
+	return bytes.HasPrefix(data, pngSignature)
+}
+
+// readChunks 按顺序拆分 PNG 数据块，不校验 CRC。
+func readChunks(data []byte) ([]pngChunk, error) {
+	if !isPNG(data) {
+		return nil, errors.New("not a png image")
+	}
+	var chunks []pngChunk
+	for rest := data[len(pngSignature):]; len(rest) > 0; {
+		if len(rest) < 12 {
+			return nil, errors.New("truncated png chunk")
+		}
+		length := binary.BigEndian.Uint32(rest[:4])
+		if uint64(length) > uint64(len(rest)-12) {
+			return nil, errors.New("truncated png chunk")
+		}
+		chunk := pngChunk{typ: string(rest[4:8]), data: rest[8 : 8+length]}
+		chunks = append(chunks, chunk)
+		rest = rest[12+length:]
+		if chunk.typ == "IEND" {
+			break
+		}
+	}
+	return chunks, nil
+}
+
+func writeChunks(chunks []pngChunk) []byte {
+	var buf bytes.Buffer
+	buf.Write(pngSignature)
+	for _, chunk := range chunks {
+		var header [8]byte
+		binary.BigEndian.PutUint32(header[:4], uint32(len(chunk.data)))
+		copy(header[4:], chunk.typ)
+		buf.Write(header[:])
+		buf.Write(chunk.data)
+		crc := crc32.NewIEEE()
+		crc.Write(header[4:])
+		crc.Write(chunk.data)
+		_ = binary.Write(&buf, binary.BigEndian, crc.Sum32())
+	}
+	return buf.Bytes()
+}
+
+// readTextChunks 读取 tEXt、zTXt 与 iTXt 文本块，返回以小写关键字为键的文本。
+func readTextChunks(data []byte) (map[string]string, error) {
+	chunks, err := readChunks(data)
+	if err != nil {
+		return nil, err
+	}
+	texts := make(map[string]string)
+	for _, chunk := range chunks {
+		keyword, text, err := parseTextChunk(chunk)
+		if err != nil {
+			slog.Warn("skipping unreadable png text chunk", "type", chunk.typ, "error", err)
+			continue
+		}
+		if keyword != "" {
+			texts[keyword] = text
+		}
+	}
+	return texts, nil
+}
+
+// parseTextChunk 解析文本块；非文本块返回空关键字。
+func parseTextChunk(chunk pngChunk) (string, string, error) {
+	switch chunk.typ {
+	case "tEXt", "zTXt", "iTXt":
+	default:
+		return "", "", nil
+	}
+	keyword, rest, ok := bytes.Cut(chunk.data, []byte{0})
+	if !ok {
+		return "", "", errors.New("missing keyword separator")
+	}
+	key := strings.ToLower(string(keyword))
+
+	switch chunk.typ {
+	case "tEXt":
+		return key, string(rest), nil
+	case "zTXt":
+		if len(rest) < 1 {
+			return "", "", errors.New("missing compression method")
+		}
+		text, err := inflate(rest[1:])
+		return key, text, err
+	default:
+		// iTXt: 压缩标志、压缩方法、语言标签\0、翻译关键字\0、文本。
+		if len(rest) < 2 {
+			return "", "", errors.New("missing compression flags")
+		}
+		compressed := rest[0] == 1
+		parts := bytes.SplitN(rest[2:], []byte{0}, 3)
+		if len(parts) != 3 {
+			return "", "", errors.New("malformed itxt chunk")
+		}
+		if compressed {
+			text, err := inflate(parts[2])
+			return key, text, err
+		}
+		return key, string(parts[2]), nil
+	}
+}
+
+func inflate(data []byte) (string, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	text, err := io.ReadAll(r)
+	return string(text), err
+}
+
+// stripTextChunks 移除关键字（不区分大小写）匹配的文本块，其余数据块原样保留。
+func stripTextChunks(data []byte, keywords ...string) ([]byte, error) {
+	chunks, err := readChunks(data)
+	if err != nil {
+		return nil, err
+	}
+	kept := chunks[:0:0]
+	for _, chunk := range chunks {
+		keyword, _, _ := parseTextChunk(chunk)
+		if keyword != "" && containsFold(keywords, keyword) {
+			continue
+		}
+		kept = append(kept, chunk)
+	}
+	return writeChunks(kept), nil
+}
+
+// insertTextChunks 在 IEND 之前按 order 顺序插入 tEXt 块。
+func insertTextChunks(data []byte, order []string, texts map[string][]byte) ([]byte, error) {
+	chunks, err := readChunks(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(chunks) == 0 || chunks[len(chunks)-1].typ != "IEND" {
+		return nil, errors.New("png has no IEND chunk")
+	}
+	out := make([]pngChunk, 0, len(chunks)+len(order))
+	out = append(out, chunks[:len(chunks)-1]...)
+	for _, keyword := range order {
+		payload := append([]byte(keyword+"\x00"), texts[keyword]...)
+		out = append(out, pngChunk{typ: "tEXt", data: payload})
+	}
+	out = append(out, chunks[len(chunks)-1])
+	return writeChunks(out), nil
+}
+
+// avatarPNG 返回 PNG 格式的头像：PNG 原样返回，JPEG/GIF 转换为 PNG，
+// 缺失或无法解码时生成占位图。
+func avatarPNG(avatar []byte) ([]byte, error) {
+	if isPNG(avatar) {
+		return avatar, nil
+	}
+	var img image.Image
+	if len(avatar) > 0 {
+		decoded, format, err := image.Decode(bytes.NewReader(avatar))
+		if err != nil {
+			slog.Warn("failed to decode avatar, using placeholder", "error", err)
+		} else {
+			slog.Info("converting avatar to png", "format", format)
+			img = decoded
+		}
+	}
+	if img == nil {
+		placeholder := image.NewRGBA(image.Rect(0, 0, placeholderWidth, placeholderHeight))
+		draw.Draw(placeholder, placeholder.Bounds(), &image.Uniform{C: color.RGBA{R: 0xe8, G: 0xe0, B: 0xf0, A: 0xff}}, image.Point{}, draw.Src)
+		img = placeholder
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode avatar: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func containsFold(values []string, target string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, target) {
+			return true
+		}
+	}
+	return false
+}
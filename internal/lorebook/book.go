@@ -0,0 +1,92 @@
+package lorebook
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/easeaico/project-her/internal/types"
+)
+
+// stDepthPosition 为 SillyTavern extensions.position 中表示“按深度插入”的取值。
+const stDepthPosition = 4
+
+// characterBook 为 Character Card V2/V3 中 character_book 的结构。
+type characterBook struct {
+	Entries []bookEntry `json:"entries"`
+}
+
+type bookEntry struct {
+	Keys           []string       `json:"keys"`
+	SecondaryKeys  []string       `json:"secondary_keys"`
+	Content        string         `json:"content"`
+	Enabled        *bool          `json:"enabled"`
+	InsertionOrder int            `json:"insertion_order"`
+	CaseSensitive  *bool          `json:"case_sensitive"`
+	Name           string         `json:"name"`
+	Comment        string         `json:"comment"`
+	Selective      *bool          `json:"selective"`
+	Constant       bool           `json:"constant"`
+	Extensions     bookExtensions `json:"extensions"`
+}
+
+// bookExtensions 为 SillyTavern 写入条目 extensions 的常用字段。
+type bookExtensions struct {
+	Position         *int  `json:"position"`
+	Depth            *int  `json:"depth"`
+	Probability      *int  `json:"probability"`
+	UseProbability   *bool `json:"useProbability"`
+	ScanDepth        *int  `json:"scan_depth"`
+	PreventRecursion bool  `json:"prevent_recursion"`
+	ExcludeRecursion bool  `json:"exclude_recursion"`
+}
+
+// FromCharacterBook 将角色卡内嵌的 character_book 转换为条目，跳过未启用的条目。
+func FromCharacterBook(raw json.RawMessage) ([]types.LoreEntry, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	var book characterBook
+	if err := json.Unmarshal(raw, &book); err != nil {
+		return nil, fmt.Errorf("failed to parse character_book: %w", err)
+	}
+
+	entries := make([]types.LoreEntry, 0, len(book.Entries))
+	for _, e := range book.Entries {
+		if e.Enabled != nil && !*e.Enabled {
+			continue
+		}
+		entry := types.LoreEntry{
+			Name:             e.Name,
+			Keys:             e.Keys,
+			Content:          e.Content,
+			Constant:         e.Constant,
+			CaseSensitive:    e.CaseSensitive != nil && *e.CaseSensitive,
+			Order:            e.InsertionOrder,
+			PreventRecursion: e.Extensions.PreventRecursion,
+			ExcludeRecursion: e.Extensions.ExcludeRecursion,
+		}
+		if entry.Name == "" {
+			entry.Name = e.Comment
+		}
+		// 旧版卡片不写 selective，有次要关键字即视为需要同时命中。
+		if e.Selective == nil || *e.Selective {
+			entry.SecondaryKeys = e.SecondaryKeys
+		}
+		ext := e.Extensions
+		if ext.Position != nil && *ext.Position == stDepthPosition && ext.Depth != nil {
+			entry.Depth = ext.Depth
+		}
+		if ext.Probability != nil && (ext.UseProbability == nil || *ext.UseProbability) {
+			entry.Probability = *ext.Probability
+			if entry.Probability <= 0 {
+				// 概率为 0 的条目永远不会插入。
+				continue
+			}
+		}
+		if ext.ScanDepth != nil {
+			entry.ScanDepth = *ext.ScanDepth
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
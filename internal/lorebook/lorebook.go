@@ -0,0 +1,252 @@
+// Package lorebook 实现类似 SillyTavern 的世界书（World Info）引擎。
+//
+// 每轮对话扫描最近的消息，关键字或正则命中的条目（以及常驻条目）按概率激活；
+// 激活条目的内容可以递归触发其他条目。最终条目按优先级装入 token 预算，
+// 再按插入顺序输出：未设置深度的条目进入提示词的 lore 段落，设置深度的条目插入对话历史。
+package lorebook
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/easeaico/project-her/internal/types"
+	"github.com/easeaico/project-her/internal/utils"
+)
+
+// Repo 定义世界书条目的持久化接口，实现位于 internal/storage。
+type Repo interface {
+	// ListEntries 返回角色启用的条目以及全局条目。
+	ListEntries(ctx context.Context, characterID int) ([]types.LoreEntry, error)
+}
+
+// Options 控制一次扫描。
+type Options struct {
+	// ScanDepth 为默认扫描的最近消息条数，0 表示扫描全部传入的消息。
+	ScanDepth int
+	// MaxTokens 为激活条目的总 token 预算，0 表示不限制。
+	MaxTokens int
+	// MaxRecursion 为递归扫描的最大轮数，0 表示不递归。
+	MaxRecursion int
+	// Roll 返回 [0, 100) 的随机数，用于概率判定；为空时使用 math/rand。
+	Roll func() int
+}
+
+// Result 为激活的条目，均已按 Order 升序排列。
+type Result struct {
+	// Prompt 为插入 lore 段落的条目。
+	Prompt []types.LoreEntry
+	// Depth 为插入对话历史的条目。
+	Depth []types.LoreEntry
+}
+
+// Activate 用 messages（按时间顺序，最新的在最后）扫描条目并返回激活结果。
+func Activate(entries []types.LoreEntry, messages []string, opts Options) Result {
+	roll := opts.Roll
+	if roll == nil {
+		roll = func() int { return rand.IntN(100) }
+	}
+
+	matchers := make([]*matcher, len(entries))
+	for i := range entries {
+		matchers[i] = newMatcher(entries[i])
+	}
+
+	activated := make([]bool, len(entries))
+	decided := make([]bool, len(entries))
+	var order []int
+
+	// try 判定条目是否激活；概率判定每轮对话只进行一次。
+	try := func(i int) bool {
+		if decided[i] {
+			return false
+		}
+		decided[i] = true
+		if p := entries[i].Probability; p > 0 && p < 100 && roll() >= p {
+			return false
+		}
+		activated[i] = true
+		order = append(order, i)
+		return true
+	}
+
+	var recursion strings.Builder
+	for i, entry := range entries {
+		if entry.Constant {
+			if try(i) && !entry.PreventRecursion {
+				recursion.WriteString(entry.Content + "\n")
+			}
+			continue
+		}
+		text := scanText(messages, entry.ScanDepth, opts.ScanDepth)
+		if matchers[i].match(text) && try(i) && !entry.PreventRecursion {
+			recursion.WriteString(entry.Content + "\n")
+		}
+	}
+
+	for step := 0; step < opts.MaxRecursion && recursion.Len() > 0; step++ {
+		buffer := recursion.String()
+		recursion.Reset()
+		for i, entry := range entries {
+			if decided[i] || entry.ExcludeRecursion || !matchers[i].match(buffer) {
+				continue
+			}
+			if try(i) && !entry.PreventRecursion {
+				recursion.WriteString(entry.Content + "\n")
+			}
+		}
+	}
+
+	return budget(entries, order, opts.MaxTokens)
+}
+
+// budget 先放入常驻条目，再按 Order 降序放入其余条目，超出预算的条目整体跳过。
+func budget(entries []types.LoreEntry, activated []int, maxTokens int) Result {
+	slices.SortStableFunc(activated, func(a, b int) int {
+		if entries[a].Constant != entries[b].Constant {
+			if entries[a].Constant {
+				return -1
+			}
+			return 1
+		}
+		return entries[b].Order - entries[a].Order
+	})
+
+	var kept []int
+	used := 0
+	for _, i := range activated {
+		cost := utils.EstimateTokens(entries[i].Content)
+		if maxTokens > 0 && used+cost > maxTokens {
+			slog.Info("lorebook entry skipped by token budget", "entry", entryLabel(entries[i]), "tokens", cost, "budget", maxTokens)
+			continue
+		}
+		used += cost
+		kept = append(kept, i)
+	}
+	slices.SortStableFunc(kept, func(a, b int) int {
+		return entries[a].Order - entries[b].Order
+	})
+
+	var result Result
+	for _, i := range kept {
+		if entries[i].Depth != nil {
+			result.Depth = append(result.Depth, entries[i])
+		} else {
+			result.Prompt = append(result.Prompt, entries[i])
+		}
+	}
+	return result
+}
+
+// scanText 拼接最近的 depth 条消息；条目未指定深度时使用默认深度。
+func scanText(messages []string, entryDepth, defaultDepth int) string {
+	depth := defaultDepth
+	if entryDepth > 0 {
+		depth = entryDepth
+	}
+	if depth > 0 && len(messages) > depth {
+		messages = messages[len(messages)-depth:]
+	}
+	return strings.Join(messages, "\n")
+}
+
+type matcher struct {
+	primary   []func(string) bool
+	secondary []func(string) bool
+}
+
+func newMatcher(entry types.LoreEntry) *matcher {
+	return &matcher{
+		primary:   compileKeys(entry, entry.Keys),
+		secondary: compileKeys(entry, entry.SecondaryKeys),
+	}
+}
+
+// match 要求任一主关键字命中；设置了次要关键字时，还需任一次要关键字命中。
+func (m *matcher) match(text string) bool {
+	if text == "" || !anyMatch(m.primary, text) {
+		return false
+	}
+	return len(m.secondary) == 0 || anyMatch(m.secondary, text)
+}
+
+func anyMatch(keys []func(string) bool, text string) bool {
+	for _, key := range keys {
+		if key(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// compileKeys 将关键字编译为匹配函数。/pattern/flags 形式的关键字为正则表达式，
+// 支持 i（忽略大小写）、m、s 标志；无效的正则会被忽略并记录日志。
+func compileKeys(entry types.LoreEntry, keys []string) []func(string) bool {
+	var out []func(string) bool
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		if re, ok := parseRegexKey(key); ok {
+			if re == nil {
+				slog.Warn("ignoring invalid lorebook regex key", "entry", entryLabel(entry), "key", key)
+				continue
+			}
+			out = append(out, re.MatchString)
+			continue
+		}
+		if entry.CaseSensitive {
+			out = append(out, func(text string) bool { return strings.Contains(text, key) })
+			continue
+		}
+		lower := strings.ToLower(key)
+		out = append(out, func(text string) bool { return strings.Contains(strings.ToLower(text), lower) })
+	}
+	return out
+}
+
+// parseRegexKey 解析 /pattern/flags 形式的关键字。ok 为 false 表示不是正则关键字；
+// 正则无效时返回 nil。
+func parseRegexKey(key string) (*regexp.Regexp, bool) {
+	if len(key) < 3 || key[0] != '/' {
+		return nil, false
+	}
+	end := strings.LastIndex(key, "/")
+	if end <= 0 {
+		return nil, false
+	}
+	pattern, flags := key[1:end], key[end+1:]
+	var prefix string
+	for _, flag := range flags {
+		switch flag {
+		case 'i', 'm', 's':
+			prefix += string(flag)
+		case 'g', 'u':
+			// JavaScript 标志，对匹配结果没有影响。
+		default:
+			return nil, false
+		}
+	}
+	if prefix != "" {
+		pattern = "(?" + prefix + ")" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, true
+	}
+	return re, true
+}
+
+func entryLabel(entry types.LoreEntry) string {
+	if entry.Name != "" {
+		return entry.Name
+	}
+	if len(entry.Keys) > 0 {
+		return entry.Keys[0]
+	}
+	return "constant"
+}
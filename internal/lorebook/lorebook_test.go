@@ -0,0 +1,95 @@
+package lorebook
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/easeaico/project-her/internal/types"
+)
+
+func names(entries []types.LoreEntry) []string {
+	out := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		out = append(out, entry.Name)
+	}
+	return out
+}
+
+func TestActivateMatchesKeysRegexAndSecondaryKeys(t *testing.T) {
+	depth := 2
+	entries := []types.LoreEntry{
+		{Name: "cat", Keys: []string{"年糕"}, Content: "年糕是一只橘猫。", Order: 20},
+		{Name: "city", Keys: []string{`/雾(城|都)/`}, Content: "雾城常年下雨。", Order: 10},
+		{Name: "school", Keys: []string{"school"}, SecondaryKeys: []string{"uniform"}, Content: "校服是蓝色的。"},
+		{Name: "case", Keys: []string{"Ava"}, CaseSensitive: true, Content: "Ava 是店长。"},
+		{Name: "rule", Constant: true, Content: "魔法需要代价。", Order: 5},
+		{Name: "whisper", Keys: []string{"秘密"}, Content: "小雪在日记里写着秘密。", Depth: &depth},
+		{Name: "old", Keys: []string{"很久以前"}, Content: "旧事。"},
+	}
+	messages := []string{"很久以前的事", "你好", "我们去雾都吧，带上年糕", "School trip! 有什么秘密吗 ava"}
+
+	result := Activate(entries, messages, Options{ScanDepth: 3})
+	got := names(result.Prompt)
+	want := []string{"rule", "city", "cat"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v in insertion order, got %v", want, got)
+		}
+	}
+	if len(result.Depth) != 1 || result.Depth[0].Name != "whisper" {
+		t.Fatalf("expected depth entry to be kept apart, got %v", names(result.Depth))
+	}
+}
+
+func TestActivateRecursionProbabilityAndBudget(t *testing.T) {
+	entries := []types.LoreEntry{
+		{Name: "kingdom", Keys: []string{"王国"}, Content: "王国由女王统治。", Order: 1},
+		{Name: "queen", Keys: []string{"女王"}, Content: "女王有一把银剑。", Order: 2},
+		{Name: "sword", Keys: []string{"银剑"}, Content: "银剑来自北方。", Order: 3, ExcludeRecursion: true},
+		{Name: "north", Keys: []string{"北方"}, Content: "北方很冷。", Order: 4},
+		{Name: "lucky", Keys: []string{"王国"}, Content: "今天有庆典。", Order: 5, Probability: 30},
+	}
+	messages := []string{"讲讲王国的故事"}
+
+	result := Activate(entries, messages, Options{MaxRecursion: 3, Roll: func() int { return 50 }})
+	if got := names(result.Prompt); len(got) != 2 || got[0] != "kingdom" || got[1] != "queen" {
+		t.Fatalf("expected recursion to stop at excluded entries and the failed roll to skip lucky, got %v", got)
+	}
+
+	result = Activate(entries, messages, Options{MaxRecursion: 0, Roll: func() int { return 10 }})
+	if got := names(result.Prompt); len(got) != 2 || got[1] != "lucky" {
+		t.Fatalf("expected no recursion and a successful roll, got %v", got)
+	}
+
+	// 预算不足时优先保留 Order 较高的条目。
+	result = Activate(entries, messages, Options{MaxRecursion: 1, MaxTokens: 12, Roll: func() int { return 10 }})
+	if got := names(result.Prompt); len(got) != 1 || got[0] != "lucky" {
+		t.Fatalf("expected the highest order entry to win the budget, got %v", got)
+	}
+}
+
+func TestFromCharacterBook(t *testing.T) {
+	raw := json.RawMessage(`{"entries":[
+		{"keys":["猫"],"content":"小雪养了一只猫","enabled":true,"insertion_order":5,"comment":"cat","secondary_keys":["黑"],"selective":false},
+		{"keys":["雨"],"content":"下雨时小雪会发呆","enabled":true,"name":"rain","extensions":{"position":4,"depth":1,"probability":40,"useProbability":true}},
+		{"keys":["旧"],"content":"已停用","enabled":false},
+		{"keys":["零"],"content":"概率为零","extensions":{"probability":0,"useProbability":true}}
+	]}`)
+
+	entries, err := FromCharacterBook(raw)
+	if err != nil {
+		t.Fatalf("failed to parse book: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected disabled and zero-probability entries to be skipped, got %d", len(entries))
+	}
+	if entries[0].Name != "cat" || entries[0].Order != 5 || entries[0].SecondaryKeys != nil {
+		t.Fatalf("unexpected first entry %+v", entries[0])
+	}
+	if entries[1].Depth == nil || *entries[1].Depth != 1 || entries[1].Probability != 40 {
+		t.Fatalf("expected depth and probability from extensions, got %+v", entries[1])
+	}
+}
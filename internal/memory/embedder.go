@@ -4,7 +4,11 @@ package memory
 import (
 	"context"
 	"fmt"
+	"hash/fnv"
 	"log/slog"
+	"math"
+	"strings"
+	"unicode"
 
 	"google.golang.org/genai"
 )
@@ -91,3 +95,82 @@ func (e *GenAIEmbedder) embed(ctx context.Context, text, taskType string) ([]flo
 	}
 	return nil, fmt.Errorf("embedding dimensions mismatch: got %d want %d", len(values), embeddingDimensions)
 }
+
+// HashEmbedder 基于词元哈希生成确定性向量，不访问网络，用于回放模式与离线测试。
+// 含相同词元的文本向量相近，足以让相似度检索返回合理结果。
+type HashEmbedder struct{}
+
+// NewHashEmbedder 创建确定性向量化实现。
+func NewHashEmbedder() *HashEmbedder {
+	return &HashEmbedder{}
+}
+
+func (e *HashEmbedder) EmbedQuery(ctx context.Context, text string) ([]float32, error) {
+	return hashEmbedding(text), nil
+}
+
+func (e *HashEmbedder) EmbedDocument(ctx context.Context, text string) ([]float32, error) {
+	return hashEmbedding(text), nil
+}
+
+func (e *HashEmbedder) EmbedDocuments(ctx context.Context, texts []string) ([][]float32, error) {
+	results := make([][]float32, 0, len(texts))
+	for _, text := range texts {
+		results = append(results, hashEmbedding(text))
+	}
+	return results, nil
+}
+
+// hashEmbedding 将每个词元（中文按字）哈希到固定维度并做 L2 归一化。
+func hashEmbedding(text string) []float32 {
+	if text == "" {
+		return nil
+	}
+	vec := make([]float32, embeddingDimensions)
+	for _, token := range hashTokens(text) {
+		h := fnv.New32a()
+		h.Write([]byte(token))
+		sum := h.Sum32()
+		sign := float32(1)
+		if sum&1 == 1 {
+			sign = -1
+		}
+		vec[int(sum>>1)%embeddingDimensions] += sign
+	}
+	var norm float64
+	for _, v := range vec {
+		norm += float64(v * v)
+	}
+	if norm == 0 {
+		return vec
+	}
+	scale := float32(1 / math.Sqrt(norm))
+	for i := range vec {
+		vec[i] *= scale
+	}
+	return vec
+}
+
+func hashTokens(text string) []string {
+	var tokens []string
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			tokens = append(tokens, string(word))
+			word = word[:0]
+		}
+	}
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flush()
+			tokens = append(tokens, string(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word = append(word, r)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return tokens
+}
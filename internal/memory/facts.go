@@ -0,0 +1,188 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"google.golang.org/adk/model"
+	"google.golang.org/genai"
+
+	"github.com/easeaico/project-her/internal/types"
+	"github.com/easeaico/project-her/internal/utils"
+)
+
+// maxActiveFacts 为每个用户注入提示词、并交给提取模型参考的事实数量上限。
+const maxActiveFacts = 50
+
+// factInstruction 要求模型对照已知事实，只返回新增或变化的用户事实。
+const factInstruction = `You extract durable facts about the user from a roleplay conversation.
+You receive the facts already known about the user, one per line as "key: fact", and a conversation window.
+
+Return the facts that are new or have changed:
+- Only stable personal facts worth remembering for months: name, nickname, birthday, age, job, school, where they live, family, pets and their names, strong likes and dislikes, important dates
+- Ignore the roleplay plot, the character's own details, passing moods and one-off plans
+- Each fact is one short third-person sentence about the user, in the language of the conversation
+- key is a short snake_case identifier of what the fact is about, e.g. name, birthday, home_city, pet_cat_name
+- When a fact updates a known fact (for example the user moved to another city), reuse the known key so the new fact replaces the old one
+- Do not repeat known facts that did not change
+- Return a valid JSON object that matches the output schema, with an empty facts list when there is nothing new`
+
+// FactRepo 持久化用户事实记忆，生产实现位于 internal/storage。
+type FactRepo interface {
+	// SaveFact 写入事实：同键同文的当前事实视为重复；同键不同文的当前事实被取代，
+	// 其有效期在新事实生效时结束。
+	SaveFact(ctx context.Context, fact types.Memory) error
+	// ListActiveFacts 返回用户当前有效的事实，最新的在前；limit 为 0 时不限制。
+	ListActiveFacts(ctx context.Context, userID, appName string, limit int) ([]types.Memory, error)
+}
+
+// factExtractor 从对话窗口中提取用户事实，每条事实作为独立的向量化记忆保存。
+type factExtractor struct {
+	llm      model.LLM
+	facts    FactRepo
+	embedder Embedder
+	now      func() time.Time
+}
+
+type extractedFact struct {
+	Key  string `json:"key"`
+	Fact string `json:"fact"`
+}
+
+// ExtractFacts 提取窗口中新增或变化的事实并写入，返回写入的数量。
+func (e *factExtractor) ExtractFacts(ctx context.Context, window *types.ChatHistory) (int, error) {
+	known, err := e.facts.ListActiveFacts(ctx, window.UserID, window.AppName, maxActiveFacts)
+	if err != nil {
+		return 0, err
+	}
+
+	extracted, err := e.extract(ctx, known, window.Content)
+	if err != nil {
+		return 0, err
+	}
+
+	seen := make(map[string]bool, len(known))
+	for _, fact := range known {
+		seen[normalizeFact(fact.Summary)] = true
+	}
+	saved := 0
+	now := e.now()
+	for _, fact := range extracted {
+		key := normalizeFactKey(fact.Key)
+		text := strings.TrimSpace(fact.Fact)
+		if key == "" || text == "" || seen[normalizeFact(text)] {
+			continue
+		}
+		seen[normalizeFact(text)] = true
+
+		embedding, err := e.embedder.EmbedDocument(ctx, text)
+		if err != nil {
+			return saved, err
+		}
+		if err := e.facts.SaveFact(ctx, types.Memory{
+			UserID:    window.UserID,
+			AppName:   window.AppName,
+			Type:      types.MemoryTypeFacts,
+			FactKey:   key,
+			Summary:   text,
+			Salience:  1,
+			ValidFrom: &now,
+			Embedding: embedding,
+		}); err != nil {
+			return saved, err
+		}
+		saved++
+	}
+	return saved, nil
+}
+
+func (e *factExtractor) extract(ctx context.Context, known []types.Memory, transcript string) ([]extractedFact, error) {
+	var prompt strings.Builder
+	prompt.WriteString("Known facts:\n")
+	if len(known) == 0 {
+		prompt.WriteString("(none)\n")
+	}
+	for _, fact := range known {
+		fmt.Fprintf(&prompt, "%s: %s\n", fact.FactKey, fact.Summary)
+	}
+	prompt.WriteString("\nConversation:\n")
+	prompt.WriteString(strings.TrimSpace(transcript))
+
+	req := &model.LLMRequest{
+		Config: &genai.GenerateContentConfig{
+			SystemInstruction: genai.NewContentFromText(factInstruction, genai.RoleUser),
+			ResponseMIMEType:  "application/json",
+			ResponseSchema:    factOutputSchema(),
+		},
+		Contents: []*genai.Content{genai.NewContentFromText(prompt.String(), genai.RoleUser)},
+	}
+
+	var last string
+	for resp, err := range e.llm.GenerateContent(ctx, req, false) {
+		if err != nil {
+			return nil, fmt.Errorf("failed to extract facts: %w", err)
+		}
+		if resp == nil || resp.Partial {
+			continue
+		}
+		if text := strings.TrimSpace(utils.ExtractContentText(resp.Content)); text != "" {
+			last = text
+		}
+	}
+	if last == "" {
+		return nil, fmt.Errorf("empty fact extraction response")
+	}
+
+	clean := last
+	if start, end := strings.Index(clean, "{"), strings.LastIndex(clean, "}"); start >= 0 && end > start {
+		clean = clean[start : end+1]
+	}
+	var output struct {
+		Facts []extractedFact `json:"facts"`
+	}
+	if err := json.Unmarshal([]byte(clean), &output); err != nil {
+		return nil, fmt.Errorf("failed to parse facts json: %w", err)
+	}
+	if len(output.Facts) > 0 {
+		slog.Info("facts extracted", "count", len(output.Facts))
+	}
+	return output.Facts, nil
+}
+
+func factOutputSchema() *genai.Schema {
+	return &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"facts": {
+				Type: genai.TypeArray,
+				Items: &genai.Schema{
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						"key":  {Type: genai.TypeString},
+						"fact": {Type: genai.TypeString},
+					},
+					Required: []string{"key", "fact"},
+				},
+			},
+		},
+		Required: []string{"facts"},
+	}
+}
+
+// normalizeFactKey 将键统一为小写 snake_case。
+func normalizeFactKey(key string) string {
+	key = strings.ToLower(strings.TrimSpace(key))
+	return strings.Join(strings.FieldsFunc(key, func(r rune) bool {
+		return r == ' ' || r == '-' || r == '_' || r == '.'
+	}), "_")
+}
+
+// normalizeFact 去掉空白与句末标点后用于判重。
+func normalizeFact(text string) string {
+	text = strings.Join(strings.Fields(strings.ToLower(text)), "")
+	return strings.TrimRight(text, "。.!！")
+}
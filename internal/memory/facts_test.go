@@ -0,0 +1,51 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/easeaico/project-her/internal/models/modeltest"
+	"github.com/easeaico/project-her/internal/types"
+)
+
+func TestExtractFactsSupersedesChangedFacts(t *testing.T) {
+	ctx := context.Background()
+	movedAt := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	since := movedAt.AddDate(-1, 0, 0)
+	memories := &fakeMemoryRepo{facts: []types.Memory{
+		{Type: types.MemoryTypeFacts, FactKey: "home_city", Summary: "用户住在北京", ValidFrom: &since},
+		{Type: types.MemoryTypeFacts, FactKey: "pet_cat_name", Summary: "用户的猫叫年糕", ValidFrom: &since},
+	}}
+	llm := &modeltest.ScriptedLLM{Reply: `{"facts":[
+		{"key":"Home City","fact":"用户从北京搬到了上海"},
+		{"key":"pet_cat_name","fact":"用户的猫叫年糕。"},
+		{"key":"","fact":"没有键的事实"}
+	]}`}
+	extractor := &factExtractor{
+		llm:      llm,
+		facts:    memories,
+		embedder: NewHashEmbedder(),
+		now:      func() time.Time { return movedAt },
+	}
+	window := &types.ChatHistory{UserID: "user", AppName: "project_her_roleplay_1", Content: "user: 我上个月从北京搬到上海了\n"}
+
+	saved, err := extractor.ExtractFacts(ctx, window)
+	if err != nil {
+		t.Fatalf("failed to extract facts: %v", err)
+	}
+	if saved != 1 {
+		t.Fatalf("expected only the changed fact to be saved, got %d", saved)
+	}
+	if old := memories.facts[0]; old.ValidUntil == nil || !old.ValidUntil.Equal(movedAt) {
+		t.Fatalf("expected the old city to be closed at %v, got %+v", movedAt, old.ValidUntil)
+	}
+
+	active, _ := memories.ListActiveFacts(ctx, "user", "project_her_roleplay_1", 0)
+	if len(active) != 2 || active[0].FactKey != "home_city" || active[0].Summary != "用户从北京搬到了上海" {
+		t.Fatalf("expected the new city to replace the old one, got %+v", active)
+	}
+	if len(active[0].Embedding) != embeddingDimensions || active[0].Salience != 1 {
+		t.Fatalf("expected the fact to be embedded with top salience, got %+v", active[0])
+	}
+}
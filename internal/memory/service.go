@@ -3,6 +3,7 @@ package memory
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"log/slog"
@@ -24,7 +25,7 @@ type memoryService struct {
 	embedder      Embedder
 	memories      MemoryRepo
 	chatHistories ChatHistoryRepo
-	summarizer    Summarizer
+	closer        *windowCloser
 }
 
 const (
@@ -34,47 +35,79 @@ const (
 
 // Summarizer 定义记忆摘要行为。
 type Summarizer interface {
-	SummarizeLatestWindow(ctx context.Context, userID, appName string) error
+	// SummarizeWindow 摘要指定窗口并写入记忆；窗口不存在或已摘要时直接返回。
+	SummarizeWindow(ctx context.Context, windowID int) error
+	// ExtractWindowFacts 只提取窗口中的用户事实，用于过短而不摘要的窗口。
+	ExtractWindowFacts(ctx context.Context, windowID int) error
 }
 
-// MemoryRepo 负责持久化摘要后的对话窗口并提供相似度检索。
+// MemoryRepo 负责持久化摘要后的对话窗口并提供混合检索。
 // 生产实现通过 internal/storage 使用 GORM。
 type MemoryRepo interface {
+	FactRepo
 	AddMemory(ctx context.Context, mem types.Memory) error
-	SearchSimilar(ctx context.Context, userID, appName, memoryType string, embedding []float32, topK int, threshold float64) ([]types.RetrievedMemory, error)
+	// DeleteWindowMemories 删除属于指定对话窗口的某类记忆，用于淘汰已被摘要覆盖的单轮记忆。
+	DeleteWindowMemories(ctx context.Context, chatHistoryID int, memoryType string) error
+	// SearchHybrid 融合向量检索与全文检索的排名，按融合得分返回记忆；
+	// 所属窗口已摘要的单轮记忆不会返回。
+	SearchHybrid(ctx context.Context, query types.MemoryQuery) ([]types.RetrievedMemory, error)
 }
 
+// ErrStaleWindow 表示追加对话时窗口已关闭、已摘要或已被并发修改，需重新读取窗口后重试。
+var ErrStaleWindow = errors.New("chat window is closed or changed concurrently")
+
+// maxAppendAttempts 为追加一轮对话时遇到 ErrStaleWindow 的最大尝试次数。
+const maxAppendAttempts = 3
+
 // ChatHistoryRepo 维护滚动对话窗口，最终用于生成记忆。
 // 它存储原始对话片段，并提供追加与窗口轮转能力。
 type ChatHistoryRepo interface {
 	GetLatestWindow(ctx context.Context, userID, appName string) (*types.ChatHistory, error)
+	// GetWindow 按 ID 读取窗口，不存在时返回 nil。
+	GetWindow(ctx context.Context, id int) (*types.ChatHistory, error)
 	CreateWindow(ctx context.Context, history *types.ChatHistory) error
+	// UpdateWindow 仅在窗口仍开启、未摘要且轮数与 history 一致时更新，否则返回 ErrStaleWindow。
 	UpdateWindow(ctx context.Context, history *types.ChatHistory, content string, turnCount int) error
+	// CloseWindow 标记窗口不再接收新的对话。
+	CloseWindow(ctx context.Context, id int) error
+	// ListOpenWindows 返回未关闭的窗口中最后一轮早于 idleBefore 或开启早于 openedBefore 的窗口，
+	// 零值表示不使用该条件。
+	ListOpenWindows(ctx context.Context, idleBefore, openedBefore time.Time) ([]types.ChatHistory, error)
 	MarkSummarized(ctx context.Context, id int) error
 	GetRecent(ctx context.Context, userID, appName string, limit int) ([]types.ChatHistory, error)
 }
 
-// NewService 构建默认依赖的记忆服务。
-func NewService(ctx context.Context, cfg *config.Config, memories MemoryRepo, chatHistories ChatHistoryRepo) adkmemory.Service {
-	embedder, err := newEmbedder(ctx, cfg.GoogleAPIKey, cfg.EmbeddingModel)
-	if err != nil {
-		log.Fatalf("failed to create embedder service: %v", err)
-	}
-
-	summarizer, err := NewMemorySummarizer(ctx, cfg, chatHistories, memories, embedder)
-	if err != nil {
-		log.Fatalf("failed to create memory summarizer: %v", err)
-	}
+// NewService 构建默认依赖的记忆服务。关闭的窗口进入 jobs 队列，由 SummaryWorker 摘要。
+func NewService(ctx context.Context, cfg *config.Config, memories MemoryRepo, chatHistories ChatHistoryRepo, jobs SummaryJobRepo) adkmemory.Service {
 	return &memoryService{
 		cfg:           cfg,
-		embedder:      embedder,
+		embedder:      newServiceEmbedder(ctx, cfg),
 		memories:      memories,
 		chatHistories: chatHistories,
-		summarizer:    summarizer,
+		closer:        &windowCloser{cfg: cfg, chatHistories: chatHistories, jobs: jobs},
 	}
 }
 
+// newServiceEmbedder 创建向量化服务，回放模式下使用确定性哈希向量。
+func newServiceEmbedder(ctx context.Context, cfg *config.Config) Embedder {
+	if cfg.ModelFixtureMode == config.FixtureModeReplay {
+		return NewHashEmbedder()
+	}
+	embedder, err := newEmbedder(ctx, cfg.GoogleAPIKey, cfg.EmbeddingModel)
+	if err != nil {
+		log.Fatalf("failed to create embedder service: %v", err)
+	}
+	return embedder
+}
+
+// searchTypes 为对话检索的记忆类型：已摘要的窗口与尚未摘要的单轮记忆。
+// 事实记忆不参与相似度检索，而是全部注入。
+var searchTypes = []string{types.MemoryTypeChat, types.MemoryTypeTurn}
+
 // AddSession 读取会话最新事件并维护滚动记忆窗口。
+// 最新一轮在后台向量化为单轮记忆，使其无需等待窗口摘要即可被检索；
+// 窗口写满或用户换到新会话时关闭窗口并写入摘要任务队列，进程退出也不会丢失；
+// 空闲与跨天的窗口由 SummaryWorker 定期关闭。
 func (s *memoryService) AddSession(ctx context.Context, session session.Session) error {
 	events := session.Events()
 	if events.Len() == 0 {
@@ -90,49 +123,114 @@ func (s *memoryService) AddSession(ctx context.Context, session session.Session)
 	}
 	newContent := fmt.Sprintf("%s: %s\n%s: %s\n", RoleUser, userText, RoleAssistant, assistantText)
 
-	window, err := s.chatHistories.GetLatestWindow(ctx, userID, appName)
+	// 读取窗口到写入之间窗口可能被定期扫描或其他副本关闭，此时重新读取并追加到新窗口，
+	// 保证单轮记忆关联的窗口确实包含这一轮。
+	for attempt := 1; ; attempt++ {
+		windowID, err := s.appendTurn(ctx, session, newContent)
+		if errors.Is(err, ErrStaleWindow) && attempt < maxAppendAttempts {
+			slog.Info("chat window changed before append, retrying", "user_id", userID, "app_name", appName, "attempt", attempt)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		s.indexTurnAsync(userID, appName, windowID, newContent)
+		return nil
+	}
+}
+
+// appendTurn 将一轮对话追加到最新的开启窗口，必要时先关闭旧窗口或新建窗口，返回写入的窗口 ID。
+func (s *memoryService) appendTurn(ctx context.Context, session session.Session, newContent string) (int, error) {
+	window, err := s.chatHistories.GetLatestWindow(ctx, session.UserID(), session.AppName())
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	if window == nil || window.TurnCount >= s.cfg.MemoryTrunkSize || window.Summarized {
+	if window != nil && window.ClosedAt == nil && !window.Summarized {
+		reason := ""
+		switch {
+		case window.TurnCount >= s.cfg.MemoryTrunkSize:
+			reason = closeFull
+		case window.SessionID != "" && window.SessionID != session.ID():
+			// 用户换到新会话，视为上一个会话结束。
+			reason = closeSessionEnd
+		}
+		if reason != "" {
+			s.closeWindow(ctx, window, reason)
+		}
+	}
+
+	if window == nil || window.ClosedAt != nil || window.Summarized {
 		newWindow := types.ChatHistory{
-			UserID:     userID,
-			AppName:    appName,
+			UserID:     session.UserID(),
+			AppName:    session.AppName(),
+			SessionID:  session.ID(),
 			Content:    newContent,
 			TurnCount:  2,
 			Summarized: false,
 		}
 		if err := s.chatHistories.CreateWindow(ctx, &newWindow); err != nil {
-			return err
+			return 0, err
 		}
-		return nil
+		return newWindow.ID, nil
 	}
 
 	newTurnCount := window.TurnCount + 2
-	newContent = fmt.Sprintf("%s%s", window.Content, newContent)
-	if err := s.chatHistories.UpdateWindow(ctx, window, newContent, newTurnCount); err != nil {
-		return err
+	if err := s.chatHistories.UpdateWindow(ctx, window, fmt.Sprintf("%s%s", window.Content, newContent), newTurnCount); err != nil {
+		return 0, err
 	}
 
 	if newTurnCount >= s.cfg.MemoryTrunkSize {
-		go func() {
-			defer func() {
-				if recovered := recover(); recovered != nil {
-					slog.Error("summarizer goroutine panicked", "panic", recovered, "user_id", userID, "app_name", appName)
-				}
-			}()
-
-			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-			defer cancel()
-
-			if err := s.summarizer.SummarizeLatestWindow(ctx, userID, appName); err != nil {
-				slog.Error("failed to summarize latest window", "error", err.Error(), "user_id", userID, "app_name", appName)
+		window.TurnCount = newTurnCount
+		s.closeWindow(ctx, window, closeFull)
+	}
+	return window.ID, nil
+}
+
+// closeWindow 关闭窗口并将其标记为已关闭。失败只记录日志：窗口仍然开启时，
+// 下一轮或 SummaryWorker 的定期扫描会再次关闭它。
+func (s *memoryService) closeWindow(ctx context.Context, window *types.ChatHistory, reason string) {
+	if err := s.closer.close(ctx, window, reason); err != nil {
+		slog.Error("failed to close chat window", "error", err.Error(), "chat_history_id", window.ID, "reason", reason)
+		return
+	}
+	now := time.Now()
+	window.ClosedAt = &now
+}
+
+// indexTurnAsync 在后台为最新一轮建立单轮记忆。窗口摘要后写入的单轮记忆不会被检索到。
+func (s *memoryService) indexTurnAsync(userID, appName string, windowID int, turn string) {
+	go func() {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				slog.Error("memory goroutine panicked", "panic", recovered, "user_id", userID, "app_name", appName)
 			}
 		}()
-	}
 
-	return nil
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		if err := s.indexTurn(ctx, userID, appName, windowID, turn); err != nil {
+			slog.Error("failed to index turn memory", "error", err.Error(), "user_id", userID, "app_name", appName)
+		}
+	}()
+}
+
+// indexTurn 向量化一轮对话并写入单轮记忆。
+func (s *memoryService) indexTurn(ctx context.Context, userID, appName string, windowID int, turn string) error {
+	turn = strings.TrimSpace(turn)
+	embedding, err := s.embedder.EmbedDocument(ctx, turn)
+	if err != nil {
+		return err
+	}
+	return s.memories.AddMemory(ctx, types.Memory{
+		UserID:        userID,
+		AppName:       appName,
+		Type:          types.MemoryTypeTurn,
+		Summary:       turn,
+		ChatHistoryID: windowID,
+		Embedding:     embedding,
+	})
 }
 
 func (s *memoryService) Search(ctx context.Context, req *adkmemory.SearchRequest) (*adkmemory.SearchResponse, error) {
@@ -140,16 +238,52 @@ func (s *memoryService) Search(ctx context.Context, req *adkmemory.SearchRequest
 		return &adkmemory.SearchResponse{Memories: nil}, nil
 	}
 
+	// 当前有效的用户事实不依赖相似度，总是排在检索结果之前。
+	facts, err := s.memories.ListActiveFacts(ctx, req.UserID, req.AppName, maxActiveFacts)
+	if err != nil {
+		return nil, err
+	}
+
 	vec, err := s.embedder.EmbedQuery(ctx, req.Query)
 	if err != nil {
 		return nil, err
 	}
 
-	memories, err := s.memories.SearchSimilar(ctx, req.UserID, req.AppName, types.MemoryTypeChat, vec, s.cfg.TopK, s.cfg.SimilarityThreshold)
+	memories, err := s.memories.SearchHybrid(ctx, types.MemoryQuery{
+		UserID:              req.UserID,
+		AppName:             req.AppName,
+		Types:               searchTypes,
+		Text:                req.Query,
+		Embedding:           vec,
+		TopK:                s.cfg.TopK,
+		Candidates:          max(s.cfg.MemoryCandidates, s.cfg.TopK),
+		SimilarityThreshold: s.cfg.SimilarityThreshold,
+		LexicalThreshold:    s.cfg.MemoryLexicalThreshold,
+		VectorWeight:        s.cfg.MemoryVectorWeight,
+		LexicalWeight:       s.cfg.MemoryLexicalWeight,
+		SalienceWeight:      s.cfg.MemorySalienceWeight,
+		RRFK:                s.cfg.MemoryRRFK,
+	})
 	if err != nil {
 		return nil, err
 	}
-	return &adkmemory.SearchResponse{Memories: ToMemoryEntries(memories)}, nil
+	return &adkmemory.SearchResponse{Memories: append(factEntries(facts), ToMemoryEntries(memories)...)}, nil
+}
+
+// factEntries 将事实转换为记忆条目，Author 为 types.MemoryTypeFacts，Timestamp 为生效时间。
+func factEntries(facts []types.Memory) []adkmemory.Entry {
+	results := make([]adkmemory.Entry, 0, len(facts))
+	for _, fact := range facts {
+		entry := adkmemory.Entry{
+			Content: genai.NewContentFromText(fact.Summary, genai.RoleModel),
+			Author:  types.MemoryTypeFacts,
+		}
+		if fact.ValidFrom != nil {
+			entry.Timestamp = *fact.ValidFrom
+		}
+		results = append(results, entry)
+	}
+	return results
 }
 
 func extractLatestPair(events session.Events) (assistantText, userText string) {
@@ -162,7 +296,8 @@ func extractLatestPair(events session.Events) (assistantText, userText string) {
 		if event == nil || event.Content == nil {
 			continue
 		}
-		if event.Content.Role != RoleAssistant {
+		// 流式最终响应的角色为 genai 的 "model"，非流式 OpenAI 响应为 "assistant"。
+		if event.Content.Role != RoleAssistant && event.Content.Role != genai.RoleModel {
 			continue
 		}
 		text := strings.TrimSpace(utils.ExtractContentText(event.Content))
@@ -0,0 +1,182 @@
+package memory
+
+import (
+	"context"
+	"iter"
+	"slices"
+	"testing"
+
+	adkmemory "google.golang.org/adk/memory"
+	"google.golang.org/adk/session"
+	"google.golang.org/genai"
+
+	"github.com/easeaico/project-her/internal/config"
+	"github.com/easeaico/project-her/internal/types"
+)
+
+type fakeEvents []*session.Event
+
+func (e fakeEvents) Len() int                { return len(e) }
+func (e fakeEvents) At(i int) *session.Event { return e[i] }
+func (e fakeEvents) All() iter.Seq[*session.Event] {
+	return func(yield func(*session.Event) bool) {
+		for _, event := range e {
+			if !yield(event) {
+				return
+			}
+		}
+	}
+}
+
+func contentEvent(content *genai.Content) *session.Event {
+	event := session.NewEvent("test")
+	event.Content = content
+	return event
+}
+
+func TestExtractLatestPairSkipsThoughts(t *testing.T) {
+	events := fakeEvents{
+		contentEvent(genai.NewContentFromText("今天好累", genai.RoleUser)),
+		contentEvent(&genai.Content{
+			Role: genai.RoleModel,
+			Parts: []*genai.Part{
+				{Text: "用户情绪低落，先安慰。", Thought: true},
+				{Text: "*抱抱你* 辛苦啦。"},
+			},
+		}),
+	}
+
+	assistantText, userText := extractLatestPair(events)
+	if userText != "今天好累" {
+		t.Fatalf("unexpected user text %q", userText)
+	}
+	if assistantText != "*抱抱你* 辛苦啦。" {
+		t.Fatalf("expected thought to be excluded from memory window, got %q", assistantText)
+	}
+}
+
+func TestIndexTurnIsSearchableBeforeSummary(t *testing.T) {
+	memories := &fakeMemoryRepo{}
+	svc := &memoryService{
+		cfg: &config.Config{
+			TopK:                 5,
+			SimilarityThreshold:  0.7,
+			MemoryVectorWeight:   1,
+			MemoryLexicalWeight:  1,
+			MemorySalienceWeight: 0.3,
+			MemoryRRFK:           60,
+			MemoryCandidates:     20,
+		},
+		embedder: NewHashEmbedder(),
+		memories: memories,
+	}
+	ctx := context.Background()
+
+	if err := svc.indexTurn(ctx, "user", "project_her_roleplay_1", 7, "user: 我叫小林\nassistant: 记住啦\n"); err != nil {
+		t.Fatalf("failed to index turn: %v", err)
+	}
+	got := memories.last
+	if got.Type != types.MemoryTypeTurn || got.ChatHistoryID != 7 || got.Summary != "user: 我叫小林\nassistant: 记住啦" {
+		t.Fatalf("unexpected turn memory %+v", got)
+	}
+	if len(got.Embedding) != embeddingDimensions {
+		t.Fatalf("expected turn memory to be embedded, got %d dims", len(got.Embedding))
+	}
+
+	if _, err := svc.Search(ctx, &adkmemory.SearchRequest{UserID: "user", AppName: "project_her_roleplay_1", Query: "我是谁"}); err != nil {
+		t.Fatalf("failed to search: %v", err)
+	}
+	query := memories.query
+	if !slices.Equal(query.Types, []string{types.MemoryTypeChat, types.MemoryTypeTurn}) {
+		t.Fatalf("expected search to cover summaries and turns, got %v", query.Types)
+	}
+	// 查询文本参与全文检索，向量与融合参数取自配置。
+	if query.Text != "我是谁" || len(query.Embedding) != embeddingDimensions {
+		t.Fatalf("expected both lexical and vector inputs, got %q and %d dims", query.Text, len(query.Embedding))
+	}
+	if query.TopK != 5 || query.Candidates != 20 || query.RRFK != 60 || query.LexicalWeight != 1 || query.SalienceWeight != 0.3 {
+		t.Fatalf("expected fusion settings from config, got %+v", query)
+	}
+}
+
+type fakeSession struct {
+	session.Session
+	id     string
+	events fakeEvents
+}
+
+func (s *fakeSession) ID() string             { return s.id }
+func (s *fakeSession) UserID() string         { return "user" }
+func (s *fakeSession) AppName() string        { return "project_her_roleplay_1" }
+func (s *fakeSession) Events() session.Events { return s.events }
+
+func TestAddSessionClosesWindowOfPreviousSession(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{MemoryTrunkSize: 100, SummaryMinTurns: 6}
+	turn := fakeEvents{
+		contentEvent(genai.NewContentFromText("我回来啦", genai.RoleUser)),
+		contentEvent(genai.NewContentFromText("欢迎回来", genai.RoleModel)),
+	}
+	jobs := &fakeSummaryJobRepo{}
+	newService := func(histories *fakeChatHistoryRepo) *memoryService {
+		return &memoryService{
+			cfg:           cfg,
+			embedder:      NewHashEmbedder(),
+			memories:      &fakeMemoryRepo{},
+			chatHistories: histories,
+			closer:        &windowCloser{cfg: cfg, chatHistories: histories, jobs: jobs},
+		}
+	}
+
+	old := &types.ChatHistory{ID: 1, UserID: "user", AppName: "project_her_roleplay_1", SessionID: "s1", TurnCount: 10}
+	histories := &fakeChatHistoryRepo{window: old}
+	if err := newService(histories).AddSession(ctx, &fakeSession{id: "s2", events: turn}); err != nil {
+		t.Fatalf("failed to add session: %v", err)
+	}
+	if !slices.Equal(histories.closed, []int{1}) || len(jobs.pending) != 1 || jobs.pending[0].ChatHistoryID != 1 {
+		t.Fatalf("expected the previous session's window to be closed and queued, got %v / %+v", histories.closed, jobs.pending)
+	}
+	if len(histories.created) != 1 || histories.created[0].SessionID != "s2" {
+		t.Fatalf("expected a new window for the new session, got %+v", histories.created)
+	}
+
+	// 内容不足的窗口不摘要，只进入事实提取任务。
+	short := &types.ChatHistory{ID: 2, UserID: "user", AppName: "project_her_roleplay_1", SessionID: "s1", TurnCount: 2}
+	histories = &fakeChatHistoryRepo{window: short}
+	if err := newService(histories).AddSession(ctx, &fakeSession{id: "s3", events: turn}); err != nil {
+		t.Fatalf("failed to add session: %v", err)
+	}
+	if !slices.Equal(histories.closed, []int{2}) || len(jobs.pending) != 2 || jobs.pending[1].Kind != types.SummaryJobKindFacts {
+		t.Fatalf("expected the short window to be closed with a facts job, got %v / %+v", histories.closed, jobs.pending)
+	}
+}
+
+func TestAddSessionRetriesWhenWindowClosedConcurrently(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{MemoryTrunkSize: 100, SummaryMinTurns: 6}
+	histories := &fakeChatHistoryRepo{
+		window:        &types.ChatHistory{ID: 1, UserID: "user", AppName: "project_her_roleplay_1", SessionID: "s1", TurnCount: 4},
+		closeOnUpdate: true,
+	}
+	svc := &memoryService{
+		cfg:           cfg,
+		embedder:      NewHashEmbedder(),
+		memories:      &fakeMemoryRepo{},
+		chatHistories: histories,
+		closer:        &windowCloser{cfg: cfg, chatHistories: histories, jobs: &fakeSummaryJobRepo{}},
+	}
+	turn := fakeEvents{
+		contentEvent(genai.NewContentFromText("还在吗", genai.RoleUser)),
+		contentEvent(genai.NewContentFromText("一直都在", genai.RoleModel)),
+	}
+
+	if err := svc.AddSession(ctx, &fakeSession{id: "s1", events: turn}); err != nil {
+		t.Fatalf("failed to add session: %v", err)
+	}
+	if len(histories.updated) != 0 {
+		t.Fatalf("expected the closed window not to be appended to, got %v", histories.updated)
+	}
+	if len(histories.created) != 1 || histories.created[0].Content != "user: 还在吗\nassistant: 一直都在\n" {
+		t.Fatalf("expected the turn to open a new window, got %+v", histories.created)
+	}
+}
@@ -0,0 +1,84 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"google.golang.org/adk/model"
+	"google.golang.org/genai"
+
+	"github.com/easeaico/project-her/internal/callback"
+	"github.com/easeaico/project-her/internal/config"
+	"github.com/easeaico/project-her/internal/models"
+	"github.com/easeaico/project-her/internal/utils"
+)
+
+// storyInstructionTemplate 要求模型把新对话并入已有的剧情概要，%d 为 token 上限。
+const storyInstructionTemplate = `You maintain the running "story so far" of an ongoing roleplay conversation.
+You receive the current story summary (possibly empty) and the conversation turns that just left the context window.
+Rewrite the summary so it also covers the new turns.
+
+Requirements:
+- Keep what still matters for continuity: ongoing plot threads, where the characters are, what they are doing, promises, names and details the user shared, the emotional tone
+- Drop details that no longer matter; merge rather than append
+- Use third-person narration in the language of the conversation, in chronological order
+- Stay under %d tokens
+- Output only the updated summary, without headings or any other text`
+
+// storySummarizer 使用记忆模型增量维护每个会话的剧情概要。
+type storySummarizer struct {
+	llm       model.LLM
+	maxTokens int
+}
+
+// NewStorySummarizer 创建剧情概要更新器，使用记忆角色的模型。
+func NewStorySummarizer(ctx context.Context, cfg *config.Config, registry *models.Registry) (callback.StoryUpdater, error) {
+	llm, err := registry.LLM(ctx, models.RoleMemory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create story summarizer model: %w", err)
+	}
+	return &storySummarizer{llm: llm, maxTokens: cfg.StoryMaxTokens}, nil
+}
+
+// UpdateStory 将被裁剪的对话并入已有概要，返回新的概要。
+func (s *storySummarizer) UpdateStory(ctx context.Context, previous, transcript string) (string, error) {
+	maxTokens := s.maxTokens
+	if maxTokens <= 0 {
+		maxTokens = 400
+	}
+
+	var prompt strings.Builder
+	prompt.WriteString("Current story so far:\n")
+	if previous = strings.TrimSpace(previous); previous != "" {
+		prompt.WriteString(previous)
+	} else {
+		prompt.WriteString("(empty)")
+	}
+	prompt.WriteString("\n\nTurns that left the context window:\n")
+	prompt.WriteString(strings.TrimSpace(transcript))
+
+	req := &model.LLMRequest{
+		Config: &genai.GenerateContentConfig{
+			SystemInstruction: genai.NewContentFromText(fmt.Sprintf(storyInstructionTemplate, maxTokens), genai.RoleUser),
+		},
+		Contents: []*genai.Content{genai.NewContentFromText(prompt.String(), genai.RoleUser)},
+	}
+
+	var story string
+	for resp, err := range s.llm.GenerateContent(ctx, req, false) {
+		if err != nil {
+			return "", fmt.Errorf("failed to update story: %w", err)
+		}
+		if resp == nil || resp.Partial {
+			continue
+		}
+		if text := strings.TrimSpace(utils.ExtractContentText(resp.Content)); text != "" {
+			story = text
+		}
+	}
+	if story == "" {
+		return "", fmt.Errorf("empty story response")
+	}
+	return utils.TruncateToTokens(story, maxTokens), nil
+}
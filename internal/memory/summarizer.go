@@ -9,15 +9,15 @@ import (
 	"log/slog"
 	"strings"
 	"sync/atomic"
+	"time"
 
 	"google.golang.org/adk/agent"
 	"google.golang.org/adk/agent/llmagent"
-	"google.golang.org/adk/model/gemini"
 	"google.golang.org/adk/runner"
 	"google.golang.org/adk/session"
 	"google.golang.org/genai"
 
-	"github.com/easeaico/project-her/internal/config"
+	"github.com/easeaico/project-her/internal/models"
 	"github.com/easeaico/project-her/internal/types"
 	"github.com/easeaico/project-her/internal/utils"
 )
@@ -47,13 +47,14 @@ Output requirements:
 
 // memorySummarizer 使用 ADK agent 生成记忆摘要。
 type memorySummarizer struct {
-	agent           agent.Agent
-	runner          summarizerRunner
-	sessionService  session.Service
-	charHistories   ChatHistoryRepo
-	memoryRepo      MemoryRepo
-	embedder        Embedder
-	counter         uint64
+	agent          agent.Agent
+	runner         summarizerRunner
+	sessionService session.Service
+	charHistories  ChatHistoryRepo
+	memoryRepo     MemoryRepo
+	embedder       Embedder
+	facts          *factExtractor
+	counter        uint64
 }
 
 type summarizerRunner interface {
@@ -61,10 +62,8 @@ type summarizerRunner interface {
 }
 
 // NewMemorySummarizer 基于 ADK llmagent 构建摘要器。
-func NewMemorySummarizer(ctx context.Context, cfg *config.Config, charHistories ChatHistoryRepo, memoryRepo MemoryRepo, embedder Embedder) (Summarizer, error) {
-	summarizerModel, err := gemini.NewModel(ctx, cfg.MemoryModel, &genai.ClientConfig{
-		APIKey: cfg.GoogleAPIKey,
-	})
+func NewMemorySummarizer(ctx context.Context, registry *models.Registry, charHistories ChatHistoryRepo, memoryRepo MemoryRepo, embedder Embedder) (Summarizer, error) {
+	summarizerModel, err := registry.LLM(ctx, models.RoleMemory)
 	if err != nil {
 		slog.Error("failed to create summarizer model", "error", err)
 		return nil, fmt.Errorf("failed to create summarizer model: %w", err)
@@ -94,24 +93,34 @@ func NewMemorySummarizer(ctx context.Context, cfg *config.Config, charHistories
 	}
 
 	return &memorySummarizer{
-		agent:           llmAgent,
-		runner:          r,
-		sessionService:  sessionService,
-		charHistories:   charHistories,
-		memoryRepo:      memoryRepo,
-		embedder:        embedder,
+		agent:          llmAgent,
+		runner:         r,
+		sessionService: sessionService,
+		charHistories:  charHistories,
+		memoryRepo:     memoryRepo,
+		embedder:       embedder,
+		facts:          &factExtractor{llm: summarizerModel, facts: memoryRepo, embedder: embedder, now: time.Now},
 	}, nil
 }
 
-// SummarizeWindow 对指定会话的当前窗口做摘要并写入记忆。
-func (s *memorySummarizer) SummarizeLatestWindow(ctx context.Context, userID, appName string) error {
-	window, err := s.charHistories.GetLatestWindow(ctx, userID, appName)
+// SummarizeWindow 对指定窗口做摘要并写入记忆，随后将窗口标记为已摘要。
+func (s *memorySummarizer) SummarizeWindow(ctx context.Context, windowID int) error {
+	window, err := s.charHistories.GetWindow(ctx, windowID)
 	if err != nil {
 		return err
 	}
-	if window == nil {
+	if window == nil || window.Summarized {
 		return nil
 	}
+	userID, appName := window.UserID, window.AppName
+
+	// 先提取事实：事实写入可以重复执行，摘要失败重试时不会产生重复事实。
+	// 提取失败只记录日志，不拖累摘要的重试与死信。
+	if s.facts != nil {
+		if _, err := s.facts.ExtractFacts(ctx, window); err != nil {
+			slog.Warn("failed to extract facts", "error", err.Error(), "chat_history_id", window.ID)
+		}
+	}
 
 	summarySessID := fmt.Sprintf("summary-%d", atomic.AddUint64(&s.counter, 1))
 	if _, err := s.sessionService.Create(ctx, &session.CreateRequest{
@@ -183,9 +192,33 @@ func (s *memorySummarizer) SummarizeLatestWindow(ctx context.Context, userID, ap
 		return err
 	}
 
+	if err := s.charHistories.MarkSummarized(ctx, window.ID); err != nil {
+		return err
+	}
+	// 摘要已覆盖该窗口，单轮记忆随之淘汰；删除失败时检索也会将其排除。
+	if err := s.memoryRepo.DeleteWindowMemories(ctx, window.ID, types.MemoryTypeTurn); err != nil {
+		slog.Warn("failed to retire turn memories", "error", err, "chat_history_id", window.ID)
+	}
+
 	return nil
 }
 
+// ExtractWindowFacts 提取指定窗口中的用户事实，不生成摘要，也不标记窗口。
+func (s *memorySummarizer) ExtractWindowFacts(ctx context.Context, windowID int) error {
+	if s.facts == nil {
+		return nil
+	}
+	window, err := s.charHistories.GetWindow(ctx, windowID)
+	if err != nil {
+		return err
+	}
+	if window == nil {
+		return nil
+	}
+	_, err = s.facts.ExtractFacts(ctx, window)
+	return err
+}
+
 func summaryOutputSchema() *genai.Schema {
 	return &genai.Schema{
 		Type: genai.TypeObject,
@@ -3,14 +3,19 @@ package memory
 import (
 	"context"
 	"iter"
+	"slices"
 	"strings"
 	"testing"
 	"time"
 
 	"google.golang.org/adk/agent"
+	"google.golang.org/adk/model"
 	"google.golang.org/adk/session"
 	"google.golang.org/genai"
 
+	"github.com/easeaico/project-her/internal/config"
+	"github.com/easeaico/project-her/internal/models"
+	"github.com/easeaico/project-her/internal/models/modeltest"
 	"github.com/easeaico/project-her/internal/types"
 )
 
@@ -38,8 +43,17 @@ func (r *fakeRunner) Run(ctx context.Context, userID, sessionID string, msg *gen
 }
 
 type fakeChatHistoryRepo struct {
-	window *types.ChatHistory
-	err    error
+	window     *types.ChatHistory
+	err        error
+	summarized []int
+	created    []types.ChatHistory
+	closed     []int
+	open       []types.ChatHistory
+	idleBefore time.Time
+	dayStart   time.Time
+	updated    []int
+	// closeOnUpdate 模拟读取窗口后、追加前窗口被定期扫描关闭。
+	closeOnUpdate bool
 }
 
 func (r *fakeChatHistoryRepo) GetLatestWindow(ctx context.Context, userID, appName string) (*types.ChatHistory, error) {
@@ -49,15 +63,45 @@ func (r *fakeChatHistoryRepo) GetLatestWindow(ctx context.Context, userID, appNa
 	return r.window, nil
 }
 
+func (r *fakeChatHistoryRepo) GetWindow(ctx context.Context, id int) (*types.ChatHistory, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.window == nil || r.window.ID != id {
+		return nil, nil
+	}
+	return r.window, nil
+}
+
 func (r *fakeChatHistoryRepo) CreateWindow(ctx context.Context, history *types.ChatHistory) error {
+	history.ID = 100 + len(r.created)
+	r.created = append(r.created, *history)
 	return nil
 }
 
+func (r *fakeChatHistoryRepo) CloseWindow(ctx context.Context, id int) error {
+	r.closed = append(r.closed, id)
+	return nil
+}
+
+func (r *fakeChatHistoryRepo) ListOpenWindows(ctx context.Context, idleBefore, openedBefore time.Time) ([]types.ChatHistory, error) {
+	r.idleBefore, r.dayStart = idleBefore, openedBefore
+	return r.open, nil
+}
+
 func (r *fakeChatHistoryRepo) UpdateWindow(ctx context.Context, history *types.ChatHistory, content string, turnCount int) error {
+	if r.closeOnUpdate {
+		r.closeOnUpdate = false
+		closedAt := time.Now()
+		r.window.ClosedAt = &closedAt
+		return ErrStaleWindow
+	}
+	r.updated = append(r.updated, history.ID)
 	return nil
 }
 
 func (r *fakeChatHistoryRepo) MarkSummarized(ctx context.Context, id int) error {
+	r.summarized = append(r.summarized, id)
 	return nil
 }
 
@@ -66,8 +110,11 @@ func (r *fakeChatHistoryRepo) GetRecent(ctx context.Context, userID, appName str
 }
 
 type fakeMemoryRepo struct {
-	last types.Memory
-	err  error
+	last    types.Memory
+	err     error
+	retired []int
+	query   types.MemoryQuery
+	facts   []types.Memory
 }
 
 func (r *fakeMemoryRepo) AddMemory(ctx context.Context, mem types.Memory) error {
@@ -78,10 +125,47 @@ func (r *fakeMemoryRepo) AddMemory(ctx context.Context, mem types.Memory) error
 	return nil
 }
 
-func (r *fakeMemoryRepo) SearchSimilar(ctx context.Context, userID, appName, memoryType string, embedding []float32, topK int, threshold float64) ([]types.RetrievedMemory, error) {
+func (r *fakeMemoryRepo) DeleteWindowMemories(ctx context.Context, chatHistoryID int, memoryType string) error {
+	if memoryType == types.MemoryTypeTurn {
+		r.retired = append(r.retired, chatHistoryID)
+	}
+	return nil
+}
+
+func (r *fakeMemoryRepo) SearchHybrid(ctx context.Context, query types.MemoryQuery) ([]types.RetrievedMemory, error) {
+	r.query = query
 	return nil, nil
 }
 
+// SaveFact 模拟存储层的取代语义：同键同文跳过，同键不同文结束旧事实的有效期。
+func (r *fakeMemoryRepo) SaveFact(ctx context.Context, fact types.Memory) error {
+	for i := range r.facts {
+		current := &r.facts[i]
+		if current.FactKey != fact.FactKey || current.ValidUntil != nil {
+			continue
+		}
+		if current.Summary == fact.Summary {
+			return nil
+		}
+		current.ValidUntil = fact.ValidFrom
+	}
+	r.facts = append(r.facts, fact)
+	return nil
+}
+
+func (r *fakeMemoryRepo) ListActiveFacts(ctx context.Context, userID, appName string, limit int) ([]types.Memory, error) {
+	var active []types.Memory
+	for _, fact := range slices.Backward(r.facts) {
+		if fact.ValidUntil == nil {
+			active = append(active, fact)
+		}
+	}
+	if limit > 0 && len(active) > limit {
+		active = active[:limit]
+	}
+	return active, nil
+}
+
 type fakeEmbedder struct {
 	vector []float32
 	err    error
@@ -134,7 +218,7 @@ func TestSummarizeLatestWindowCreatesSessionAndWritesMemory(t *testing.T) {
 		embedder:       embedder,
 	}
 
-	if err := summarizer.SummarizeLatestWindow(context.Background(), window.UserID, window.AppName); err != nil {
+	if err := summarizer.SummarizeWindow(context.Background(), window.ID); err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
 
@@ -159,6 +243,100 @@ func TestSummarizeLatestWindowCreatesSessionAndWritesMemory(t *testing.T) {
 	if memories.last.Salience != 0.55 {
 		t.Fatalf("expected salience 0.55, got %v", memories.last.Salience)
 	}
+	if !slices.Equal(histories.summarized, []int{window.ID}) || !slices.Equal(memories.retired, []int{window.ID}) {
+		t.Fatalf("expected window to be marked summarized and its turn memories retired, got %v and %v", histories.summarized, memories.retired)
+	}
+}
+
+func TestSummarizeLatestWindowReplaysRecordedSummary(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		MemoryModel:      "gemini/gemini-2.0-flash",
+		ModelMaxAttempts: 1,
+		ModelFixtureMode: config.FixtureModeRecord,
+		ModelFixtureDir:  t.TempDir(),
+	}
+	window := &types.ChatHistory{
+		ID:      1,
+		UserID:  "user",
+		AppName: "project_her_roleplay_1",
+		Content: "user: 我下周去青岛\nassistant: 记得带伞\n",
+	}
+	live := &modeltest.ScriptedLLM{
+		Model: "gemini-2.0-flash",
+		Reply: `{"summary":"用户下周去青岛","facts":["用户下周去青岛"]}`,
+		ByInstruction: map[string]string{
+			factInstruction: `{"facts":[{"key":"home_city","fact":"用户住在北京"}]}`,
+		},
+	}
+
+	summarize := func(registry *models.Registry) *fakeMemoryRepo {
+		t.Helper()
+		memories := &fakeMemoryRepo{}
+		summarizer, err := NewMemorySummarizer(ctx, registry, &fakeChatHistoryRepo{window: window}, memories, NewHashEmbedder())
+		if err != nil {
+			t.Fatalf("failed to create summarizer: %v", err)
+		}
+		if err := summarizer.SummarizeWindow(ctx, window.ID); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		return memories
+	}
+
+	recordRegistry := models.NewRegistry(cfg)
+	recordRegistry.RegisterLLM(models.ProviderGemini, func(ctx context.Context, modelName string, p config.ProviderConfig) (model.LLM, error) {
+		return live, nil
+	})
+	recorded := summarize(recordRegistry)
+
+	replayCfg := *cfg
+	replayCfg.ModelFixtureMode = config.FixtureModeReplay
+	replayed := summarize(models.NewRegistry(&replayCfg))
+
+	// 摘要与事实提取各调用一次在线模型，回放阶段不再调用。
+	if live.Calls() != 2 {
+		t.Fatalf("expected replay to skip live model, got %d calls", live.Calls())
+	}
+	if replayed.last.Summary != "用户下周去青岛" || replayed.last.Summary != recorded.last.Summary {
+		t.Fatalf("expected replayed summary to match recording, got %q vs %q", replayed.last.Summary, recorded.last.Summary)
+	}
+	if len(replayed.facts) != 1 || replayed.facts[0].Summary != "用户住在北京" {
+		t.Fatalf("expected replayed facts to match recording, got %+v", replayed.facts)
+	}
+	if !slices.Equal(replayed.last.Embedding, recorded.last.Embedding) || len(replayed.last.Embedding) != embeddingDimensions {
+		t.Fatalf("expected deterministic embedding of %d dims", embeddingDimensions)
+	}
+}
+
+func TestSummarizeWindowSurvivesFactExtractionFailure(t *testing.T) {
+	sessionService := session.InMemoryService()
+	window := &types.ChatHistory{ID: 1, UserID: "user", AppName: "project_her_roleplay_1", Content: "user: 我叫小林\nassistant: 记住啦\n"}
+	histories := &fakeChatHistoryRepo{window: window}
+	memories := &fakeMemoryRepo{}
+	summarizer := &memorySummarizer{
+		runner:         &fakeRunner{sessionService: sessionService, response: `{"summary":"用户自我介绍叫小林"}`},
+		sessionService: sessionService,
+		charHistories:  histories,
+		memoryRepo:     memories,
+		embedder:       NewHashEmbedder(),
+		facts: &factExtractor{
+			llm:      &modeltest.ScriptedLLM{Reply: "not json"},
+			facts:    memories,
+			embedder: NewHashEmbedder(),
+			now:      time.Now,
+		},
+	}
+
+	if err := summarizer.SummarizeWindow(context.Background(), window.ID); err != nil {
+		t.Fatalf("expected malformed facts not to fail the summary, got %v", err)
+	}
+	if memories.last.Summary != "用户自我介绍叫小林" || !slices.Equal(histories.summarized, []int{window.ID}) {
+		t.Fatalf("expected the window to be summarized, got %+v / %v", memories.last, histories.summarized)
+	}
+	// 只提取事实的任务把提取失败交给队列重试。
+	if err := summarizer.ExtractWindowFacts(context.Background(), window.ID); err == nil {
+		t.Fatalf("expected facts-only extraction to report the malformed reply")
+	}
 }
 
 func TestComputeSalienceClampsToRange(t *testing.T) {
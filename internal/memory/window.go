@@ -0,0 +1,102 @@
+package memory
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"google.golang.org/adk/session"
+
+	"github.com/easeaico/project-her/internal/config"
+	"github.com/easeaico/project-her/internal/types"
+)
+
+// 窗口关闭的原因，仅用于日志。
+const (
+	closeFull       = "full"
+	closeIdle       = "idle"
+	closeEndOfDay   = "end_of_day"
+	closeSessionEnd = "session_end"
+)
+
+// windowCloser 关闭记忆窗口，并为内容足够的窗口写入摘要任务。
+// 过短的窗口不摘要，其单轮记忆继续参与检索，但仍写入事实提取任务。
+type windowCloser struct {
+	cfg           *config.Config
+	chatHistories ChatHistoryRepo
+	jobs          SummaryJobRepo
+}
+
+func (c *windowCloser) close(ctx context.Context, window *types.ChatHistory, reason string) error {
+	if err := c.chatHistories.CloseWindow(ctx, window.ID); err != nil {
+		return err
+	}
+	job := types.SummaryJob{ChatHistoryID: window.ID, UserID: window.UserID, AppName: window.AppName, Kind: types.SummaryJobKindSummary}
+	if window.TurnCount < c.cfg.SummaryMinTurns {
+		slog.Info("chat window closed without summary", "chat_history_id", window.ID, "reason", reason, "turn_count", window.TurnCount)
+		// 简短的对话同样可能透露名字、宠物或工作，只提取事实。
+		job.Kind = types.SummaryJobKindFacts
+	} else {
+		slog.Info("chat window closed", "chat_history_id", window.ID, "reason", reason, "turn_count", window.TurnCount)
+	}
+	// 入队失败时由 SummaryWorker 的补偿扫描为已关闭的窗口补建任务。
+	return c.jobs.Enqueue(ctx, job)
+}
+
+// closeStale 关闭空闲超过 SummaryIdleAfter 或开启于今天之前的窗口，返回关闭的数量。
+func (c *windowCloser) closeStale(ctx context.Context, now time.Time) (int, error) {
+	var idleBefore, dayStart time.Time
+	if c.cfg.SummaryIdleAfter > 0 {
+		idleBefore = now.Add(-c.cfg.SummaryIdleAfter)
+	}
+	if c.cfg.SummaryEndOfDay {
+		year, month, day := now.Date()
+		dayStart = time.Date(year, month, day, 0, 0, 0, 0, now.Location())
+	}
+	windows, err := c.chatHistories.ListOpenWindows(ctx, idleBefore, dayStart)
+	if err != nil {
+		return 0, err
+	}
+	for i := range windows {
+		reason := closeIdle
+		if !dayStart.IsZero() && windows[i].CreatedAt.Before(dayStart) {
+			reason = closeEndOfDay
+		}
+		if err := c.close(ctx, &windows[i], reason); err != nil {
+			return i, err
+		}
+	}
+	return len(windows), nil
+}
+
+// sessionService 在会话被删除时关闭该会话的记忆窗口。
+type sessionService struct {
+	session.Service
+	closer *windowCloser
+}
+
+// WithSessionEnd 包装会话服务：会话删除即视为会话结束，其记忆窗口随之关闭并摘要。
+func WithSessionEnd(inner session.Service, cfg *config.Config, chatHistories ChatHistoryRepo, jobs SummaryJobRepo) session.Service {
+	return &sessionService{
+		Service: inner,
+		closer:  &windowCloser{cfg: cfg, chatHistories: chatHistories, jobs: jobs},
+	}
+}
+
+func (s *sessionService) Delete(ctx context.Context, req *session.DeleteRequest) error {
+	if err := s.Service.Delete(ctx, req); err != nil {
+		return err
+	}
+	window, err := s.closer.chatHistories.GetLatestWindow(ctx, req.UserID, req.AppName)
+	if err != nil {
+		slog.Error("failed to load chat window of deleted session", "error", err.Error(), "session_id", req.SessionID)
+		return nil
+	}
+	if window == nil || window.ClosedAt != nil || window.SessionID != req.SessionID {
+		return nil
+	}
+	if err := s.closer.close(ctx, window, closeSessionEnd); err != nil {
+		slog.Error("failed to close chat window of deleted session", "error", err.Error(), "session_id", req.SessionID)
+	}
+	return nil
+}
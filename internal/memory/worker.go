@@ -0,0 +1,202 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/easeaico/project-her/internal/config"
+	"github.com/easeaico/project-her/internal/models"
+	"github.com/easeaico/project-her/internal/types"
+)
+
+// SummaryJobRepo 为持久化的摘要任务队列，生产实现基于 Postgres 的
+// FOR UPDATE SKIP LOCKED，可由多个副本共同消费。
+type SummaryJobRepo interface {
+	// Enqueue 为窗口创建摘要任务；窗口已有任务时不做任何事。
+	Enqueue(ctx context.Context, job types.SummaryJob) error
+	// Claim 领取一个到期的任务并租用 lease 时长，没有任务时返回 nil。
+	// 租约过期仍未完成的任务（例如进程退出）会被重新领取。
+	Claim(ctx context.Context, lease time.Duration) (*types.SummaryJob, error)
+	Complete(ctx context.Context, id int64) error
+	// Retry 记录失败原因，并在 runAt 之后重新投递任务。
+	Retry(ctx context.Context, id int64, lastError string, runAt time.Time) error
+	// Bury 将任务转入死信状态，不再重试。
+	Bury(ctx context.Context, id int64, lastError string) error
+	// EnqueueOrphans 为没有任务、轮次已达 minTurns 的未摘要窗口补建摘要任务：
+	// 窗口已关闭，或已被更新的窗口取代；并为轮次不足 minTurns 的已关闭窗口补建事实任务。
+	// 返回补建的任务数。
+	EnqueueOrphans(ctx context.Context, minTurns int) (int, error)
+}
+
+// SummaryWorker 从任务队列领取窗口并生成摘要，失败时按指数退避重试，
+// 超过最大次数后转入死信。另有定期扫描关闭空闲或跨天的窗口，并为遗漏的窗口补建任务。
+type SummaryWorker struct {
+	cfg        *config.Config
+	summarizer Summarizer
+	jobs       SummaryJobRepo
+	closer     *windowCloser
+	now        func() time.Time
+}
+
+// NewSummaryWorker 使用记忆模型构建摘要工作池。
+func NewSummaryWorker(ctx context.Context, cfg *config.Config, registry *models.Registry, memories MemoryRepo, chatHistories ChatHistoryRepo, jobs SummaryJobRepo) *SummaryWorker {
+	summarizer, err := NewMemorySummarizer(ctx, registry, chatHistories, memories, newServiceEmbedder(ctx, cfg))
+	if err != nil {
+		log.Fatalf("failed to create memory summarizer: %v", err)
+	}
+	return newSummaryWorker(cfg, summarizer, chatHistories, jobs)
+}
+
+func newSummaryWorker(cfg *config.Config, summarizer Summarizer, chatHistories ChatHistoryRepo, jobs SummaryJobRepo) *SummaryWorker {
+	return &SummaryWorker{
+		cfg:        cfg,
+		summarizer: summarizer,
+		jobs:       jobs,
+		closer:     &windowCloser{cfg: cfg, chatHistories: chatHistories, jobs: jobs},
+		now:        time.Now,
+	}
+}
+
+// Run 启动 SUMMARY_WORKERS 个消费协程与定期扫描，直到 ctx 取消。
+func (w *SummaryWorker) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for range max(w.cfg.SummaryWorkers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.consume(ctx)
+		}()
+	}
+	if w.cfg.SummaryBackfillInterval > 0 {
+		w.backfill(ctx)
+	}
+	wg.Wait()
+}
+
+// consume 持续领取任务，队列为空时等待一个轮询间隔。
+func (w *SummaryWorker) consume(ctx context.Context) {
+	ticker := time.NewTicker(max(w.cfg.SummaryPollInterval, 100*time.Millisecond))
+	defer ticker.Stop()
+	for {
+		for w.RunOnce(ctx) {
+			if ctx.Err() != nil {
+				return
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// backfill 定期关闭空闲或跨天的窗口，并为遗漏的窗口补建任务，启动时先执行一次。
+func (w *SummaryWorker) backfill(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.SummaryBackfillInterval)
+	defer ticker.Stop()
+	for {
+		w.Sweep(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep 执行一次定期扫描。
+func (w *SummaryWorker) Sweep(ctx context.Context) {
+	closed, err := w.closer.closeStale(ctx, w.now())
+	if err != nil {
+		slog.Error("failed to close stale chat windows", "error", err.Error())
+	} else if closed > 0 {
+		slog.Info("stale chat windows closed", "count", closed)
+	}
+
+	count, err := w.jobs.EnqueueOrphans(ctx, max(w.cfg.SummaryMinTurns, 1))
+	if err != nil {
+		slog.Error("failed to backfill summary jobs", "error", err.Error())
+	} else if count > 0 {
+		slog.Info("summary jobs backfilled", "count", count)
+	}
+}
+
+// RunOnce 领取并处理一个任务，返回是否领取到任务。
+func (w *SummaryWorker) RunOnce(ctx context.Context) bool {
+	timeout := w.cfg.SummaryTimeout
+	if timeout <= 0 {
+		timeout = time.Minute
+	}
+	// 租约留出余量，避免慢任务在完成前被其他副本重复领取。
+	job, err := w.jobs.Claim(ctx, 2*timeout)
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Error("failed to claim summary job", "error", err.Error())
+		}
+		return false
+	}
+	if job == nil {
+		return false
+	}
+
+	err = w.summarize(ctx, job, timeout)
+	if err == nil {
+		if err := w.jobs.Complete(ctx, job.ID); err != nil {
+			slog.Error("failed to complete summary job", "error", err.Error(), "job_id", job.ID)
+		}
+		return true
+	}
+
+	logAttrs := []any{"error", err.Error(), "job_id", job.ID, "chat_history_id", job.ChatHistoryID, "attempts", job.Attempts}
+	if job.Attempts >= max(w.cfg.SummaryMaxAttempts, 1) {
+		slog.Error("summary job moved to dead letter", logAttrs...)
+		if err := w.jobs.Bury(ctx, job.ID, err.Error()); err != nil {
+			slog.Error("failed to bury summary job", "error", err.Error(), "job_id", job.ID)
+		}
+		return true
+	}
+	delay := retryDelay(job.Attempts, w.cfg.SummaryRetryBaseDelay, w.cfg.SummaryRetryMaxDelay)
+	slog.Warn("summary job failed, retrying", append(logAttrs, "retry_in", delay)...)
+	if err := w.jobs.Retry(ctx, job.ID, err.Error(), w.now().Add(delay)); err != nil {
+		slog.Error("failed to reschedule summary job", "error", err.Error(), "job_id", job.ID)
+	}
+	return true
+}
+
+// summarize 在超时内执行摘要或事实提取，并将 panic 转为错误以便重试。
+func (w *SummaryWorker) summarize(ctx context.Context, job *types.SummaryJob, timeout time.Duration) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("summarizer panicked: %v", recovered)
+		}
+	}()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if job.Kind == types.SummaryJobKindFacts {
+		return w.summarizer.ExtractWindowFacts(ctx, job.ChatHistoryID)
+	}
+	return w.summarizer.SummarizeWindow(ctx, job.ChatHistoryID)
+}
+
+// retryDelay 返回第 attempts 次失败后的等待时间：base 按 2 的幂增长，不超过 maxDelay。
+func retryDelay(attempts int, base, maxDelay time.Duration) time.Duration {
+	if base <= 0 {
+		base = 30 * time.Second
+	}
+	delay := base
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if maxDelay > 0 && delay >= maxDelay {
+			return maxDelay
+		}
+	}
+	if maxDelay > 0 && delay > maxDelay {
+		return maxDelay
+	}
+	return delay
+}
@@ -0,0 +1,148 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/easeaico/project-her/internal/config"
+	"github.com/easeaico/project-her/internal/types"
+)
+
+type fakeSummaryJobRepo struct {
+	pending   []*types.SummaryJob
+	completed []int64
+	retried   map[int64]time.Time
+	buried    []int64
+}
+
+func (r *fakeSummaryJobRepo) Enqueue(ctx context.Context, job types.SummaryJob) error {
+	r.pending = append(r.pending, &job)
+	return nil
+}
+
+func (r *fakeSummaryJobRepo) Claim(ctx context.Context, lease time.Duration) (*types.SummaryJob, error) {
+	if len(r.pending) == 0 {
+		return nil, nil
+	}
+	job := r.pending[0]
+	r.pending = r.pending[1:]
+	job.Attempts++
+	return job, nil
+}
+
+func (r *fakeSummaryJobRepo) Complete(ctx context.Context, id int64) error {
+	r.completed = append(r.completed, id)
+	return nil
+}
+
+func (r *fakeSummaryJobRepo) Retry(ctx context.Context, id int64, lastError string, runAt time.Time) error {
+	r.retried[id] = runAt
+	return nil
+}
+
+func (r *fakeSummaryJobRepo) Bury(ctx context.Context, id int64, lastError string) error {
+	r.buried = append(r.buried, id)
+	return nil
+}
+
+func (r *fakeSummaryJobRepo) EnqueueOrphans(ctx context.Context, minTurns int) (int, error) {
+	return 0, nil
+}
+
+type fakeSummarizer struct {
+	failures map[int]error
+	windows  []int
+	facts    []int
+}
+
+func (s *fakeSummarizer) SummarizeWindow(ctx context.Context, windowID int) error {
+	s.windows = append(s.windows, windowID)
+	if windowID == 3 {
+		panic("boom")
+	}
+	return s.failures[windowID]
+}
+
+func (s *fakeSummarizer) ExtractWindowFacts(ctx context.Context, windowID int) error {
+	s.facts = append(s.facts, windowID)
+	return s.failures[windowID]
+}
+
+func TestSummaryWorkerRetriesAndBuriesFailedJobs(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	jobs := &fakeSummaryJobRepo{
+		pending: []*types.SummaryJob{
+			{ID: 1, ChatHistoryID: 1},
+			{ID: 2, ChatHistoryID: 2, Attempts: 1},
+			{ID: 3, ChatHistoryID: 3, Attempts: 2},
+			{ID: 4, ChatHistoryID: 4, Kind: types.SummaryJobKindFacts},
+		},
+		retried: map[int64]time.Time{},
+	}
+	summarizer := &fakeSummarizer{failures: map[int]error{2: errors.New("model unavailable")}}
+	cfg := &config.Config{SummaryMaxAttempts: 3, SummaryRetryBaseDelay: time.Minute, SummaryRetryMaxDelay: time.Hour}
+	worker := newSummaryWorker(cfg, summarizer, &fakeChatHistoryRepo{}, jobs)
+	worker.now = func() time.Time { return now }
+
+	for worker.RunOnce(context.Background()) {
+	}
+
+	if !slices.Equal(jobs.completed, []int64{1, 4}) {
+		t.Fatalf("expected jobs 1 and 4 to complete, got %v", jobs.completed)
+	}
+	// 事实任务只提取事实，不摘要。
+	if !slices.Equal(summarizer.facts, []int{4}) || slices.Contains(summarizer.windows, 4) {
+		t.Fatalf("expected job 4 to extract facts only, got facts %v / summaries %v", summarizer.facts, summarizer.windows)
+	}
+	// 第二次失败后等待 base*2。
+	if runAt, ok := jobs.retried[2]; !ok || !runAt.Equal(now.Add(2*time.Minute)) {
+		t.Fatalf("expected job 2 to be retried after backoff, got %v", jobs.retried)
+	}
+	if len(jobs.buried) != 1 || jobs.buried[0] != 3 {
+		t.Fatalf("expected panicking job on its last attempt to be buried, got %v", jobs.buried)
+	}
+}
+
+func TestRetryDelayIsCapped(t *testing.T) {
+	base, maxDelay := 30*time.Second, 5*time.Minute
+	for attempts, want := range map[int]time.Duration{1: 30 * time.Second, 2: time.Minute, 4: 4 * time.Minute, 5: 5 * time.Minute, 50: 5 * time.Minute} {
+		if got := retryDelay(attempts, base, maxDelay); got != want {
+			t.Fatalf("attempt %d: expected %v, got %v", attempts, want, got)
+		}
+	}
+}
+
+func TestSweepClosesIdleAndPreviousDayWindows(t *testing.T) {
+	now := time.Date(2026, 1, 2, 9, 0, 0, 0, time.UTC)
+	histories := &fakeChatHistoryRepo{open: []types.ChatHistory{
+		{ID: 1, UserID: "u1", AppName: "a", TurnCount: 12, CreatedAt: now.Add(-2 * time.Hour)},
+		{ID: 2, UserID: "u2", AppName: "a", TurnCount: 2, CreatedAt: now.Add(-3 * time.Hour)},
+		{ID: 3, UserID: "u3", AppName: "a", TurnCount: 8, CreatedAt: now.Add(-12 * time.Hour)},
+	}}
+	jobs := &fakeSummaryJobRepo{}
+	cfg := &config.Config{SummaryIdleAfter: 30 * time.Minute, SummaryEndOfDay: true, SummaryMinTurns: 6}
+	worker := newSummaryWorker(cfg, &fakeSummarizer{}, histories, jobs)
+	worker.now = func() time.Time { return now }
+
+	worker.Sweep(context.Background())
+
+	if !histories.idleBefore.Equal(now.Add(-30*time.Minute)) || !histories.dayStart.Equal(time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected sweep bounds %v / %v", histories.idleBefore, histories.dayStart)
+	}
+	if len(histories.closed) != 3 {
+		t.Fatalf("expected every stale window to be closed, got %v", histories.closed)
+	}
+	// 过短的窗口不摘要，只提取事实。
+	kinds := make(map[int]string)
+	for _, job := range jobs.pending {
+		kinds[job.ChatHistoryID] = job.Kind
+	}
+	if len(kinds) != 3 || kinds[1] != types.SummaryJobKindSummary || kinds[2] != types.SummaryJobKindFacts || kinds[3] != types.SummaryJobKindSummary {
+		t.Fatalf("expected summary jobs for windows 1 and 3 and a facts job for window 2, got %v", kinds)
+	}
+}
+
+var _ SummaryJobRepo = (*fakeSummaryJobRepo)(nil)
@@ -0,0 +1,445 @@
+package models
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"strings"
+
+	"google.golang.org/adk/model"
+	"google.golang.org/genai"
+)
+
+const (
+	anthropicDefaultBaseURL = "https://api.anthropic.com"
+	anthropicAPIVersion     = "2023-06-01"
+	// anthropicRedactedThinkingMIME 标记承载 redacted_thinking 加密内容的 Thought part。
+	anthropicRedactedThinkingMIME = "application/vnd.anthropic.redacted-thinking"
+)
+
+// anthropicModel 直接调用 Anthropic Messages API，不经过 OpenAI 兼容层，
+// 以便使用原生的系统提示、工具调用与图片输入。
+type anthropicModel struct {
+	name       string
+	apiKey     string
+	baseURL    string
+	headers    http.Header
+	httpClient *http.Client
+	userAgent  string
+}
+
+// NewAnthropicModel 创建 Anthropic Messages API 的适配器，cfg.HTTPOptions.BaseURL 可指向代理网关。
+func NewAnthropicModel(ctx context.Context, modelName string, cfg *genai.ClientConfig) (model.LLM, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("config cannot be nil")
+	}
+	if cfg.APIKey == "" && strings.TrimSpace(cfg.HTTPOptions.BaseURL) == "" {
+		return nil, fmt.Errorf("API key is required when using the default Anthropic endpoint")
+	}
+	if modelName == "" {
+		return nil, fmt.Errorf("model name cannot be empty")
+	}
+
+	baseURL := strings.TrimRight(strings.TrimSpace(cfg.HTTPOptions.BaseURL), "/")
+	if baseURL == "" {
+		baseURL = anthropicDefaultBaseURL
+	}
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &anthropicModel{
+		name:       modelName,
+		apiKey:     cfg.APIKey,
+		baseURL:    baseURL,
+		headers:    cfg.HTTPOptions.Headers.Clone(),
+		httpClient: httpClient,
+		userAgent: fmt.Sprintf("anthropic-go/%s go/%s",
+			"1.0.0", strings.TrimPrefix(runtime.Version(), "go")),
+	}, nil
+}
+
+func (m *anthropicModel) Name() string {
+	return m.name
+}
+
+func (m *anthropicModel) GenerateContent(ctx context.Context, req *model.LLMRequest, stream bool) iter.Seq2[*model.LLMResponse, error] {
+	if stream {
+		return m.generateStream(ctx, req)
+	}
+	return func(yield func(*model.LLMResponse, error) bool) {
+		resp, err := m.generate(ctx, req)
+		yield(resp, err)
+	}
+}
+
+// anthropicResponse 为 Messages API 的非流式响应。
+type anthropicResponse struct {
+	Role       string           `json:"role"`
+	Content    []anthropicBlock `json:"content"`
+	StopReason string           `json:"stop_reason"`
+	Usage      anthropicUsage   `json:"usage"`
+}
+
+type anthropicUsage struct {
+	InputTokens              int64 `json:"input_tokens"`
+	OutputTokens             int64 `json:"output_tokens"`
+	CacheReadInputTokens     int64 `json:"cache_read_input_tokens"`
+	CacheCreationInputTokens int64 `json:"cache_creation_input_tokens"`
+}
+
+// anthropicAPIError 为 Messages API 返回的错误，流中途的 error 事件没有 HTTP 状态码，按错误类型换算。
+type anthropicAPIError struct {
+	StatusCode int
+	Type       string
+	Message    string
+}
+
+func (e *anthropicAPIError) Error() string {
+	return fmt.Sprintf("anthropic API error (status %d, %s): %s", e.StatusCode, e.Type, e.Message)
+}
+
+type anthropicErrorBody struct {
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (m *anthropicModel) generate(ctx context.Context, req *model.LLMRequest) (*model.LLMResponse, error) {
+	body, err := m.do(ctx, req, false)
+	if err != nil {
+		slog.Error("failed to call llm API", "model", m.name, "error", err.Error())
+		return nil, fmt.Errorf("failed to call llm API: %w", err)
+	}
+	defer body.Close()
+
+	var resp anthropicResponse
+	if err := json.NewDecoder(body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to decode anthropic response: %w", err)
+	}
+
+	content := &genai.Content{Role: "model", Parts: []*genai.Part{}}
+	for _, block := range resp.Content {
+		switch block.Type {
+		case "thinking", "redacted_thinking":
+			if part := anthropicThoughtPart(block); part != nil {
+				content.Parts = append(content.Parts, part)
+			}
+		case "text":
+			if block.Text != "" {
+				content.Parts = append(content.Parts, &genai.Part{Text: block.Text})
+			}
+		case "tool_use":
+			content.Parts = append(content.Parts, &genai.Part{
+				FunctionCall: &genai.FunctionCall{
+					ID:   block.ID,
+					Name: block.Name,
+					Args: parseFunctionArgs(string(block.Input)),
+				},
+			})
+		}
+	}
+
+	return &model.LLMResponse{
+		Content:       content,
+		UsageMetadata: convertAnthropicUsage(resp.Usage),
+	}, nil
+}
+
+// anthropicStreamEvent 覆盖 SSE 中用到的各类事件字段。
+type anthropicStreamEvent struct {
+	Type         string             `json:"type"`
+	Index        int64              `json:"index"`
+	Message      *anthropicResponse `json:"message"`
+	ContentBlock *anthropicBlock    `json:"content_block"`
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		Thinking    string `json:"thinking"`
+		Signature   string `json:"signature"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage *anthropicUsage `json:"usage"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (m *anthropicModel) generateStream(ctx context.Context, req *model.LLMRequest) iter.Seq2[*model.LLMResponse, error] {
+	return func(yield func(*model.LLMResponse, error) bool) {
+		body, err := m.do(ctx, req, true)
+		if err != nil {
+			slog.Error("failed to stream call llm API", "model", m.name, "error", err.Error())
+			yield(nil, fmt.Errorf("stream error: %w", err))
+			return
+		}
+		defer body.Close()
+
+		pendingTools := newToolCallAccumulator()
+		// 思考块按出现顺序聚合，签名随 signature_delta 下发，最终响应需原样保留以便回传。
+		var thinking []*anthropicBlock
+		thinkingByIndex := make(map[int64]*anthropicBlock)
+		finished := false
+		var usage anthropicUsage
+		var fullText strings.Builder
+		for event, err := range readSSEData(body) {
+			if err != nil {
+				if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+					yield(nil, fmt.Errorf("context cancelled: %w", err))
+					return
+				}
+				if !finished {
+					slog.Error("failed to stream call llm API", "model", m.name, "error", err.Error())
+					yield(nil, fmt.Errorf("stream error: %w", err))
+					return
+				}
+				slog.Warn("stream failed after stop reason", "model", m.name, "error", err.Error())
+				break
+			}
+
+			var ev anthropicStreamEvent
+			if err := json.Unmarshal(event, &ev); err != nil {
+				slog.Warn("skipping malformed stream event", "model", m.name, "error", err.Error())
+				continue
+			}
+
+			var delta *genai.Part
+			switch ev.Type {
+			case "message_start":
+				if ev.Message != nil {
+					usage = ev.Message.Usage
+				}
+			case "content_block_start":
+				if ev.ContentBlock == nil {
+					break
+				}
+				switch ev.ContentBlock.Type {
+				case "tool_use":
+					// tool_use 的 input 以 input_json_delta 增量下发，起始块中的 input 恒为空对象。
+					pendingTools.add(ev.Index, ev.ContentBlock.ID, ev.ContentBlock.Name, "")
+				case "thinking", "redacted_thinking":
+					block := *ev.ContentBlock
+					thinking = append(thinking, &block)
+					thinkingByIndex[ev.Index] = &block
+				}
+			case "content_block_delta":
+				switch ev.Delta.Type {
+				case "text_delta":
+					if ev.Delta.Text != "" {
+						fullText.WriteString(ev.Delta.Text)
+						delta = &genai.Part{Text: ev.Delta.Text}
+					}
+				case "thinking_delta":
+					if ev.Delta.Thinking != "" {
+						if block := thinkingByIndex[ev.Index]; block != nil {
+							block.Thinking += ev.Delta.Thinking
+						}
+						delta = thoughtPart(ev.Delta.Thinking)
+					}
+				case "signature_delta":
+					if block := thinkingByIndex[ev.Index]; block != nil {
+						block.Signature += ev.Delta.Signature
+					}
+				case "input_json_delta":
+					pendingTools.add(ev.Index, "", "", ev.Delta.PartialJSON)
+				}
+			case "message_delta":
+				if ev.Delta.StopReason != "" {
+					finished = true
+				}
+				// message_delta 中的用量为累计值。
+				if ev.Usage != nil {
+					usage.OutputTokens = ev.Usage.OutputTokens
+					if ev.Usage.InputTokens > 0 {
+						usage.InputTokens = ev.Usage.InputTokens
+					}
+				}
+			case "error":
+				apiErr := &anthropicAPIError{Type: "api_error"}
+				if ev.Error != nil {
+					apiErr.Type, apiErr.Message = ev.Error.Type, ev.Error.Message
+				}
+				apiErr.StatusCode = anthropicErrorStatus(apiErr.Type)
+				slog.Error("failed to stream call llm API", "model", m.name, "error", apiErr.Error())
+				yield(nil, fmt.Errorf("stream error: %w", apiErr))
+				return
+			}
+
+			if delta != nil {
+				llmResp := &model.LLMResponse{
+					Content: &genai.Content{Role: "model", Parts: []*genai.Part{delta}},
+					Partial: true,
+				}
+				if !yield(llmResp, nil) {
+					return
+				}
+			}
+		}
+
+		if !finished {
+			slog.Debug("stream ended without stop reason", "model", m.name)
+		}
+		final := finalStreamResponse("", fullText.String(), pendingTools, convertAnthropicUsage(usage))
+		var thoughts []*genai.Part
+		for _, block := range thinking {
+			if part := anthropicThoughtPart(*block); part != nil {
+				thoughts = append(thoughts, part)
+			}
+		}
+		final.Content.Parts = append(thoughts, final.Content.Parts...)
+		yield(final, nil)
+	}
+}
+
+// anthropicThoughtPart 将 thinking / redacted_thinking 块转换为 Thought part，
+// 签名存入 ThoughtSignature，加密内容存入带专用 MIME 类型的 InlineData，供下一步原样回传。
+func anthropicThoughtPart(block anthropicBlock) *genai.Part {
+	switch block.Type {
+	case "thinking":
+		if block.Thinking == "" && block.Signature == "" {
+			return nil
+		}
+		// 签名针对原始思考文本，不能做任何裁剪。
+		part := thoughtPart(block.Thinking)
+		if block.Signature != "" {
+			part.ThoughtSignature = []byte(block.Signature)
+		}
+		return part
+	case "redacted_thinking":
+		if block.Data == "" {
+			return nil
+		}
+		return &genai.Part{
+			Thought:    true,
+			InlineData: &genai.Blob{MIMEType: anthropicRedactedThinkingMIME, Data: []byte(block.Data)},
+		}
+	default:
+		return nil
+	}
+}
+
+// do 发送 Messages API 请求，非 2xx 响应转换为 anthropicAPIError。
+func (m *anthropicModel) do(ctx context.Context, req *model.LLMRequest, stream bool) (io.ReadCloser, error) {
+	payload, err := json.Marshal(buildAnthropicRequest(req, m.name, stream))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode anthropic request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, m.baseURL+"/v1/messages", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range m.headers {
+		httpReq.Header[http.CanonicalHeaderKey(key)] = values
+	}
+	if req.Config != nil && req.Config.HTTPOptions != nil {
+		for key, values := range req.Config.HTTPOptions.Headers {
+			httpReq.Header[http.CanonicalHeaderKey(key)] = values
+		}
+	}
+	httpReq.Header.Set("content-type", "application/json")
+	httpReq.Header.Set("anthropic-version", anthropicAPIVersion)
+	httpReq.Header.Set("user-agent", m.userAgent)
+	if m.apiKey != "" {
+		httpReq.Header.Set("x-api-key", m.apiKey)
+	}
+	if stream {
+		httpReq.Header.Set("accept", "text/event-stream")
+	}
+
+	resp, err := m.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		apiErr := &anthropicAPIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(raw))}
+		var body anthropicErrorBody
+		if json.Unmarshal(raw, &body) == nil && body.Error.Type != "" {
+			apiErr.Type, apiErr.Message = body.Error.Type, body.Error.Message
+		}
+		return nil, apiErr
+	}
+	return resp.Body, nil
+}
+
+// readSSEData 逐个返回 SSE 事件的 data 内容，多行 data 以换行拼接。
+func readSSEData(r io.Reader) iter.Seq2[[]byte, error] {
+	return func(yield func([]byte, error) bool) {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64<<10), 4<<20)
+		var data []byte
+		for scanner.Scan() {
+			line := scanner.Bytes()
+			switch {
+			case len(line) == 0:
+				if len(data) > 0 {
+					if !yield(data, nil) {
+						return
+					}
+					data = nil
+				}
+			case bytes.HasPrefix(line, []byte("data:")):
+				if data != nil {
+					data = append(data, '\n')
+				}
+				data = append(data, bytes.TrimPrefix(bytes.TrimPrefix(line, []byte("data:")), []byte(" "))...)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			yield(nil, err)
+			return
+		}
+		if len(data) > 0 {
+			yield(data, nil)
+		}
+	}
+}
+
+// anthropicErrorStatus 将错误类型换算为等价的 HTTP 状态码，供重试判断使用。
+func anthropicErrorStatus(errType string) int {
+	switch errType {
+	case "overloaded_error":
+		return 529
+	case "rate_limit_error":
+		return http.StatusTooManyRequests
+	case "invalid_request_error":
+		return http.StatusBadRequest
+	case "authentication_error":
+		return http.StatusUnauthorized
+	case "permission_error":
+		return http.StatusForbidden
+	case "not_found_error":
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// convertAnthropicUsage 将 Anthropic 用量转换为 genai 用量元数据；
+// Anthropic 的 input_tokens 不含缓存读写部分，这里合并为总输入。
+func convertAnthropicUsage(usage anthropicUsage) *genai.GenerateContentResponseUsageMetadata {
+	prompt := usage.InputTokens + usage.CacheReadInputTokens + usage.CacheCreationInputTokens
+	if prompt == 0 && usage.OutputTokens == 0 {
+		return nil
+	}
+	return &genai.GenerateContentResponseUsageMetadata{
+		PromptTokenCount:        int32(prompt),
+		CachedContentTokenCount: int32(usage.CacheReadInputTokens),
+		CandidatesTokenCount:    int32(usage.OutputTokens),
+		TotalTokenCount:         int32(prompt + usage.OutputTokens),
+	}
+}
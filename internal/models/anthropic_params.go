@@ -0,0 +1,349 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"google.golang.org/adk/model"
+	"google.golang.org/genai"
+
+	"github.com/easeaico/project-her/internal/utils"
+)
+
+const (
+	// anthropicDefaultMaxTokens 为未配置 MaxOutputTokens 时的输出上限，Messages API 要求必填。
+	anthropicDefaultMaxTokens = 1024
+	// maxAnthropicImageBytes 为 Messages API 单张 base64 图片的大小上限。
+	maxAnthropicImageBytes = 5 << 20
+)
+
+// anthropicRequest 为 Messages API 的请求体。
+type anthropicRequest struct {
+	Model         string             `json:"model"`
+	System        string             `json:"system,omitempty"`
+	Messages      []anthropicMessage `json:"messages"`
+	MaxTokens     int64              `json:"max_tokens"`
+	Temperature   *float32           `json:"temperature,omitempty"`
+	TopP          *float32           `json:"top_p,omitempty"`
+	TopK          *int64             `json:"top_k,omitempty"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+	Stream        bool               `json:"stream,omitempty"`
+	Tools         []anthropicTool    `json:"tools,omitempty"`
+	Thinking      *anthropicThinking `json:"thinking,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+// anthropicBlock 覆盖请求与响应中用到的内容块：text、image、tool_use、tool_result、thinking、redacted_thinking。
+type anthropicBlock struct {
+	Type      string                `json:"type"`
+	Text      string                `json:"text,omitempty"`
+	Source    *anthropicImageSource `json:"source,omitempty"`
+	ID        string                `json:"id,omitempty"`
+	Name      string                `json:"name,omitempty"`
+	Input     json.RawMessage       `json:"input,omitempty"`
+	ToolUseID string                `json:"tool_use_id,omitempty"`
+	Content   string                `json:"content,omitempty"`
+	Thinking  string                `json:"thinking,omitempty"`
+	Signature string                `json:"signature,omitempty"`
+	Data      string                `json:"data,omitempty"`
+}
+
+type anthropicImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+type anthropicTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	InputSchema map[string]any `json:"input_schema"`
+}
+
+type anthropicThinking struct {
+	Type         string `json:"type"`
+	BudgetTokens int64  `json:"budget_tokens"`
+}
+
+// buildAnthropicRequest 将 ADK 请求映射为 Messages API 请求。
+func buildAnthropicRequest(req *model.LLMRequest, modelName string, stream bool) *anthropicRequest {
+	params := &anthropicRequest{
+		Model:     req.Model,
+		MaxTokens: anthropicDefaultMaxTokens,
+		Stream:    stream,
+	}
+	if params.Model == "" {
+		params.Model = modelName
+	}
+
+	if cfg := req.Config; cfg != nil {
+		params.System = strings.TrimSpace(utils.ExtractContentText(cfg.SystemInstruction))
+		if cfg.MaxOutputTokens > 0 {
+			params.MaxTokens = int64(cfg.MaxOutputTokens)
+		}
+		params.Temperature = cfg.Temperature
+		params.TopP = cfg.TopP
+		if cfg.TopK != nil {
+			topK := int64(*cfg.TopK)
+			params.TopK = &topK
+		}
+		// Messages API 不支持 presence/frequency penalty 与 seed，这些参数不会发送。
+		params.StopSequences = cfg.StopSequences
+		params.Tools = convertToolsToAnthropic(cfg.Tools)
+
+		// Messages API 没有 response_format，改为在系统提示中附上 schema 约束输出。
+		if format, ok := convertResponseFormat(cfg); ok {
+			params.System = appendSystemNote(params.System, anthropicJSONInstruction(format.OfJSONSchema != nil, cfg))
+		}
+
+		if budget, ok := anthropicThinkingBudget(cfg.ThinkingConfig); ok {
+			params.Thinking = &anthropicThinking{Type: "enabled", BudgetTokens: budget}
+			// 开启思考时 max_tokens 需大于预算，且不允许自定义采样参数。
+			if params.MaxTokens <= budget {
+				params.MaxTokens = budget + anthropicDefaultMaxTokens
+			}
+			params.Temperature, params.TopP, params.TopK = nil, nil, nil
+		}
+	}
+
+	params.Messages = convertContentsToAnthropic(req.Contents)
+	return params
+}
+
+func appendSystemNote(system, note string) string {
+	if system == "" {
+		return note
+	}
+	return system + "\n\n" + note
+}
+
+func anthropicJSONInstruction(hasSchema bool, cfg *genai.GenerateContentConfig) string {
+	if hasSchema {
+		if schema, _ := responseJSONSchema(cfg); schema != nil {
+			if raw, err := json.Marshal(schema); err == nil {
+				return "Respond with a single JSON object that matches this JSON schema, without any other text:\n" + string(raw)
+			}
+		}
+	}
+	return "Respond with a single valid JSON object, without any other text."
+}
+
+// anthropicThinkingBudget 将 genai 思考配置换算为 extended thinking 的 token 预算（最小 1024）。
+func anthropicThinkingBudget(cfg *genai.ThinkingConfig) (int64, bool) {
+	effort, ok := convertReasoningEffort(cfg)
+	if !ok {
+		return 0, false
+	}
+	if cfg.ThinkingLevel == "" && cfg.ThinkingBudget != nil && *cfg.ThinkingBudget > 0 {
+		return max(int64(*cfg.ThinkingBudget), 1024), true
+	}
+	switch effort {
+	case "high":
+		return 16384, true
+	case "medium":
+		return 4096, true
+	default:
+		return 1024, true
+	}
+}
+
+// convertToolsToAnthropic 将函数声明转换为 Messages API 的工具定义。
+func convertToolsToAnthropic(tools []*genai.Tool) []anthropicTool {
+	var result []anthropicTool
+	for _, t := range tools {
+		if t == nil {
+			continue
+		}
+		for _, fn := range t.FunctionDeclarations {
+			if fn == nil {
+				continue
+			}
+			var schema map[string]any
+			if params := convertFunctionParameters(fn); params != nil {
+				schema = params
+			} else if fn.Parameters != nil {
+				schema = convertSchemaProperty(genaiSchemaToJSONSchema(fn.Parameters))
+			}
+			// input_schema 必填且根节点必须为对象。
+			if schema == nil {
+				schema = map[string]any{}
+			}
+			schema["type"] = "object"
+			result = append(result, anthropicTool{
+				Name:        fn.Name,
+				Description: fn.Description,
+				InputSchema: schema,
+			})
+		}
+	}
+	return result
+}
+
+// convertContentsToAnthropic 将 genai.Content 转换为严格交替的 user/assistant 消息。
+// FunctionCall 转为 tool_use 块，FunctionResponse 转为紧随其后的 user 消息中的 tool_result 块。
+func convertContentsToAnthropic(contents []*genai.Content) []anthropicMessage {
+	var messages []anthropicMessage
+	calls := &toolCallTracker{}
+
+	for _, content := range contents {
+		if content == nil {
+			continue
+		}
+		role := "user"
+		if content.Role == genai.RoleModel || content.Role == "assistant" {
+			role = "assistant"
+		}
+
+		var blocks []anthropicBlock
+		var results []anthropicBlock
+		for _, part := range content.Parts {
+			switch {
+			case part == nil:
+			case part.Thought:
+				// 开启 extended thinking 时，tool_use 之前的签名思考块必须原样回传，否则 tool_result 会被拒绝。
+				if block, ok := anthropicThinkingBlock(part); ok && role == "assistant" {
+					blocks = append(blocks, block)
+				}
+			case part.FunctionCall != nil:
+				args, err := json.Marshal(part.FunctionCall.Args)
+				if err != nil || part.FunctionCall.Args == nil {
+					args = []byte("{}")
+				}
+				blocks = append(blocks, anthropicBlock{
+					Type:  "tool_use",
+					ID:    calls.register(part.FunctionCall),
+					Name:  part.FunctionCall.Name,
+					Input: args,
+				})
+			case part.FunctionResponse != nil:
+				id, ok := calls.resolve(part.FunctionResponse)
+				if !ok {
+					slog.Warn("dropping function response without matching call", "name", part.FunctionResponse.Name)
+					continue
+				}
+				output, err := json.Marshal(part.FunctionResponse.Response)
+				if err != nil {
+					slog.Warn("failed to encode function response", "name", part.FunctionResponse.Name, "error", err.Error())
+					output = []byte(`{"error":"failed to encode tool result"}`)
+				}
+				results = append(results, anthropicBlock{Type: "tool_result", ToolUseID: id, Content: string(output)})
+			case part.Text != "":
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: part.Text})
+			case utils.IsImagePart(part):
+				if role != "user" {
+					blocks = append(blocks, anthropicBlock{Type: "text", Text: utils.ImageNote(part)})
+					continue
+				}
+				source, err := convertAnthropicImage(part)
+				if err != nil {
+					slog.Warn("dropping image part", "error", err.Error())
+					blocks = append(blocks, anthropicBlock{Type: "text", Text: utils.ImageNote(part)})
+					continue
+				}
+				blocks = append(blocks, anthropicBlock{Type: "image", Source: source})
+			}
+		}
+
+		// tool_result 必须位于 user 消息开头。
+		if len(results) > 0 {
+			messages = appendAnthropicMessage(messages, "user", append(results, blocks...))
+			continue
+		}
+		messages = appendAnthropicMessage(messages, role, blocks)
+	}
+
+	// Messages API 要求首条为 user 且以 user 结尾，否则无法生成回复。
+	if len(messages) == 0 || messages[0].Role != "user" {
+		messages = append([]anthropicMessage{{
+			Role:    "user",
+			Content: []anthropicBlock{{Type: "text", Text: "Handle the requests as specified in the System Instruction."}},
+		}}, messages...)
+	}
+	if messages[len(messages)-1].Role != "user" {
+		messages = append(messages, anthropicMessage{
+			Role:    "user",
+			Content: []anthropicBlock{{Type: "text", Text: "Continue processing previous requests as instructed."}},
+		})
+	}
+	return messages
+}
+
+// anthropicThinkingBlock 将 Thought part 还原为 thinking 或 redacted_thinking 块；
+// 没有签名的思考内容（例如来自其他提供方）无法回传。
+func anthropicThinkingBlock(part *genai.Part) (anthropicBlock, bool) {
+	if part.InlineData != nil && part.InlineData.MIMEType == anthropicRedactedThinkingMIME {
+		return anthropicBlock{Type: "redacted_thinking", Data: string(part.InlineData.Data)}, true
+	}
+	if len(part.ThoughtSignature) == 0 {
+		return anthropicBlock{}, false
+	}
+	return anthropicBlock{Type: "thinking", Thinking: part.Text, Signature: string(part.ThoughtSignature)}, true
+}
+
+// appendAnthropicMessage 追加消息，同角色的相邻消息合并为一条。
+func appendAnthropicMessage(messages []anthropicMessage, role string, blocks []anthropicBlock) []anthropicMessage {
+	if len(blocks) == 0 {
+		return messages
+	}
+	if n := len(messages); n > 0 && messages[n-1].Role == role {
+		messages[n-1].Content = append(messages[n-1].Content, blocks...)
+		return messages
+	}
+	return append(messages, anthropicMessage{Role: role, Content: blocks})
+}
+
+// convertAnthropicImage 将图片 part 转换为 base64 或 URL 图片源。
+func convertAnthropicImage(part *genai.Part) (*anthropicImageSource, error) {
+	var data []byte
+	var mimeType string
+	switch {
+	case part.InlineData != nil:
+		data = part.InlineData.Data
+		mimeType = normalizeMIMEType(part.InlineData.MIMEType)
+	case part.FileData != nil:
+		uri := strings.TrimSpace(part.FileData.FileURI)
+		lowered := strings.ToLower(uri)
+		if strings.HasPrefix(lowered, "https://") || strings.HasPrefix(lowered, "http://") {
+			return &anthropicImageSource{Type: "url", URL: uri}, nil
+		}
+		header, encoded, found := strings.Cut(uri, ",")
+		if !found || !strings.HasPrefix(strings.ToLower(header), "data:image/") || !strings.HasSuffix(strings.ToLower(header), ";base64") {
+			return nil, fmt.Errorf("unsupported image uri %q", uri)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid image data uri: %w", err)
+		}
+		data = decoded
+		mimeType = normalizeMIMEType(strings.TrimSuffix(strings.TrimPrefix(header, "data:"), ";base64"))
+	default:
+		return nil, fmt.Errorf("part has no image data")
+	}
+
+	if len(data) == 0 {
+		return nil, fmt.Errorf("inline image is empty")
+	}
+	if len(data) > maxAnthropicImageBytes {
+		return nil, fmt.Errorf("inline image too large: %d bytes (max %d)", len(data), maxAnthropicImageBytes)
+	}
+	if mimeType == "" {
+		mimeType = normalizeMIMEType(http.DetectContentType(data))
+	}
+	if !supportedImageMIMETypes[mimeType] {
+		return nil, fmt.Errorf("unsupported image mime type %q", mimeType)
+	}
+	return &anthropicImageSource{
+		Type:      "base64",
+		MediaType: mimeType,
+		Data:      base64.StdEncoding.EncodeToString(data),
+	}, nil
+}
@@ -0,0 +1,289 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/adk/model"
+	"google.golang.org/genai"
+)
+
+func TestAnthropicModelSendsNativeRequestAndParsesResponse(t *testing.T) {
+	var gotKey, gotVersion, gotPath string
+	var body anthropicRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotKey = r.Header.Get("X-Api-Key")
+		gotVersion = r.Header.Get("Anthropic-Version")
+		gotPath = r.URL.Path
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"role":"assistant","content":[{"type":"thinking","thinking":"想一想"},{"type":"text","text":"好的"},{"type":"tool_use","id":"toolu_2","name":"lookup","input":{"q":"猫"}}],"stop_reason":"tool_use","usage":{"input_tokens":100,"cache_read_input_tokens":20,"output_tokens":10}}`)
+	}))
+	defer server.Close()
+
+	llm, err := NewAnthropicModel(context.Background(), "claude-sonnet-4-5", &genai.ClientConfig{
+		APIKey:      "sk-ant",
+		HTTPOptions: genai.HTTPOptions{BaseURL: server.URL},
+	})
+	if err != nil {
+		t.Fatalf("failed to create model: %v", err)
+	}
+
+	req := &model.LLMRequest{
+		Config: &genai.GenerateContentConfig{
+			SystemInstruction: genai.NewContentFromText("你是小雪", "system"),
+			Tools: []*genai.Tool{{FunctionDeclarations: []*genai.FunctionDeclaration{{
+				Name:        "lookup",
+				Description: "查询资料",
+				Parameters: &genai.Schema{
+					Type:       genai.TypeObject,
+					Properties: map[string]*genai.Schema{"q": {Type: genai.TypeString}},
+				},
+			}}}},
+		},
+		Contents: []*genai.Content{
+			{Role: "user", Parts: []*genai.Part{
+				{Text: "看看这张图"},
+				{InlineData: &genai.Blob{MIMEType: "image/png", Data: []byte("\x89PNG\r\n\x1a\n")}},
+			}},
+			{Role: genai.RoleModel, Parts: []*genai.Part{
+				{Text: "思考中", Thought: true},
+				{FunctionCall: &genai.FunctionCall{ID: "toolu_1", Name: "lookup", Args: map[string]any{"q": "图"}}},
+			}},
+			{Role: "user", Parts: []*genai.Part{
+				{FunctionResponse: &genai.FunctionResponse{ID: "toolu_1", Name: "lookup", Response: map[string]any{"result": "一只猫"}}},
+			}},
+		},
+	}
+
+	var resp *model.LLMResponse
+	for r, err := range llm.GenerateContent(context.Background(), req, false) {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp = r
+	}
+
+	if gotPath != "/v1/messages" || gotKey != "sk-ant" || gotVersion != anthropicAPIVersion {
+		t.Fatalf("unexpected request metadata: path=%q key=%q version=%q", gotPath, gotKey, gotVersion)
+	}
+	if body.System != "你是小雪" || body.MaxTokens != anthropicDefaultMaxTokens {
+		t.Fatalf("unexpected system or max_tokens: %q %d", body.System, body.MaxTokens)
+	}
+	if len(body.Tools) != 1 || body.Tools[0].InputSchema["type"] != "object" {
+		t.Fatalf("unexpected tools: %+v", body.Tools)
+	}
+	if len(body.Messages) != 3 {
+		t.Fatalf("expected user/assistant/user messages, got %+v", body.Messages)
+	}
+	if img := body.Messages[0].Content[1]; img.Type != "image" || img.Source.Type != "base64" || img.Source.MediaType != "image/png" {
+		t.Fatalf("unexpected image block: %+v", img)
+	}
+	if blocks := body.Messages[1].Content; len(blocks) != 1 || blocks[0].Type != "tool_use" || blocks[0].ID != "toolu_1" {
+		t.Fatalf("expected thought dropped and tool_use kept, got %+v", blocks)
+	}
+	if result := body.Messages[2].Content[0]; result.Type != "tool_result" || result.ToolUseID != "toolu_1" || result.Content != `{"result":"一只猫"}` {
+		t.Fatalf("unexpected tool_result block: %+v", result)
+	}
+
+	parts := resp.Content.Parts
+	if len(parts) != 3 || !parts[0].Thought || parts[1].Text != "好的" || parts[2].FunctionCall == nil || parts[2].FunctionCall.Args["q"] != "猫" {
+		t.Fatalf("unexpected response parts: %+v", parts)
+	}
+	if usage := resp.UsageMetadata; usage.PromptTokenCount != 120 || usage.CachedContentTokenCount != 20 || usage.CandidatesTokenCount != 10 {
+		t.Fatalf("unexpected usage: %+v", usage)
+	}
+}
+
+func TestAnthropicModelStreamsTextAndToolUse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		events := []string{
+			`{"type":"message_start","message":{"role":"assistant","content":[],"usage":{"input_tokens":50,"output_tokens":1}}}`,
+			`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+			`{"type":"ping"}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"你"}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"好"}}`,
+			`{"type":"content_block_stop","index":0}`,
+			`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_9","name":"lookup","input":{}}}`,
+			`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"q\":"}}`,
+			`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"猫\"}"}}`,
+			`{"type":"content_block_stop","index":1}`,
+			`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":15}}`,
+			`{"type":"message_stop"}`,
+		}
+		for _, event := range events {
+			var typed struct{ Type string }
+			_ = json.Unmarshal([]byte(event), &typed)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", typed.Type, event)
+		}
+	}))
+	defer server.Close()
+
+	llm, err := NewAnthropicModel(context.Background(), "claude-haiku-4-5", &genai.ClientConfig{
+		APIKey:      "sk-ant",
+		HTTPOptions: genai.HTTPOptions{BaseURL: server.URL},
+	})
+	if err != nil {
+		t.Fatalf("failed to create model: %v", err)
+	}
+
+	var responses []*model.LLMResponse
+	for resp, err := range llm.GenerateContent(context.Background(), &model.LLMRequest{
+		Contents: []*genai.Content{genai.NewContentFromText("hi", "user")},
+	}, true) {
+		if err != nil {
+			t.Fatalf("unexpected stream error: %v", err)
+		}
+		responses = append(responses, resp)
+	}
+
+	if len(responses) != 3 {
+		t.Fatalf("expected 2 partial and 1 final response, got %d", len(responses))
+	}
+	final := responses[2]
+	if final.Partial || !final.TurnComplete {
+		t.Fatalf("expected final non-partial response, got %+v", final)
+	}
+	parts := final.Content.Parts
+	if len(parts) != 2 || parts[0].Text != "你好" {
+		t.Fatalf("unexpected final parts: %+v", parts)
+	}
+	if call := parts[1].FunctionCall; call == nil || call.ID != "toolu_9" || call.Args["q"] != "猫" {
+		t.Fatalf("unexpected tool call: %+v", parts[1])
+	}
+	if usage := final.UsageMetadata; usage.PromptTokenCount != 50 || usage.CandidatesTokenCount != 15 {
+		t.Fatalf("unexpected usage: %+v", usage)
+	}
+}
+
+func TestAnthropicModelErrorsAreRetryable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(529)
+		fmt.Fprint(w, `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`)
+	}))
+	defer server.Close()
+
+	llm, err := NewAnthropicModel(context.Background(), "claude-sonnet-4-5", &genai.ClientConfig{
+		APIKey:      "sk-ant",
+		HTTPOptions: genai.HTTPOptions{BaseURL: server.URL},
+	})
+	if err != nil {
+		t.Fatalf("failed to create model: %v", err)
+	}
+
+	for _, err := range llm.GenerateContent(context.Background(), &model.LLMRequest{}, false) {
+		var apiErr *anthropicAPIError
+		if !errors.As(err, &apiErr) || apiErr.Type != "overloaded_error" {
+			t.Fatalf("expected anthropic API error, got %v", err)
+		}
+		if !isRetryableError(err) {
+			t.Fatalf("expected overloaded error to be retryable")
+		}
+	}
+}
+
+func TestAnthropicModelReplaysSignedThinkingBeforeToolResult(t *testing.T) {
+	var requests []anthropicRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body anthropicRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		requests = append(requests, body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		events := []string{
+			`{"type":"message_start","message":{"role":"assistant","content":[],"usage":{"input_tokens":80,"output_tokens":1}}}`,
+			`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"嗯，外面还下雨吗？"}}`,
+			`{"type":"content_block_stop","index":0}`,
+			`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":12}}`,
+		}
+		if len(requests) == 1 {
+			events = []string{
+				`{"type":"message_start","message":{"role":"assistant","content":[],"usage":{"input_tokens":50,"output_tokens":1}}}`,
+				`{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":"","signature":""}}`,
+				`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"先查天气，"}}`,
+				`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":" 再回答。"}}`,
+				`{"type":"content_block_delta","index":0,"delta":{"type":"signature_delta","signature":"sig-abc"}}`,
+				`{"type":"content_block_stop","index":0}`,
+				`{"type":"content_block_start","index":1,"content_block":{"type":"redacted_thinking","data":"enc-xyz"}}`,
+				`{"type":"content_block_stop","index":1}`,
+				`{"type":"content_block_start","index":2,"content_block":{"type":"tool_use","id":"toolu_7","name":"weather","input":{}}}`,
+				`{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"{\"city\":\"上海\"}"}}`,
+				`{"type":"content_block_stop","index":2}`,
+				`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":30}}`,
+			}
+		}
+		for _, event := range events {
+			fmt.Fprintf(w, "data: %s\n\n", event)
+		}
+	}))
+	defer server.Close()
+
+	llm, err := NewAnthropicModel(context.Background(), "claude-sonnet-4-5", &genai.ClientConfig{
+		APIKey:      "sk-ant",
+		HTTPOptions: genai.HTTPOptions{BaseURL: server.URL},
+	})
+	if err != nil {
+		t.Fatalf("failed to create model: %v", err)
+	}
+	run := func(contents []*genai.Content) *model.LLMResponse {
+		t.Helper()
+		var final *model.LLMResponse
+		for resp, err := range llm.GenerateContent(context.Background(), &model.LLMRequest{
+			Config:   &genai.GenerateContentConfig{ThinkingConfig: ThinkingConfig("low")},
+			Contents: contents,
+		}, true) {
+			if err != nil {
+				t.Fatalf("unexpected stream error: %v", err)
+			}
+			final = resp
+		}
+		return final
+	}
+
+	question := genai.NewContentFromText("上海下雨了吗", "user")
+	first := run([]*genai.Content{question})
+	parts := first.Content.Parts
+	if len(parts) != 3 || string(parts[0].ThoughtSignature) != "sig-abc" || parts[0].Text != "先查天气， 再回答。" {
+		t.Fatalf("expected signed thinking part first, got %+v", parts)
+	}
+	if !parts[1].Thought || parts[1].InlineData == nil || string(parts[1].InlineData.Data) != "enc-xyz" || parts[2].FunctionCall == nil {
+		t.Fatalf("expected redacted thinking before the tool call, got %+v", parts)
+	}
+
+	run([]*genai.Content{
+		question,
+		first.Content,
+		{Role: "user", Parts: []*genai.Part{
+			{FunctionResponse: &genai.FunctionResponse{ID: "toolu_7", Name: "weather", Response: map[string]any{"rain": true}}},
+		}},
+	})
+	if len(requests) != 2 || requests[1].Thinking == nil {
+		t.Fatalf("expected a second request with thinking enabled, got %+v", requests)
+	}
+	assistant := requests[1].Messages[1]
+	if assistant.Role != "assistant" || len(assistant.Content) != 3 {
+		t.Fatalf("expected thinking, redacted thinking and tool_use blocks, got %+v", assistant)
+	}
+	if block := assistant.Content[0]; block.Type != "thinking" || block.Thinking != "先查天气， 再回答。" || block.Signature != "sig-abc" {
+		t.Fatalf("expected signed thinking block to be replayed verbatim, got %+v", block)
+	}
+	if block := assistant.Content[1]; block.Type != "redacted_thinking" || block.Data != "enc-xyz" {
+		t.Fatalf("expected redacted thinking block to be replayed, got %+v", block)
+	}
+	if block := assistant.Content[2]; block.Type != "tool_use" || block.ID != "toolu_7" {
+		t.Fatalf("expected tool_use after thinking, got %+v", block)
+	}
+	if result := requests[1].Messages[2].Content[0]; result.Type != "tool_result" || result.ToolUseID != "toolu_7" {
+		t.Fatalf("expected tool_result for toolu_7, got %+v", result)
+	}
+}
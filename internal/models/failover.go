@@ -0,0 +1,365 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/openai/openai-go/v3"
+	"google.golang.org/adk/model"
+	"google.golang.org/genai"
+)
+
+// MetadataProviderKey 为 LLMResponse.CustomMetadata 中记录实际应答提供方的键。
+const MetadataProviderKey = "model_provider"
+
+// ErrCircuitOpen 表示故障转移链中所有提供方都处于熔断状态，请求直接失败。
+var ErrCircuitOpen = errors.New("circuit open for every model provider")
+
+// FailoverOptions 控制重试、退避与熔断行为。
+type FailoverOptions struct {
+	// MaxAttempts 为单个提供方的最大尝试次数（含首次）。
+	MaxAttempts int
+	// BaseDelay/MaxDelay 为指数退避的初始与上限延迟，实际延迟带全抖动。
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// FailureThreshold 为连续失败多少次后熔断该提供方，仅用于未指定 Breaker 的提供方。
+	FailureThreshold int
+	// Cooldown 为熔断后跳过该提供方的时长，之后允许一次试探请求。
+	Cooldown time.Duration
+	// Prices 用于按实际应答的提供方估算费用，为空时不记录费用。
+	Prices PriceTable
+}
+
+// FailoverCandidate 为故障转移链中的一个提供方。
+type FailoverCandidate struct {
+	// Name 用于日志与响应元数据，通常为模型规格，例如 "xai/grok-4-fast"。
+	Name string
+	LLM  model.LLM
+	// Breaker 为该提供方的熔断器，可在多个故障转移链之间共享；为空时按 FailoverOptions 新建。
+	Breaker *CircuitBreaker
+}
+
+// failoverModel 按顺序尝试各提供方，对可重试错误做指数退避，并对持续失败的提供方熔断。
+type failoverModel struct {
+	candidates []*FailoverCandidate
+	opts       FailoverOptions
+	sleep      func(ctx context.Context, d time.Duration) error
+}
+
+// NewFailoverModel 将多个 model.LLM 组合为带重试与故障转移的 model.LLM，Name 取首个提供方。
+func NewFailoverModel(candidates []FailoverCandidate, opts FailoverOptions) (model.LLM, error) {
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("at least one model is required")
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 1
+	}
+	if opts.BaseDelay <= 0 {
+		opts.BaseDelay = 500 * time.Millisecond
+	}
+	if opts.MaxDelay < opts.BaseDelay {
+		opts.MaxDelay = opts.BaseDelay
+	}
+
+	wrapped := make([]*FailoverCandidate, 0, len(candidates))
+	for _, c := range candidates {
+		if c.LLM == nil {
+			return nil, fmt.Errorf("model %q is nil", c.Name)
+		}
+		if c.Name == "" {
+			c.Name = c.LLM.Name()
+		}
+		if c.Breaker == nil {
+			c.Breaker = NewCircuitBreaker(opts.FailureThreshold, opts.Cooldown)
+		}
+		wrapped = append(wrapped, &c)
+	}
+	return &failoverModel{candidates: wrapped, opts: opts, sleep: sleepContext}, nil
+}
+
+func (m *failoverModel) Name() string {
+	return m.candidates[0].LLM.Name()
+}
+
+func (m *failoverModel) GenerateContent(ctx context.Context, req *model.LLMRequest, stream bool) iter.Seq2[*model.LLMResponse, error] {
+	return func(yield func(*model.LLMResponse, error) bool) {
+		var lastErr error
+		tried := false
+		// 熔断状态在真正尝试某个提供方时才检查，主提供方应答时不会触碰备用提供方的熔断器。
+		for _, c := range m.candidates {
+			if !c.Breaker.allow() {
+				slog.Warn("skipping circuit-open llm provider", "provider", c.Name)
+				continue
+			}
+			tried = true
+			done, err := m.tryCandidate(ctx, c, req, stream, yield)
+			if done {
+				return
+			}
+			lastErr = err
+		}
+		if !tried {
+			// 全部熔断时直接失败，冷却结束后由半开试探恢复，避免故障期间继续压垮提供方。
+			yield(nil, ErrCircuitOpen)
+			return
+		}
+		if lastErr == nil {
+			lastErr = fmt.Errorf("no model provider available")
+		}
+		yield(nil, fmt.Errorf("all model providers failed: %w", lastErr))
+	}
+}
+
+// tryCandidate 在单个提供方上按退避策略重试，调用前需已通过熔断检查。
+// 返回 done 表示本次请求已结束（成功、已向下游返回错误或下游停止消费），否则返回最后的错误。
+func (m *failoverModel) tryCandidate(ctx context.Context, c *FailoverCandidate, req *model.LLMRequest, stream bool, yield func(*model.LLMResponse, error) bool) (bool, error) {
+	var lastErr error
+	for attempt := 1; attempt <= m.opts.MaxAttempts; attempt++ {
+		if attempt > 1 {
+			if !c.Breaker.allow() {
+				slog.Warn("llm provider circuit opened during retries", "provider", c.Name)
+				break
+			}
+			delay := backoffDelay(m.opts.BaseDelay, m.opts.MaxDelay, attempt-1)
+			slog.Warn("retrying llm call", "provider", c.Name, "attempt", attempt, "delay", delay, "error", lastErr)
+			if err := m.sleep(ctx, delay); err != nil {
+				c.Breaker.release()
+				yield(nil, err)
+				return true, err
+			}
+		}
+
+		yielded, err := m.attempt(ctx, c, req, stream, attempt, yield)
+		if err == nil {
+			c.Breaker.success()
+			return true, nil
+		}
+		if yielded || ctx.Err() != nil {
+			// 已向下游输出过内容，重试会导致重复文本，只能原样返回错误。
+			if ctx.Err() == nil {
+				c.Breaker.failure()
+			} else {
+				c.Breaker.release()
+			}
+			yield(nil, err)
+			return true, err
+		}
+
+		c.Breaker.failure()
+		lastErr = err
+		if !isRetryableError(err) {
+			break
+		}
+	}
+	slog.Error("llm provider failed, trying next", "provider", c.Name, "error", lastErr)
+	return false, lastErr
+}
+
+// attempt 调用单个提供方，返回是否已向下游输出以及遇到的错误；下游停止消费时返回 nil。
+func (m *failoverModel) attempt(ctx context.Context, c *FailoverCandidate, req *model.LLMRequest, stream bool, attempt int, yield func(*model.LLMResponse, error) bool) (bool, error) {
+	yielded := false
+	for resp, err := range c.LLM.GenerateContent(ctx, cloneRequestFor(req, c.LLM.Name()), stream) {
+		if err != nil {
+			return yielded, err
+		}
+		if resp == nil {
+			continue
+		}
+		if resp.CustomMetadata == nil {
+			resp.CustomMetadata = make(map[string]any)
+		}
+		resp.CustomMetadata[MetadataProviderKey] = c.Name
+		if !resp.Partial {
+			m.logServed(c, attempt, resp)
+		}
+		yielded = true
+		if !yield(resp, nil) {
+			return yielded, nil
+		}
+	}
+	return yielded, nil
+}
+
+// logServed 记录应答的提供方与用量，并把估算费用写入响应元数据。
+func (m *failoverModel) logServed(c *FailoverCandidate, attempt int, resp *model.LLMResponse) {
+	attrs := []any{"provider", c.Name, "attempt", attempt, "fallback", c != m.candidates[0]}
+	if usage := resp.UsageMetadata; usage != nil {
+		attrs = append(attrs,
+			"prompt_tokens", usage.PromptTokenCount,
+			"cached_tokens", usage.CachedContentTokenCount,
+			"completion_tokens", usage.CandidatesTokenCount+usage.ThoughtsTokenCount,
+		)
+		if cost, ok := m.opts.Prices.EstimateCost(c.Name, usage); ok {
+			resp.CustomMetadata[MetadataCostKey] = cost
+			attrs = append(attrs, "estimated_cost_usd", cost)
+		}
+	}
+	slog.Info("llm response served", attrs...)
+}
+
+// cloneRequestFor 为每次尝试复制请求，避免适配器对请求的修改在提供方之间串扰。
+func cloneRequestFor(req *model.LLMRequest, modelName string) *model.LLMRequest {
+	clone := *req
+	// 不同提供方的模型名不同，必须覆盖 ADK 预先写入的主模型名。
+	clone.Model = modelName
+	clone.Contents = slices.Clone(req.Contents)
+	if req.Config != nil {
+		cfg := *req.Config
+		if req.Config.HTTPOptions != nil {
+			httpOptions := *req.Config.HTTPOptions
+			httpOptions.Headers = req.Config.HTTPOptions.Headers.Clone()
+			cfg.HTTPOptions = &httpOptions
+		}
+		clone.Config = &cfg
+	}
+	return &clone
+}
+
+// isRetryableError 判断错误是否值得在同一提供方上重试：限流、服务端错误与网络错误。
+func isRetryableError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var openaiErr *openai.Error
+	if errors.As(err, &openaiErr) {
+		return isRetryableStatus(openaiErr.StatusCode)
+	}
+	var anthropicErr *anthropicAPIError
+	if errors.As(err, &anthropicErr) {
+		return isRetryableStatus(anthropicErr.StatusCode)
+	}
+	var genaiErr genai.APIError
+	if errors.As(err, &genaiErr) {
+		return isRetryableStatus(genaiErr.Code)
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
+
+func isRetryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code == http.StatusRequestTimeout || code >= 500
+}
+
+// backoffDelay 计算带全抖动的指数退避延迟。
+func backoffDelay(base, maxDelay time.Duration, retry int) time.Duration {
+	delay := base << min(retry-1, 16)
+	if delay <= 0 || delay > maxDelay {
+		delay = maxDelay
+	}
+	return time.Duration(rand.Int64N(int64(delay)) + 1)
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// CircuitBreaker 在连续失败达到阈值后熔断，冷却结束后进入半开状态，同一时间只放行一次试探请求。
+// 可并发使用，同一提供方的所有模型实例应共享一个熔断器。
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	state     breakerState
+	failures  int
+	openUntil time.Time
+	// probing 表示半开状态下已有试探请求在进行中。
+	probing bool
+	now     func() time.Time
+}
+
+// NewCircuitBreaker 创建熔断器，threshold 为 0 时不熔断。
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+func (b *CircuitBreaker) clock() time.Time {
+	if b.now != nil {
+		return b.now()
+	}
+	return time.Now()
+}
+
+// allow 判断是否可以调用该提供方；半开状态下放行的请求即为试探，结束后必须调用
+// success、failure 或 release 之一。
+func (b *CircuitBreaker) allow() bool {
+	if b.threshold <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if b.clock().Before(b.openUntil) {
+			return false
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+		return true
+	case breakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+func (b *CircuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = breakerClosed
+	b.failures = 0
+	b.probing = false
+}
+
+func (b *CircuitBreaker) failure() {
+	if b.threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	b.failures++
+	// 半开试探失败立即重新熔断。
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openUntil = b.clock().Add(b.cooldown)
+	}
+}
+
+// release 结束一次未分出成败的调用（例如请求被取消），半开状态下允许下一个请求试探。
+func (b *CircuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
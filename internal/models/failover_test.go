@@ -0,0 +1,228 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/openai/openai-go/v3"
+	"google.golang.org/adk/model"
+	"google.golang.org/genai"
+)
+
+// stubLLM 按顺序返回预设的结果，每次调用消费一项。
+type stubLLM struct {
+	name    string
+	results [][]stubResult
+	calls   int
+	models  []string
+}
+
+type stubResult struct {
+	resp *model.LLMResponse
+	err  error
+}
+
+func (s *stubLLM) Name() string { return s.name }
+
+func (s *stubLLM) GenerateContent(ctx context.Context, req *model.LLMRequest, stream bool) iter.Seq2[*model.LLMResponse, error] {
+	s.models = append(s.models, req.Model)
+	var results []stubResult
+	if s.calls < len(s.results) {
+		results = s.results[s.calls]
+	}
+	s.calls++
+	return func(yield func(*model.LLMResponse, error) bool) {
+		for _, r := range results {
+			if !yield(r.resp, r.err) {
+				return
+			}
+		}
+	}
+}
+
+func textResponse(text string, partial bool) *model.LLMResponse {
+	return &model.LLMResponse{Content: genai.NewContentFromText(text, "model"), Partial: partial}
+}
+
+func statusError(code int) error {
+	return &openai.Error{StatusCode: code}
+}
+
+func newTestFailover(t *testing.T, opts FailoverOptions, llms ...*stubLLM) *failoverModel {
+	t.Helper()
+	var candidates []FailoverCandidate
+	for _, llm := range llms {
+		candidates = append(candidates, FailoverCandidate{Name: llm.name, LLM: llm})
+	}
+	m, err := NewFailoverModel(candidates, opts)
+	if err != nil {
+		t.Fatalf("failed to create failover model: %v", err)
+	}
+	fm := m.(*failoverModel)
+	fm.sleep = func(ctx context.Context, d time.Duration) error { return nil }
+	return fm
+}
+
+func collect(m model.LLM, stream bool) ([]*model.LLMResponse, error) {
+	var responses []*model.LLMResponse
+	for resp, err := range m.GenerateContent(context.Background(), &model.LLMRequest{Model: m.Name()}, stream) {
+		if err != nil {
+			return responses, err
+		}
+		responses = append(responses, resp)
+	}
+	return responses, nil
+}
+
+func TestFailoverRetriesThenFallsBack(t *testing.T) {
+	primary := &stubLLM{name: "grok", results: [][]stubResult{
+		{{err: statusError(http.StatusTooManyRequests)}},
+		{{err: statusError(http.StatusBadGateway)}},
+	}}
+	fallback := &stubLLM{name: "gemini", results: [][]stubResult{
+		{{resp: textResponse("hello", false)}},
+	}}
+	m := newTestFailover(t, FailoverOptions{MaxAttempts: 2}, primary, fallback)
+
+	responses, err := collect(m, false)
+	if err != nil {
+		t.Fatalf("expected fallback to succeed, got %v", err)
+	}
+	if primary.calls != 2 || fallback.calls != 1 {
+		t.Fatalf("expected 2 primary and 1 fallback calls, got %d and %d", primary.calls, fallback.calls)
+	}
+	if got := responses[0].CustomMetadata[MetadataProviderKey]; got != "gemini" {
+		t.Fatalf("expected provider metadata gemini, got %v", got)
+	}
+	if fallback.models[0] != "gemini" {
+		t.Fatalf("expected request model to be rewritten for fallback, got %q", fallback.models[0])
+	}
+}
+
+func TestFailoverSkipsRetryForClientErrors(t *testing.T) {
+	primary := &stubLLM{name: "grok", results: [][]stubResult{
+		{{err: statusError(http.StatusUnauthorized)}},
+	}}
+	m := newTestFailover(t, FailoverOptions{MaxAttempts: 3}, primary)
+
+	if _, err := collect(m, false); err == nil {
+		t.Fatalf("expected error")
+	}
+	if primary.calls != 1 {
+		t.Fatalf("expected no retry for 401, got %d calls", primary.calls)
+	}
+}
+
+func TestFailoverDoesNotRetryAfterPartialOutput(t *testing.T) {
+	streamErr := errors.New("connection reset")
+	primary := &stubLLM{name: "grok", results: [][]stubResult{
+		{{resp: textResponse("你", true)}, {err: streamErr}},
+	}}
+	fallback := &stubLLM{name: "gemini"}
+	m := newTestFailover(t, FailoverOptions{MaxAttempts: 3}, primary, fallback)
+
+	responses, err := collect(m, true)
+	if !errors.Is(err, streamErr) {
+		t.Fatalf("expected stream error to pass through, got %v", err)
+	}
+	if len(responses) != 1 || primary.calls != 1 || fallback.calls != 0 {
+		t.Fatalf("expected no retry after partial output, got %d responses, %d/%d calls", len(responses), primary.calls, fallback.calls)
+	}
+}
+
+func TestFailoverCircuitBreakerSkipsOpenProvider(t *testing.T) {
+	primary := &stubLLM{name: "grok", results: [][]stubResult{
+		{{err: statusError(http.StatusServiceUnavailable)}},
+	}}
+	fallback := &stubLLM{name: "gemini", results: [][]stubResult{
+		{{resp: textResponse("a", false)}},
+		{{resp: textResponse("b", false)}},
+	}}
+	m := newTestFailover(t, FailoverOptions{MaxAttempts: 1, FailureThreshold: 1, Cooldown: time.Minute}, primary, fallback)
+
+	if _, err := collect(m, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := collect(m, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if primary.calls != 1 {
+		t.Fatalf("expected open circuit to skip primary, got %d calls", primary.calls)
+	}
+	if fallback.calls != 2 {
+		t.Fatalf("expected fallback to serve both calls, got %d", fallback.calls)
+	}
+}
+
+func TestCircuitBreakerHalfOpenAllowsSingleProbe(t *testing.T) {
+	now := time.Now()
+	b := &CircuitBreaker{threshold: 1, cooldown: time.Minute, now: func() time.Time { return now }}
+	b.failure()
+	if b.allow() {
+		t.Fatalf("expected open breaker to reject calls")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if !b.allow() {
+		t.Fatalf("expected probe to be allowed after cooldown")
+	}
+	if b.allow() {
+		t.Fatalf("expected concurrent calls to be rejected while probing")
+	}
+	b.release()
+	if !b.allow() {
+		t.Fatalf("expected a new probe after the previous one was released")
+	}
+	b.failure()
+	if b.allow() {
+		t.Fatalf("expected failed probe to reopen the breaker")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if !b.allow() {
+		t.Fatalf("expected probe after second cooldown")
+	}
+	b.success()
+	if !b.allow() || !b.allow() {
+		t.Fatalf("expected successful probe to close the breaker")
+	}
+}
+
+func TestFailoverLeavesUnusedFallbackBreakerUntouched(t *testing.T) {
+	primary := &stubLLM{name: "grok", results: [][]stubResult{
+		{{resp: textResponse("a", false)}},
+	}}
+	fallback := &stubLLM{name: "gemini"}
+	m := newTestFailover(t, FailoverOptions{MaxAttempts: 1, FailureThreshold: 1, Cooldown: time.Minute}, primary, fallback)
+	breaker := m.candidates[1].Breaker
+	breaker.failure()
+	breaker.openUntil = time.Now().Add(-time.Second)
+
+	if _, err := collect(m, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if breaker.state != breakerOpen || breaker.probing {
+		t.Fatalf("expected idle fallback to stay open, got state %d probing %v", breaker.state, breaker.probing)
+	}
+}
+
+func TestFailoverFailsFastWhenEveryCircuitIsOpen(t *testing.T) {
+	primary := &stubLLM{name: "grok", results: [][]stubResult{
+		{{err: statusError(http.StatusServiceUnavailable)}},
+	}}
+	m := newTestFailover(t, FailoverOptions{MaxAttempts: 3, FailureThreshold: 1, Cooldown: time.Minute}, primary)
+
+	if _, err := collect(m, false); err == nil {
+		t.Fatalf("expected the first call to fail")
+	}
+	if _, err := collect(m, false); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected open circuit error, got %v", err)
+	}
+	if primary.calls != 1 {
+		t.Fatalf("expected open circuit to shed load, got %d calls", primary.calls)
+	}
+}
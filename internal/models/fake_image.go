@@ -0,0 +1,52 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// fakeImagePNG 为 1x1 透明 PNG，回放模式下所有图片都返回它。
+var fakeImagePNG = []byte{
+	0x89, 0x50, 0x4e, 0x47, 0x0d, 0x0a, 0x1a, 0x0a, 0x00, 0x00, 0x00, 0x0d,
+	0x49, 0x48, 0x44, 0x52, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01,
+	0x08, 0x06, 0x00, 0x00, 0x00, 0x1f, 0x15, 0xc4, 0x89, 0x00, 0x00, 0x00,
+	0x0d, 0x49, 0x44, 0x41, 0x54, 0x78, 0x9c, 0x63, 0x00, 0x01, 0x00, 0x00,
+	0x05, 0x00, 0x01, 0x0d, 0x0a, 0x2d, 0xb4, 0x00, 0x00, 0x00, 0x00, 0x49,
+	0x45, 0x4e, 0x44, 0xae, 0x42, 0x60, 0x82,
+}
+
+// FakeImageGenerator 不访问网络，返回固定的 PNG data URL，并记录收到的提示词。
+type FakeImageGenerator struct {
+	mu      sync.Mutex
+	prompts []string
+}
+
+// NewFakeImageGenerator 创建用于离线测试的图片生成器。
+func NewFakeImageGenerator() *FakeImageGenerator {
+	return &FakeImageGenerator{}
+}
+
+func (g *FakeImageGenerator) Generate(ctx context.Context, prompt string) (string, error) {
+	prompt = strings.TrimSpace(prompt)
+	if prompt == "" {
+		return "", fmt.Errorf("prompt cannot be empty")
+	}
+	g.mu.Lock()
+	g.prompts = append(g.prompts, prompt)
+	g.mu.Unlock()
+
+	// 以提示词哈希作为 URL 片段，不同提示词得到可区分但稳定的结果。
+	sum := sha256.Sum256([]byte(prompt))
+	return fmt.Sprintf("data:image/png;base64,%s#%x", base64.StdEncoding.EncodeToString(fakeImagePNG), sum[:4]), nil
+}
+
+// Prompts 返回已收到的提示词副本。
+func (g *FakeImageGenerator) Prompts() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]string(nil), g.prompts...)
+}
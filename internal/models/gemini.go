@@ -9,32 +9,40 @@ import (
 	"google.golang.org/genai"
 )
 
-type ImageGenerator struct {
+// ImageGenerator 根据提示词生成图片，返回可直接嵌入 Markdown 的图片 URL。
+type ImageGenerator interface {
+	Generate(ctx context.Context, prompt string) (string, error)
+}
+
+// GeminiImageGenerator 使用 Gemini 图片模型生成图片。
+type GeminiImageGenerator struct {
 	client      *genai.Client
 	model       string
 	aspectRatio string
 }
 
-func NewGeminiImageGenerator(ctx context.Context, apiKey, model, aspectRatio string) (*ImageGenerator, error) {
+// NewGeminiImageGenerator 创建 Gemini 图片生成器，baseURL 为空时使用官方地址。
+func NewGeminiImageGenerator(ctx context.Context, apiKey, baseURL, model, aspectRatio string) (*GeminiImageGenerator, error) {
 	if strings.TrimSpace(apiKey) == "" {
 		return nil, fmt.Errorf("API key is required")
 	}
 
 	client, err := genai.NewClient(ctx, &genai.ClientConfig{
-		APIKey: apiKey,
+		APIKey:      apiKey,
+		HTTPOptions: genai.HTTPOptions{BaseURL: strings.TrimSpace(baseURL)},
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create genai client: %w", err)
 	}
 
-	return &ImageGenerator{
+	return &GeminiImageGenerator{
 		client:      client,
 		model:       strings.TrimSpace(model),
 		aspectRatio: normalizeAspectRatio(aspectRatio),
 	}, nil
 }
 
-func (g *ImageGenerator) Generate(ctx context.Context, prompt string) (string, error) {
+func (g *GeminiImageGenerator) Generate(ctx context.Context, prompt string) (string, error) {
 	if g == nil || g.client == nil {
 		return "", fmt.Errorf("image generator not configured")
 	}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/openai/openai-go/v3"
+	"google.golang.org/genai"
+)
+
+// maxInlineImageBytes 为单张内联图片的大小上限，与 xAI/OpenAI 的视觉输入限制保持一致。
+const maxInlineImageBytes = 10 << 20
+
+// supportedImageMIMETypes 列出 OpenAI 兼容视觉接口普遍接受的图片格式。
+var supportedImageMIMETypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/webp": true,
+	"image/gif":  true,
+}
+
+// convertImagePart 将 InlineData/FileData 图片转换为 OpenAI image_url 内容块。
+func convertImagePart(part *genai.Part) (openai.ChatCompletionContentPartUnionParam, error) {
+	switch {
+	case part.InlineData != nil:
+		data := part.InlineData.Data
+		if len(data) == 0 {
+			return openai.ChatCompletionContentPartUnionParam{}, fmt.Errorf("inline image is empty")
+		}
+		if len(data) > maxInlineImageBytes {
+			return openai.ChatCompletionContentPartUnionParam{}, fmt.Errorf("inline image too large: %d bytes (max %d)", len(data), maxInlineImageBytes)
+		}
+		mimeType := normalizeMIMEType(part.InlineData.MIMEType)
+		if mimeType == "" {
+			mimeType = normalizeMIMEType(http.DetectContentType(data))
+		}
+		if !supportedImageMIMETypes[mimeType] {
+			return openai.ChatCompletionContentPartUnionParam{}, fmt.Errorf("unsupported image mime type %q", mimeType)
+		}
+		url := fmt.Sprintf("data:%s;base64,%s", mimeType, base64.StdEncoding.EncodeToString(data))
+		return openai.ImageContentPart(openai.ChatCompletionContentPartImageImageURLParam{URL: url}), nil
+	case part.FileData != nil:
+		uri := strings.TrimSpace(part.FileData.FileURI)
+		lowered := strings.ToLower(uri)
+		if !strings.HasPrefix(lowered, "https://") && !strings.HasPrefix(lowered, "http://") && !strings.HasPrefix(lowered, "data:image/") {
+			return openai.ChatCompletionContentPartUnionParam{}, fmt.Errorf("unsupported image uri %q", uri)
+		}
+		if mimeType := normalizeMIMEType(part.FileData.MIMEType); mimeType != "" && !supportedImageMIMETypes[mimeType] {
+			return openai.ChatCompletionContentPartUnionParam{}, fmt.Errorf("unsupported image mime type %q", mimeType)
+		}
+		return openai.ImageContentPart(openai.ChatCompletionContentPartImageImageURLParam{URL: uri}), nil
+	default:
+		return openai.ChatCompletionContentPartUnionParam{}, fmt.Errorf("part has no image data")
+	}
+}
+
+// normalizeMIMEType 去除参数并统一大小写，例如 "image/JPEG; q=1" -> "image/jpeg"。
+func normalizeMIMEType(mimeType string) string {
+	mimeType = strings.ToLower(strings.TrimSpace(mimeType))
+	if idx := strings.Index(mimeType, ";"); idx >= 0 {
+		mimeType = strings.TrimSpace(mimeType[:idx])
+	}
+	if mimeType == "image/jpg" {
+		return "image/jpeg"
+	}
+	return mimeType
+}
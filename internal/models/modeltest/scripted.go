@@ -0,0 +1,51 @@
+// Package modeltest 提供测试用的 model.LLM 替身，配合录制/回放模型在无网络环境下运行测试。
+package modeltest
+
+import (
+	"context"
+	"iter"
+	"sync"
+
+	"google.golang.org/adk/model"
+	"google.golang.org/genai"
+
+	"github.com/easeaico/project-her/internal/utils"
+)
+
+// ScriptedLLM 模拟在线模型，按系统提示返回预设回复并统计调用次数，通常只在录制阶段使用。
+type ScriptedLLM struct {
+	// Model 为 Name 返回的模型名。
+	Model string
+	// Reply 为默认回复。
+	Reply string
+	// ByInstruction 按完整的系统提示覆盖回复，用于同一模型承担多种任务的场景。
+	ByInstruction map[string]string
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (m *ScriptedLLM) Name() string { return m.Model }
+
+// Calls 返回 GenerateContent 被调用的次数。
+func (m *ScriptedLLM) Calls() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.calls
+}
+
+func (m *ScriptedLLM) GenerateContent(ctx context.Context, req *model.LLMRequest, stream bool) iter.Seq2[*model.LLMResponse, error] {
+	m.mu.Lock()
+	m.calls++
+	m.mu.Unlock()
+
+	reply := m.Reply
+	if req.Config != nil && req.Config.SystemInstruction != nil {
+		if override, ok := m.ByInstruction[utils.ExtractContentText(req.Config.SystemInstruction)]; ok {
+			reply = override
+		}
+	}
+	return func(yield func(*model.LLMResponse, error) bool) {
+		yield(&model.LLMResponse{Content: genai.NewContentFromText(reply, "model"), TurnComplete: true}, nil)
+	}
+}
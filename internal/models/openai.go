@@ -10,7 +10,6 @@ import (
 	"log/slog"
 	"net/http"
 	"runtime"
-	"sort"
 	"strings"
 
 	"github.com/openai/openai-go/v3"
@@ -26,26 +25,21 @@ type openaiModel struct {
 	versionHeaderValue string
 }
 
-type toolCallBuilder struct {
-	Index int64
-	ID    string
-	Name  string
-	Args  strings.Builder
-}
-
+// NewOpenAIModel 创建 OpenAI 的适配器，cfg.HTTPOptions.BaseURL 可指向 llama.cpp、vLLM、
+// Ollama 等自托管的兼容服务；自托管服务可不设置 API Key。
 func NewOpenAIModel(ctx context.Context, modelName string, cfg *genai.ClientConfig) (model.LLM, error) {
 	if cfg == nil {
 		return nil, fmt.Errorf("config cannot be nil")
 	}
-	if cfg.APIKey == "" {
-		return nil, fmt.Errorf("API key is required")
+	if cfg.APIKey == "" && strings.TrimSpace(cfg.HTTPOptions.BaseURL) == "" {
+		return nil, fmt.Errorf("API key is required when using the default OpenAI endpoint")
 	}
 	if modelName == "" {
 		return nil, fmt.Errorf("model name cannot be empty")
 	}
 
 	// 使用 API Key 创建 OpenAI 兼容客户端。
-	client := openai.NewClient(option.WithAPIKey(cfg.APIKey))
+	client := openai.NewClient(clientOptions(cfg, "")...)
 
 	// 创建时一次性生成 UA 头，避免每次请求重复拼接。
 	headerValue := fmt.Sprintf("openai-go/%s go/%s",
@@ -58,6 +52,42 @@ func NewOpenAIModel(ctx context.Context, modelName string, cfg *genai.ClientConf
 	}, nil
 }
 
+// clientOptions 根据 genai.ClientConfig 构建 OpenAI 客户端选项，BaseURL 为空时使用 defaultBaseURL。
+func clientOptions(cfg *genai.ClientConfig, defaultBaseURL string) []option.RequestOption {
+	// 重试与故障转移统一由 failoverModel 负责，关闭 SDK 内置重试以免次数叠加。
+	opts := []option.RequestOption{option.WithMaxRetries(0)}
+	if cfg.APIKey != "" {
+		opts = append(opts, option.WithAPIKey(cfg.APIKey))
+	} else {
+		// 无密钥的自托管服务不应收到 SDK 从 OPENAI_API_KEY 读取的默认凭证。
+		opts = append(opts, option.WithHeaderDel("authorization"))
+	}
+	baseURL := strings.TrimSpace(cfg.HTTPOptions.BaseURL)
+	if baseURL == "" {
+		baseURL = defaultBaseURL
+	}
+	if baseURL != "" {
+		opts = append(opts, option.WithBaseURL(baseURL))
+	}
+	opts = append(opts, headerOptions(cfg.HTTPOptions.Headers)...)
+	return opts
+}
+
+// headerOptions 将 http.Header 转换为逐请求生效的 OpenAI 客户端选项。
+func headerOptions(headers http.Header) []option.RequestOption {
+	var opts []option.RequestOption
+	for key, values := range headers {
+		for i, value := range values {
+			if i == 0 {
+				opts = append(opts, option.WithHeader(key, value))
+			} else {
+				opts = append(opts, option.WithHeaderAdd(key, value))
+			}
+		}
+	}
+	return opts
+}
+
 func (m *openaiModel) Name() string {
 	return m.name
 }
@@ -93,10 +123,10 @@ func (m *openaiModel) addHeaders(headers http.Header) {
 func (m *openaiModel) generate(ctx context.Context, req *model.LLMRequest) (*model.LLMResponse, error) {
 	params := buildOpenAIParams(req, m.name)
 
-	resp, err := m.client.Chat.Completions.New(ctx, *params)
+	resp, err := m.client.Chat.Completions.New(ctx, *params, headerOptions(req.Config.HTTPOptions.Headers)...)
 	if err != nil {
-		slog.Error("failed to call llm API", "error", err.Error())
-		return nil, fmt.Errorf("failed to call Grok API: %w", err)
+		slog.Error("failed to call llm API", "model", m.name, "error", err.Error())
+		return nil, fmt.Errorf("failed to call llm API: %w", err)
 	}
 
 	if resp == nil || len(resp.Choices) == 0 {
@@ -109,45 +139,38 @@ func (m *openaiModel) generate(ctx context.Context, req *model.LLMRequest) (*mod
 		Parts: []*genai.Part{},
 	}
 
+	if reasoning := extractReasoning(message.JSON.ExtraFields); reasoning != "" {
+		content.Parts = append(content.Parts, thoughtPart(reasoning))
+	}
+
 	if message.Content != "" {
 		content.Parts = append(content.Parts, &genai.Part{
 			Text: message.Content,
 		})
 	}
 
-	if len(message.ToolCalls) > 0 {
-		builder := &toolCallBuilder{}
-
-		for _, v := range message.ToolCalls {
-			// OpenAI 工具类型目前仅支持 function。
-			if v.Type == "function" {
-				if v.ID != "" {
-					builder.ID = v.ID
-				}
-
-				if v.Function.Name != "" {
-					builder.Name = v.Function.Name
-				}
-
-				if v.Function.Arguments != "" {
-					builder.Args.WriteString(v.Function.Arguments)
-				}
-			}
+	// 并行调用需逐个转换为独立的 FunctionCall，保留各自的 ID。
+	for i, v := range message.ToolCalls {
+		// OpenAI 工具类型目前仅支持 function。
+		if v.Type != "function" || v.Function.Name == "" {
+			continue
 		}
-
-		if builder.ID != "" && builder.Name != "" {
-			content.Parts = append(content.Parts, &genai.Part{
-				FunctionCall: &genai.FunctionCall{
-					ID:   builder.ID,
-					Name: builder.Name,
-					Args: parseFunctionArgs(builder.Args.String()),
-				},
-			})
+		id := v.ID
+		if id == "" {
+			id = fmt.Sprintf("call_%d", i)
 		}
+		content.Parts = append(content.Parts, &genai.Part{
+			FunctionCall: &genai.FunctionCall{
+				ID:   id,
+				Name: v.Function.Name,
+				Args: parseFunctionArgs(v.Function.Arguments),
+			},
+		})
 	}
 
 	llmResp := &model.LLMResponse{
-		Content: content,
+		Content:       content,
+		UsageMetadata: convertUsage(resp.Usage),
 	}
 	return llmResp, nil
 }
@@ -159,115 +182,70 @@ func (m *openaiModel) generateStream(ctx context.Context, req *model.LLMRequest)
 			yield(nil, fmt.Errorf("invalid request parameters"))
 			return
 		}
+		// 用量在 finish_reason 之后的独立分片（choices 为空）中返回。
+		params.StreamOptions = openai.ChatCompletionStreamOptionsParam{IncludeUsage: openai.Bool(true)}
 
-		stream := m.client.Chat.Completions.NewStreaming(ctx, *params)
+		stream := m.client.Chat.Completions.NewStreaming(ctx, *params, headerOptions(req.Config.HTTPOptions.Headers)...)
 		defer func() {
 			if err := stream.Close(); err != nil {
 				slog.Error("failed to close stream", "error", err.Error())
 			}
 		}()
 
-		pendingTools := make(map[int64]*toolCallBuilder)
-		sentFinal := false
-		var fullText strings.Builder
+		pendingTools := newToolCallAccumulator()
+		finished := false
+		var usage *genai.GenerateContentResponseUsageMetadata
+		var fullText, fullThought strings.Builder
 		for stream.Next() {
 			chunk := stream.Current()
+			if u := convertUsage(chunk.Usage); u != nil {
+				usage = u
+			}
 
 			if len(chunk.Choices) == 0 {
 				continue
 			}
 			choice := chunk.Choices[0]
-			isFinished := choice.FinishReason != ""
+			if choice.FinishReason != "" {
+				finished = true
+			}
 
-			if choice.Delta.Content != "" {
-				fullText.WriteString(choice.Delta.Content)
+			// 推理增量以 Thought part 输出，便于在开发界面调试。
+			if reasoning := extractReasoning(choice.Delta.JSON.ExtraFields); reasoning != "" {
+				fullThought.WriteString(reasoning)
 				llmResp := &model.LLMResponse{
 					Content: &genai.Content{
-						Role: "model",
-						Parts: []*genai.Part{
-							{Text: choice.Delta.Content},
-						},
+						Role:  "model",
+						Parts: []*genai.Part{thoughtPart(reasoning)},
 					},
-					Partial:      true,
-					TurnComplete: isFinished && len(pendingTools) == 0,
-				}
-				if llmResp.TurnComplete {
-					sentFinal = true
+					Partial: true,
 				}
 				if !yield(llmResp, nil) {
 					return
 				}
 			}
 
-			for _, tc := range choice.Delta.ToolCalls {
-				index := tc.Index
-				builder, exists := pendingTools[index]
-				if !exists {
-					builder = &toolCallBuilder{Index: index}
-					pendingTools[index] = builder
-				}
-
-				if tc.ID != "" {
-					builder.ID = tc.ID
-				}
-				if tc.Function.Name != "" {
-					builder.Name = tc.Function.Name
-				}
-				if tc.Function.Arguments != "" {
-					builder.Args.WriteString(tc.Function.Arguments)
-				}
-			}
-
-			if isFinished && len(pendingTools) > 0 {
-				var parts []*genai.Part
-
-				var indices []int64
-				for k := range pendingTools {
-					indices = append(indices, k)
-				}
-				sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
-
-				for _, idx := range indices {
-					builder := pendingTools[idx]
-					parts = append(parts, &genai.Part{
-						FunctionCall: &genai.FunctionCall{
-							ID:   builder.ID,
-							Name: builder.Name,
-							Args: parseFunctionArgs(builder.Args.String()),
-						},
-					})
-				}
-
+			if choice.Delta.Content != "" {
+				fullText.WriteString(choice.Delta.Content)
 				llmResp := &model.LLMResponse{
 					Content: &genai.Content{
-						Role:  "model",
-						Parts: parts,
+						Role: "model",
+						Parts: []*genai.Part{
+							{Text: choice.Delta.Content},
+						},
 					},
-					Partial:      false,
-					TurnComplete: true,
+					Partial: true,
 				}
-				sentFinal = true
 				if !yield(llmResp, nil) {
 					return
 				}
 			}
 
-			if isFinished && len(pendingTools) == 0 && !sentFinal {
-				text := strings.TrimSpace(fullText.String())
-				var parts []*genai.Part
-				if text != "" {
-					parts = append(parts, &genai.Part{Text: text})
-				}
-				llmResp := &model.LLMResponse{
-					Content: &genai.Content{
-						Role:  "model",
-						Parts: parts,
-					},
-					Partial:      false,
-					TurnComplete: true,
-				}
-				sentFinal = true
-				if !yield(llmResp, nil) {
+			for _, tc := range choice.Delta.ToolCalls {
+				pendingTools.add(tc.Index, tc.ID, tc.Function.Name, tc.Function.Arguments)
+			}
+			for _, call := range pendingTools.completed() {
+				if !yield(toolCallNotice(call), nil) {
 					return
 				}
 			}
@@ -278,9 +256,53 @@ func (m *openaiModel) generateStream(ctx context.Context, req *model.LLMRequest)
 				yield(nil, fmt.Errorf("context cancelled: %w", err))
 				return
 			}
-			slog.Error("failed to stream call llm API", "error", err.Error())
-			yield(nil, fmt.Errorf("stream error: %w", err))
+			if !finished {
+				slog.Error("failed to stream call llm API", "model", m.name, "error", err.Error())
+				yield(nil, fmt.Errorf("stream error: %w", err))
+				return
+			}
+			// 回复已完整，仅丢失了用量分片，不应让整轮对话失败。
+			slog.Warn("stream failed after finish reason", "model", m.name, "error", err.Error())
+		}
+
+		// 最终响应在流结束后发出，以便带上用量；部分自托管服务（llama.cpp、Ollama 等）
+		// 不会发送 FinishReason，流正常结束即视为完成。
+		if !finished {
+			slog.Debug("stream ended without finish reason", "model", m.name)
 		}
+		yield(finalStreamResponse(fullThought.String(), fullText.String(), pendingTools, usage), nil)
+	}
+}
+
+// toolCallNotice 生成提示某个工具调用参数已完整的部分响应。
+// 调用只放在元数据中而不是 FunctionCall part 里，避免 ADK 在部分事件上提前执行工具。
+func toolCallNotice(call *genai.FunctionCall) *model.LLMResponse {
+	return &model.LLMResponse{
+		// Content 不能为 nil，否则 ADK 会直接丢弃该事件。
+		Content:        &genai.Content{Role: "model"},
+		CustomMetadata: map[string]any{MetadataToolCallKey: call},
+		Partial:        true,
+	}
+}
+
+// finalStreamResponse 汇总流式输出，生成包含推理、完整文本、全部工具调用与用量的最终响应。
+func finalStreamResponse(thought, text string, tools *toolCallAccumulator, usage *genai.GenerateContentResponseUsageMetadata) *model.LLMResponse {
+	var parts []*genai.Part
+	if thought = strings.TrimSpace(thought); thought != "" {
+		parts = append(parts, thoughtPart(thought))
+	}
+	if text = strings.TrimSpace(text); text != "" {
+		parts = append(parts, &genai.Part{Text: text})
+	}
+	parts = append(parts, tools.parts()...)
+	return &model.LLMResponse{
+		Content: &genai.Content{
+			Role:  "model",
+			Parts: parts,
+		},
+		UsageMetadata: usage,
+		Partial:       false,
+		TurnComplete:  true,
 	}
 }
 
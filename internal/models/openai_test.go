@@ -0,0 +1,237 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/adk/model"
+	"google.golang.org/genai"
+
+	"github.com/easeaico/project-her/internal/config"
+	"github.com/easeaico/project-her/internal/utils"
+)
+
+func TestOpenAIModelStreamsFromSelfHostedServerWithoutFinishReason(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "should-not-leak")
+
+	var gotAuth, gotHeader string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		gotHeader = r.Header.Get("X-Gateway-Token")
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, delta := range []string{"你", "好"} {
+			fmt.Fprintf(w, "data: {\"id\":\"1\",\"object\":\"chat.completion.chunk\",\"model\":\"qwen\",\"choices\":[{\"index\":0,\"delta\":{\"content\":%q}}]}\n\n", delta)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	llm, err := NewOpenAIModel(context.Background(), "qwen", &genai.ClientConfig{
+		HTTPOptions: genai.HTTPOptions{
+			BaseURL: server.URL,
+			Headers: http.Header{"X-Gateway-Token": []string{"lan"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("expected keyless model for custom base URL, got %v", err)
+	}
+
+	var responses []*model.LLMResponse
+	for resp, err := range llm.GenerateContent(context.Background(), &model.LLMRequest{
+		Contents: []*genai.Content{genai.NewContentFromText("hi", "user")},
+	}, true) {
+		if err != nil {
+			t.Fatalf("unexpected stream error: %v", err)
+		}
+		responses = append(responses, resp)
+	}
+
+	if gotAuth != "" {
+		t.Fatalf("expected no authorization header, got %q", gotAuth)
+	}
+	if gotHeader != "lan" {
+		t.Fatalf("expected extra header to be sent, got %q", gotHeader)
+	}
+	if len(responses) != 3 {
+		t.Fatalf("expected 2 partial and 1 final response, got %d", len(responses))
+	}
+	final := responses[len(responses)-1]
+	if final.Partial || !final.TurnComplete {
+		t.Fatalf("expected final non-partial response, got %+v", final)
+	}
+	if got := final.Content.Parts[0].Text; got != "你好" {
+		t.Fatalf("expected aggregated text, got %q", got)
+	}
+}
+
+func TestNewOpenAIModelRequiresKeyForDefaultEndpoint(t *testing.T) {
+	if _, err := NewOpenAIModel(context.Background(), "gpt-4o", &genai.ClientConfig{}); err == nil {
+		t.Fatalf("expected error without API key and base URL")
+	}
+}
+
+func TestOpenAIModelStreamReportsUsageAfterFinishReason(t *testing.T) {
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"id\":\"1\",\"object\":\"chat.completion.chunk\",\"model\":\"grok-4-fast\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"嗨\"},\"finish_reason\":\"stop\"}]}\n\n")
+		fmt.Fprint(w, "data: {\"id\":\"1\",\"object\":\"chat.completion.chunk\",\"model\":\"grok-4-fast\",\"choices\":[],\"usage\":{\"prompt_tokens\":1200,\"completion_tokens\":30,\"total_tokens\":1230,\"prompt_tokens_details\":{\"cached_tokens\":1000},\"completion_tokens_details\":{\"reasoning_tokens\":10}}}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	llm, err := NewOpenAIModel(context.Background(), "grok-4-fast", &genai.ClientConfig{
+		HTTPOptions: genai.HTTPOptions{BaseURL: server.URL},
+	})
+	if err != nil {
+		t.Fatalf("failed to create model: %v", err)
+	}
+
+	var final *model.LLMResponse
+	for resp, err := range llm.GenerateContent(context.Background(), &model.LLMRequest{
+		Contents: []*genai.Content{genai.NewContentFromText("hi", "user")},
+	}, true) {
+		if err != nil {
+			t.Fatalf("unexpected stream error: %v", err)
+		}
+		final = resp
+	}
+
+	if opts, _ := body["stream_options"].(map[string]any); opts["include_usage"] != true {
+		t.Fatalf("expected stream_options.include_usage, got %#v", body["stream_options"])
+	}
+	usage := final.UsageMetadata
+	if final.Partial || usage == nil {
+		t.Fatalf("expected final response with usage, got %+v", final)
+	}
+	if usage.PromptTokenCount != 1200 || usage.CachedContentTokenCount != 1000 || usage.CandidatesTokenCount != 20 || usage.ThoughtsTokenCount != 10 || usage.TotalTokenCount != 1230 {
+		t.Fatalf("unexpected usage %+v", usage)
+	}
+
+	// 200 未缓存输入 × 0.20 + 1000 缓存输入 × 0.05 + 30 输出 × 0.50，单位为美元/百万 token。
+	cost, ok := NewPriceTable(nil).EstimateCost("xai/grok-4-fast", usage)
+	if !ok || math.Abs(cost-0.000105) > 1e-12 {
+		t.Fatalf("unexpected cost %v (ok=%v)", cost, ok)
+	}
+}
+
+func TestPriceTableOverridesAndUnknownModels(t *testing.T) {
+	table := NewPriceTable(map[string]config.ModelPrice{
+		"Local/Qwen2.5": {Input: 0, Output: 0},
+		"grok-4-fast":   {Input: 1, CachedInput: 1, Output: 1},
+	})
+	if price, ok := table.Lookup("xai/grok-4-fast"); !ok || price.Input != 1 {
+		t.Fatalf("expected override to win, got %+v", price)
+	}
+	if _, ok := table.Lookup("local/qwen2.5"); !ok {
+		t.Fatalf("expected spec-keyed override to be found")
+	}
+	if price, ok := table.Lookup("openrouter/anthropic/claude-sonnet-4"); !ok || price.Output != 15 {
+		t.Fatalf("expected openrouter model to resolve by name, got %+v", price)
+	}
+	if _, ok := table.EstimateCost("local/llama3", &genai.GenerateContentResponseUsageMetadata{PromptTokenCount: 10}); ok {
+		t.Fatalf("expected unknown model to have no cost")
+	}
+}
+
+func TestOpenAIModelStreamEmitsReasoningAsThought(t *testing.T) {
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"id\":\"1\",\"object\":\"chat.completion.chunk\",\"model\":\"grok-3-mini\",\"choices\":[{\"index\":0,\"delta\":{\"reasoning_content\":\"她在撒娇，\"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"id\":\"1\",\"object\":\"chat.completion.chunk\",\"model\":\"grok-3-mini\",\"choices\":[{\"index\":0,\"delta\":{\"reasoning\":\"语气要软。\"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"id\":\"1\",\"object\":\"chat.completion.chunk\",\"model\":\"grok-3-mini\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"好呀\"},\"finish_reason\":\"stop\"}]}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	llm, err := NewOpenAIModel(context.Background(), "grok-3-mini", &genai.ClientConfig{
+		HTTPOptions: genai.HTTPOptions{BaseURL: server.URL},
+	})
+	if err != nil {
+		t.Fatalf("failed to create model: %v", err)
+	}
+
+	var responses []*model.LLMResponse
+	for resp, err := range llm.GenerateContent(context.Background(), &model.LLMRequest{
+		Config:   &genai.GenerateContentConfig{ThinkingConfig: ThinkingConfig("low")},
+		Contents: []*genai.Content{genai.NewContentFromText("陪我嘛", "user")},
+	}, true) {
+		if err != nil {
+			t.Fatalf("unexpected stream error: %v", err)
+		}
+		responses = append(responses, resp)
+	}
+
+	if body["reasoning_effort"] != "low" {
+		t.Fatalf("expected reasoning_effort to be requested, got %#v", body["reasoning_effort"])
+	}
+	if len(responses) != 4 || !responses[0].Content.Parts[0].Thought {
+		t.Fatalf("expected partial thought deltas before text, got %d responses", len(responses))
+	}
+	final := responses[len(responses)-1].Content
+	if len(final.Parts) != 2 || !final.Parts[0].Thought || final.Parts[0].Text != "她在撒娇，语气要软。" {
+		t.Fatalf("expected aggregated thought part first, got %+v", final.Parts)
+	}
+	if got := utils.ExtractContentText(final); got != "好呀" {
+		t.Fatalf("expected thoughts to be excluded from text, got %q", got)
+	}
+}
+
+func TestOpenAIModelStreamSurfacesToolCallsAsTheyComplete(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, delta := range []string{
+			`{"index":0,"id":"call_a","type":"function","function":{"name":"weather","arguments":"{\"city\":"}}`,
+			`{"index":0,"function":{"arguments":"\"上海\"}"}}`,
+			`{"index":1,"id":"call_b","type":"function","function":{"name":"clock","arguments":"{}"}}`,
+		} {
+			fmt.Fprintf(w, "data: {\"id\":\"1\",\"object\":\"chat.completion.chunk\",\"model\":\"grok-4-fast\",\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[%s]}}]}\n\n", delta)
+		}
+		fmt.Fprint(w, "data: {\"id\":\"1\",\"object\":\"chat.completion.chunk\",\"model\":\"grok-4-fast\",\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"tool_calls\"}]}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	llm, err := NewOpenAIModel(context.Background(), "grok-4-fast", &genai.ClientConfig{
+		HTTPOptions: genai.HTTPOptions{BaseURL: server.URL},
+	})
+	if err != nil {
+		t.Fatalf("failed to create model: %v", err)
+	}
+
+	var responses []*model.LLMResponse
+	for resp, err := range llm.GenerateContent(context.Background(), &model.LLMRequest{
+		Contents: []*genai.Content{genai.NewContentFromText("上海几点了，天气怎样", "user")},
+	}, true) {
+		if err != nil {
+			t.Fatalf("unexpected stream error: %v", err)
+		}
+		responses = append(responses, resp)
+	}
+
+	if len(responses) != 3 {
+		t.Fatalf("expected 2 tool call notices and 1 final response, got %d", len(responses))
+	}
+	for i, id := range []string{"call_a", "call_b"} {
+		notice := responses[i]
+		call, _ := notice.CustomMetadata[MetadataToolCallKey].(*genai.FunctionCall)
+		if !notice.Partial || call == nil || call.ID != id {
+			t.Fatalf("expected partial notice for %s, got %+v", id, notice)
+		}
+		if len(notice.Content.Parts) != 0 {
+			t.Fatalf("expected notice without executable parts, got %+v", notice.Content.Parts)
+		}
+	}
+	final := responses[2].Content.Parts
+	if len(final) != 2 || final[0].FunctionCall.ID != "call_a" || final[1].FunctionCall.ID != "call_b" {
+		t.Fatalf("expected both calls in final response, got %+v", final)
+	}
+}
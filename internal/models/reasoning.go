@@ -0,0 +1,86 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/openai/openai-go/v3"
+	"github.com/openai/openai-go/v3/packages/respjson"
+	"google.golang.org/genai"
+)
+
+// reasoningFields 为兼容服务返回推理内容的字段名：xAI、DeepSeek、vLLM 使用
+// reasoning_content，OpenRouter 使用 reasoning。
+var reasoningFields = []string{"reasoning_content", "reasoning"}
+
+// extractReasoning 从 SDK 未声明的额外字段中取出推理文本。
+func extractReasoning(fields map[string]respjson.Field) string {
+	for _, name := range reasoningFields {
+		// 额外字段不会通过类型校验，Valid() 恒为 false，只能直接读取原始 JSON。
+		field, ok := fields[name]
+		if !ok || field.Raw() == "" || field.Raw() == respjson.Null {
+			continue
+		}
+		var text string
+		if err := json.Unmarshal([]byte(field.Raw()), &text); err == nil && text != "" {
+			return text
+		}
+	}
+	return ""
+}
+
+// thoughtPart 构造思考内容 part，仅用于调试展示，不进入记忆与用户可见文本。
+func thoughtPart(text string) *genai.Part {
+	return &genai.Part{Text: text, Thought: true}
+}
+
+// ThinkingConfig 将配置中的推理强度（minimal、low、medium、high）转换为 genai 的思考配置，
+// 为空或无法识别时返回 nil，即不向模型请求推理。
+func ThinkingConfig(effort string) *genai.ThinkingConfig {
+	var level genai.ThinkingLevel
+	switch strings.ToLower(strings.TrimSpace(effort)) {
+	case "minimal":
+		level = genai.ThinkingLevelMinimal
+	case "low":
+		level = genai.ThinkingLevelLow
+	case "medium":
+		level = genai.ThinkingLevelMedium
+	case "high":
+		level = genai.ThinkingLevelHigh
+	default:
+		return nil
+	}
+	return &genai.ThinkingConfig{IncludeThoughts: true, ThinkingLevel: level}
+}
+
+// convertReasoningEffort 将 genai 思考配置映射为 OpenAI 的 reasoning_effort；
+// 未设置级别时按思考预算粗略换算，预算为 0（关闭思考）或未配置时不发送该参数。
+func convertReasoningEffort(cfg *genai.ThinkingConfig) (openai.ReasoningEffort, bool) {
+	if cfg == nil {
+		return "", false
+	}
+	switch cfg.ThinkingLevel {
+	case genai.ThinkingLevelMinimal:
+		return openai.ReasoningEffortMinimal, true
+	case genai.ThinkingLevelLow:
+		return openai.ReasoningEffortLow, true
+	case genai.ThinkingLevelMedium:
+		return openai.ReasoningEffortMedium, true
+	case genai.ThinkingLevelHigh:
+		return openai.ReasoningEffortHigh, true
+	}
+	if cfg.ThinkingBudget == nil || *cfg.ThinkingBudget == 0 {
+		return "", false
+	}
+	switch budget := *cfg.ThinkingBudget; {
+	case budget < 0:
+		// -1 表示由模型自行决定，对应默认强度。
+		return openai.ReasoningEffortMedium, true
+	case budget <= 1024:
+		return openai.ReasoningEffortLow, true
+	case budget <= 8192:
+		return openai.ReasoningEffortMedium, true
+	default:
+		return openai.ReasoningEffortHigh, true
+	}
+}
@@ -0,0 +1,304 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"google.golang.org/adk/model"
+	"google.golang.org/adk/model/gemini"
+	"google.golang.org/genai"
+
+	"github.com/easeaico/project-her/internal/config"
+)
+
+// Role 标识模型在系统中的用途，不同用途可以选择不同的提供方。
+type Role string
+
+const (
+	// RoleChat 为角色扮演主对话模型。
+	RoleChat Role = "chat"
+	// RoleMemory 为记忆摘要模型。
+	RoleMemory Role = "memory"
+	// RoleImage 为 /image 命令使用的图片模型。
+	RoleImage Role = "image"
+)
+
+// 内置提供方名称，与 config.Config.Providers 的键保持一致。
+const (
+	ProviderXAI        = "xai"
+	ProviderOpenRouter = "openrouter"
+	ProviderOpenAI     = "openai"
+	ProviderGemini     = "gemini"
+	ProviderLocal      = "local"
+	ProviderAnthropic  = "anthropic"
+)
+
+// defaultProviders 为未写提供方前缀的模型名指定默认提供方，兼容旧配置。
+var defaultProviders = map[Role]string{
+	RoleChat:   ProviderXAI,
+	RoleMemory: ProviderGemini,
+	RoleImage:  ProviderGemini,
+}
+
+// Spec 是解析后的模型描述，例如 "openrouter/anthropic/claude-sonnet-4"
+// 解析为 Provider=openrouter、Model=anthropic/claude-sonnet-4。
+type Spec struct {
+	Provider string
+	Model    string
+}
+
+func (s Spec) String() string {
+	return s.Provider + "/" + s.Model
+}
+
+// LLMFactory 根据提供方配置创建 model.LLM。
+type LLMFactory func(ctx context.Context, modelName string, provider config.ProviderConfig) (model.LLM, error)
+
+// ImageFactory 根据提供方配置创建图片生成器。
+type ImageFactory func(ctx context.Context, modelName string, provider config.ProviderConfig, aspectRatio string) (ImageGenerator, error)
+
+// Registry 按角色从配置中解析模型规格并创建对应提供方的客户端。
+type Registry struct {
+	cfg    *config.Config
+	llms   map[string]LLMFactory
+	images map[string]ImageFactory
+
+	mu sync.Mutex
+	// breakers 按模型规格共享熔断器，所有角色与智能体共用同一提供方的熔断状态。
+	breakers map[string]*CircuitBreaker
+}
+
+// NewRegistry 创建注册了内置提供方的模型注册表。
+func NewRegistry(cfg *config.Config) *Registry {
+	r := &Registry{
+		cfg:      cfg,
+		llms:     make(map[string]LLMFactory),
+		images:   make(map[string]ImageFactory),
+		breakers: make(map[string]*CircuitBreaker),
+	}
+
+	r.RegisterLLM(ProviderXAI, func(ctx context.Context, modelName string, p config.ProviderConfig) (model.LLM, error) {
+		return NewGrokModel(ctx, modelName, providerClientConfig(p))
+	})
+	r.RegisterLLM(ProviderOpenRouter, func(ctx context.Context, modelName string, p config.ProviderConfig) (model.LLM, error) {
+		return NewOpenRouterModel(ctx, modelName, providerClientConfig(p))
+	})
+	r.RegisterLLM(ProviderOpenAI, func(ctx context.Context, modelName string, p config.ProviderConfig) (model.LLM, error) {
+		return NewOpenAIModel(ctx, modelName, providerClientConfig(p))
+	})
+	r.RegisterLLM(ProviderLocal, func(ctx context.Context, modelName string, p config.ProviderConfig) (model.LLM, error) {
+		if strings.TrimSpace(p.BaseURL) == "" {
+			return nil, fmt.Errorf("base URL is required for local provider (set LOCAL_BASE_URL)")
+		}
+		return NewOpenAIModel(ctx, modelName, providerClientConfig(p))
+	})
+	r.RegisterLLM(ProviderAnthropic, func(ctx context.Context, modelName string, p config.ProviderConfig) (model.LLM, error) {
+		return NewAnthropicModel(ctx, modelName, providerClientConfig(p))
+	})
+	r.RegisterLLM(ProviderGemini, func(ctx context.Context, modelName string, p config.ProviderConfig) (model.LLM, error) {
+		return gemini.NewModel(ctx, modelName, providerClientConfig(p))
+	})
+	r.RegisterImage(ProviderGemini, func(ctx context.Context, modelName string, p config.ProviderConfig, aspectRatio string) (ImageGenerator, error) {
+		return NewGeminiImageGenerator(ctx, p.APIKey, p.BaseURL, modelName, aspectRatio)
+	})
+
+	return r
+}
+
+// RegisterLLM 注册或覆盖一个对话模型提供方。
+func (r *Registry) RegisterLLM(provider string, factory LLMFactory) {
+	r.llms[strings.ToLower(provider)] = factory
+}
+
+// RegisterImage 注册或覆盖一个图片模型提供方。
+func (r *Registry) RegisterImage(provider string, factory ImageFactory) {
+	r.images[strings.ToLower(provider)] = factory
+}
+
+// Spec 返回指定角色配置的模型规格。
+func (r *Registry) Spec(role Role) (Spec, error) {
+	var raw string
+	switch role {
+	case RoleChat:
+		raw = r.cfg.ChatModel
+	case RoleMemory:
+		raw = r.cfg.MemoryModel
+	case RoleImage:
+		raw = r.cfg.ImageModel
+	default:
+		return Spec{}, fmt.Errorf("unknown model role %q", role)
+	}
+	return ParseSpec(raw, defaultProviders[role])
+}
+
+// LLM 为指定角色创建对话模型，并包装重试与故障转移链。
+// 备用模型创建失败（例如缺少密钥）时仅记录警告，主模型创建失败则返回错误。
+func (r *Registry) LLM(ctx context.Context, role Role) (model.LLM, error) {
+	spec, err := r.Spec(role)
+	if err != nil {
+		return nil, err
+	}
+	if r.cfg.ModelFixtureMode == config.FixtureModeReplay {
+		return NewReplayModel(spec.Model, r.fixturePath(role))
+	}
+	primary, err := r.newLLM(ctx, role, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := []FailoverCandidate{{Name: spec.String(), LLM: primary, Breaker: r.breaker(spec)}}
+	for _, raw := range r.fallbacks(role) {
+		fallbackSpec, err := ParseSpec(raw, defaultProviders[role])
+		if err != nil {
+			slog.Warn("ignoring invalid fallback model", "role", role, "spec", raw, "error", err.Error())
+			continue
+		}
+		llm, err := r.newLLM(ctx, role, fallbackSpec)
+		if err != nil {
+			slog.Warn("ignoring unavailable fallback model", "role", role, "spec", raw, "error", err.Error())
+			continue
+		}
+		candidates = append(candidates, FailoverCandidate{Name: fallbackSpec.String(), LLM: llm, Breaker: r.breaker(fallbackSpec)})
+	}
+
+	llm, err := NewFailoverModel(candidates, FailoverOptions{
+		MaxAttempts: r.cfg.ModelMaxAttempts,
+		BaseDelay:   r.cfg.ModelRetryBaseDelay,
+		MaxDelay:    r.cfg.ModelRetryMaxDelay,
+		Prices:      NewPriceTable(r.cfg.ModelPrices),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if r.cfg.ModelFixtureMode == config.FixtureModeRecord {
+		return NewRecordingModel(llm, r.fixturePath(role))
+	}
+	return llm, nil
+}
+
+// breaker 返回模型规格对应的共享熔断器，首次使用时创建。
+func (r *Registry) breaker(spec Spec) *CircuitBreaker {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := spec.String()
+	breaker, ok := r.breakers[key]
+	if !ok {
+		breaker = NewCircuitBreaker(r.cfg.ModelBreakerThreshold, r.cfg.ModelBreakerCooldown)
+		r.breakers[key] = breaker
+	}
+	return breaker
+}
+
+// fixturePath 返回指定角色的录制夹具文件，每个角色一个 JSONL 文件。
+func (r *Registry) fixturePath(role Role) string {
+	return filepath.Join(r.cfg.ModelFixtureDir, string(role)+".jsonl")
+}
+
+func (r *Registry) newLLM(ctx context.Context, role Role, spec Spec) (model.LLM, error) {
+	factory, ok := r.llms[spec.Provider]
+	if !ok {
+		return nil, fmt.Errorf("unknown model provider %q for %s model (known: %s)", spec.Provider, role, strings.Join(knownProviders(r.llms), ", "))
+	}
+	llm, err := factory(ctx, spec.Model, r.cfg.Provider(spec.Provider))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s model %s: %w", role, spec, err)
+	}
+	if llm == nil {
+		return nil, fmt.Errorf("provider %q returned no %s model", spec.Provider, role)
+	}
+	return llm, nil
+}
+
+func (r *Registry) fallbacks(role Role) []string {
+	switch role {
+	case RoleChat:
+		return r.cfg.ChatModelFallbacks
+	case RoleMemory:
+		return r.cfg.MemoryModelFallbacks
+	default:
+		return nil
+	}
+}
+
+// ImageGenerator 创建 /image 命令使用的图片生成器。
+// 回放模式下返回不访问网络的 FakeImageGenerator。
+func (r *Registry) ImageGenerator(ctx context.Context) (ImageGenerator, error) {
+	if r.cfg.ModelFixtureMode == config.FixtureModeReplay {
+		return NewFakeImageGenerator(), nil
+	}
+	spec, err := r.Spec(RoleImage)
+	if err != nil {
+		return nil, err
+	}
+	factory, ok := r.images[spec.Provider]
+	if !ok {
+		return nil, fmt.Errorf("provider %q does not support image generation (known: %s)", spec.Provider, strings.Join(knownProviders(r.images), ", "))
+	}
+	generator, err := factory(ctx, spec.Model, r.cfg.Provider(spec.Provider), r.cfg.AspectRatio)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create image model %s: %w", spec, err)
+	}
+	return generator, nil
+}
+
+// ParseSpec 解析 "provider/model" 形式的模型规格。
+// 首段不是已知提供方时整体视为模型名，并使用 defaultProvider，
+// 因此 "grok-4-fast" 与 "xai/grok-4-fast" 等价（对话角色）。
+func ParseSpec(raw, defaultProvider string) (Spec, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return Spec{}, fmt.Errorf("model spec cannot be empty")
+	}
+	if provider, name, found := strings.Cut(raw, "/"); found && isBuiltinProvider(strings.ToLower(provider)) {
+		if strings.TrimSpace(name) == "" {
+			return Spec{}, fmt.Errorf("model name missing in spec %q", raw)
+		}
+		return Spec{Provider: strings.ToLower(provider), Model: strings.TrimSpace(name)}, nil
+	}
+	if defaultProvider == "" {
+		return Spec{}, fmt.Errorf("model spec %q has no provider", raw)
+	}
+	return Spec{Provider: defaultProvider, Model: raw}, nil
+}
+
+func isBuiltinProvider(name string) bool {
+	switch name {
+	case ProviderXAI, ProviderOpenRouter, ProviderOpenAI, ProviderGemini, ProviderLocal, ProviderAnthropic:
+		return true
+	default:
+		return false
+	}
+}
+
+// providerClientConfig 将提供方配置转换为各适配器共用的 genai.ClientConfig。
+func providerClientConfig(p config.ProviderConfig) *genai.ClientConfig {
+	var headers http.Header
+	if len(p.Headers) > 0 {
+		headers = make(http.Header, len(p.Headers))
+		for key, value := range p.Headers {
+			headers.Set(key, value)
+		}
+	}
+	return &genai.ClientConfig{
+		APIKey: p.APIKey,
+		HTTPOptions: genai.HTTPOptions{
+			BaseURL: strings.TrimSpace(p.BaseURL),
+			Headers: headers,
+		},
+	}
+}
+
+func knownProviders[T any](factories map[string]T) []string {
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,108 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/adk/model"
+
+	"github.com/easeaico/project-her/internal/config"
+)
+
+func TestParseSpec(t *testing.T) {
+	cases := []struct {
+		raw      string
+		fallback string
+		want     Spec
+	}{
+		{"grok-4-fast", ProviderXAI, Spec{Provider: ProviderXAI, Model: "grok-4-fast"}},
+		{"xai/grok-4-fast", ProviderGemini, Spec{Provider: ProviderXAI, Model: "grok-4-fast"}},
+		{"openrouter/anthropic/claude-sonnet-4", ProviderXAI, Spec{Provider: ProviderOpenRouter, Model: "anthropic/claude-sonnet-4"}},
+		{"Local/qwen2.5:14b", ProviderXAI, Spec{Provider: ProviderLocal, Model: "qwen2.5:14b"}},
+		{"meta-llama/llama-3", ProviderOpenRouter, Spec{Provider: ProviderOpenRouter, Model: "meta-llama/llama-3"}},
+	}
+	for _, tc := range cases {
+		got, err := ParseSpec(tc.raw, tc.fallback)
+		if err != nil {
+			t.Fatalf("ParseSpec(%q) returned error: %v", tc.raw, err)
+		}
+		if got != tc.want {
+			t.Fatalf("ParseSpec(%q) = %+v, want %+v", tc.raw, got, tc.want)
+		}
+	}
+
+	if _, err := ParseSpec("xai/", ProviderXAI); err == nil {
+		t.Fatalf("expected error for spec without model name")
+	}
+}
+
+func TestRegistryResolvesRoleProvider(t *testing.T) {
+	cfg := &config.Config{
+		ChatModel:   "openrouter/anthropic/claude-sonnet-4",
+		MemoryModel: "local/qwen2.5",
+		Providers: map[string]config.ProviderConfig{
+			ProviderOpenRouter: {APIKey: "or-key"},
+		},
+	}
+	registry := NewRegistry(cfg)
+
+	llm, err := registry.LLM(context.Background(), RoleChat)
+	if err != nil {
+		t.Fatalf("expected chat model, got error %v", err)
+	}
+	if llm.Name() != "anthropic/claude-sonnet-4" {
+		t.Fatalf("unexpected model name %q", llm.Name())
+	}
+
+	var gotProvider config.ProviderConfig
+	registry.RegisterLLM(ProviderLocal, func(ctx context.Context, modelName string, p config.ProviderConfig) (model.LLM, error) {
+		gotProvider = p
+		return &stubLLM{name: modelName}, nil
+	})
+	cfg.Providers[ProviderLocal] = config.ProviderConfig{BaseURL: "http://127.0.0.1:8080/v1"}
+	if _, err := registry.LLM(context.Background(), RoleMemory); err != nil {
+		t.Fatalf("expected overridden local factory, got %v", err)
+	}
+	if gotProvider.BaseURL != "http://127.0.0.1:8080/v1" {
+		t.Fatalf("expected provider config to be passed through, got %+v", gotProvider)
+	}
+
+	cfg.ImageModel = "xai/grok-2-image"
+	if _, err := registry.ImageGenerator(context.Background()); err == nil || !strings.Contains(err.Error(), "does not support image generation") {
+		t.Fatalf("expected unsupported image provider error, got %v", err)
+	}
+}
+
+func TestRegistrySharesBreakersAcrossModels(t *testing.T) {
+	cfg := &config.Config{ChatModel: "xai/grok-4-fast", ModelMaxAttempts: 1, ModelBreakerThreshold: 1, ModelBreakerCooldown: time.Minute}
+	registry := NewRegistry(cfg)
+	grok := &stubLLM{name: "grok-4-fast", results: [][]stubResult{
+		{{err: statusError(http.StatusServiceUnavailable)}},
+	}}
+	registry.RegisterLLM(ProviderXAI, func(ctx context.Context, modelName string, p config.ProviderConfig) (model.LLM, error) {
+		return grok, nil
+	})
+
+	first, err := registry.LLM(context.Background(), RoleChat)
+	if err != nil {
+		t.Fatalf("failed to create chat model: %v", err)
+	}
+	second, err := registry.LLM(context.Background(), RoleChat)
+	if err != nil {
+		t.Fatalf("failed to create chat model: %v", err)
+	}
+	if _, err := collect(first, false); err == nil {
+		t.Fatalf("expected the first model to fail")
+	}
+	// 第一个智能体触发的熔断对第二个智能体同样生效。
+	if _, err := collect(second, false); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected the shared breaker to be open, got %v", err)
+	}
+	if grok.calls != 1 {
+		t.Fatalf("expected one provider call, got %d", grok.calls)
+	}
+}
@@ -0,0 +1,279 @@
+package models
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+
+	"google.golang.org/adk/model"
+	"google.golang.org/genai"
+)
+
+// fixtureEntry 是 JSONL 夹具中的一行：一次请求及其完整的响应序列（含流式分片）。
+type fixtureEntry struct {
+	Hash      string               `json:"hash"`
+	Model     string               `json:"model"`
+	Stream    bool                 `json:"stream"`
+	Request   fixtureRequest       `json:"request"`
+	Responses []*model.LLMResponse `json:"responses"`
+	Error     string               `json:"error,omitempty"`
+}
+
+// fixtureRequest 是用于计算哈希的请求规范形式，同时写入夹具便于排查未命中。
+type fixtureRequest struct {
+	Model          string           `json:"model"`
+	Stream         bool             `json:"stream"`
+	System         string           `json:"system,omitempty"`
+	Contents       []fixtureContent `json:"contents"`
+	Tools          []string         `json:"tools,omitempty"`
+	ResponseMIME   string           `json:"response_mime,omitempty"`
+	ResponseSchema json.RawMessage  `json:"response_schema,omitempty"`
+}
+
+type fixtureContent struct {
+	Role  string   `json:"role"`
+	Parts []string `json:"parts"`
+}
+
+// volatileTimestamp 匹配 RFC3339 时间戳；提示词中的当前时间与记忆时间戳每次运行都不同，需屏蔽后再哈希。
+var volatileTimestamp = regexp.MustCompile(`\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:\d{2})`)
+
+// RequestHash 计算请求的稳定哈希，忽略时间戳与工具调用 ID 等每次运行都会变化的字段。
+func RequestHash(req *model.LLMRequest, stream bool) string {
+	canonical := canonicalRequest(req, stream)
+	raw, err := json.Marshal(canonical)
+	if err != nil {
+		slog.Error("failed to encode fixture request", "error", err.Error())
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])
+}
+
+func canonicalRequest(req *model.LLMRequest, stream bool) fixtureRequest {
+	canonical := fixtureRequest{Model: req.Model, Stream: stream}
+	if req.Config != nil {
+		if req.Config.SystemInstruction != nil {
+			canonical.System = canonicalParts(req.Config.SystemInstruction.Parts)[0]
+		}
+		for _, t := range req.Config.Tools {
+			if t == nil {
+				continue
+			}
+			for _, fn := range t.FunctionDeclarations {
+				canonical.Tools = append(canonical.Tools, fn.Name)
+			}
+		}
+		sort.Strings(canonical.Tools)
+		canonical.ResponseMIME = req.Config.ResponseMIMEType
+		if req.Config.ResponseSchema != nil {
+			canonical.ResponseSchema, _ = json.Marshal(req.Config.ResponseSchema)
+		}
+	}
+	for _, content := range req.Contents {
+		if content == nil {
+			continue
+		}
+		canonical.Contents = append(canonical.Contents, fixtureContent{
+			Role:  content.Role,
+			Parts: canonicalParts(content.Parts),
+		})
+	}
+	return canonical
+}
+
+// canonicalParts 将 parts 序列化为字符串，首项为拼接后的全部文本，其余为非文本 part。
+func canonicalParts(parts []*genai.Part) []string {
+	var text string
+	var others []string
+	for _, part := range parts {
+		if part == nil {
+			continue
+		}
+		switch {
+		case part.FunctionCall != nil:
+			args, _ := json.Marshal(part.FunctionCall.Args)
+			others = append(others, "call:"+part.FunctionCall.Name+":"+string(args))
+		case part.FunctionResponse != nil:
+			resp, _ := json.Marshal(part.FunctionResponse.Response)
+			others = append(others, "response:"+part.FunctionResponse.Name+":"+string(resp))
+		case part.InlineData != nil:
+			sum := sha256.Sum256(part.InlineData.Data)
+			others = append(others, "inline:"+part.InlineData.MIMEType+":"+hex.EncodeToString(sum[:8]))
+		case part.FileData != nil:
+			others = append(others, "file:"+part.FileData.MIMEType+":"+part.FileData.FileURI)
+		case part.Thought:
+			// 思考内容不影响回放匹配。
+		default:
+			text += part.Text
+		}
+	}
+	return append([]string{volatileTimestamp.ReplaceAllString(text, "<timestamp>")}, others...)
+}
+
+// recordingModel 透传调用到真实模型，并把请求与响应追加写入 JSONL 夹具。
+type recordingModel struct {
+	inner model.LLM
+	path  string
+	mu    sync.Mutex
+}
+
+// NewRecordingModel 包装 inner，将每次完整的调用记录到 path。
+func NewRecordingModel(inner model.LLM, path string) (model.LLM, error) {
+	if inner == nil {
+		return nil, fmt.Errorf("model to record cannot be nil")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create fixture dir: %w", err)
+	}
+	return &recordingModel{inner: inner, path: path}, nil
+}
+
+func (m *recordingModel) Name() string {
+	return m.inner.Name()
+}
+
+func (m *recordingModel) GenerateContent(ctx context.Context, req *model.LLMRequest, stream bool) iter.Seq2[*model.LLMResponse, error] {
+	return func(yield func(*model.LLMResponse, error) bool) {
+		// 先计算规范请求，避免适配器对 req 的修改影响哈希。
+		entry := fixtureEntry{
+			Hash:    RequestHash(req, stream),
+			Model:   req.Model,
+			Stream:  stream,
+			Request: canonicalRequest(req, stream),
+		}
+		for resp, err := range m.inner.GenerateContent(ctx, req, stream) {
+			if err != nil {
+				entry.Error = err.Error()
+				m.append(entry)
+				yield(nil, err)
+				return
+			}
+			entry.Responses = append(entry.Responses, resp)
+			if !yield(resp, nil) {
+				// 调用方拿到完整响应后提前停止消费是常见用法，仍然可以录制。
+				if resp != nil && !resp.Partial {
+					m.append(entry)
+				} else {
+					slog.Warn("not recording incomplete model response", "hash", entry.Hash)
+				}
+				return
+			}
+		}
+		m.append(entry)
+	}
+}
+
+func (m *recordingModel) append(entry fixtureEntry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		slog.Error("failed to encode fixture entry", "error", err.Error())
+		return
+	}
+	f, err := os.OpenFile(m.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		slog.Error("failed to open fixture file", "path", m.path, "error", err.Error())
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(raw, '\n')); err != nil {
+		slog.Error("failed to write fixture entry", "path", m.path, "error", err.Error())
+	}
+}
+
+// replayModel 按请求哈希回放 JSONL 夹具，不访问网络。
+type replayModel struct {
+	name    string
+	path    string
+	mu      sync.Mutex
+	entries map[string][]fixtureEntry
+	served  map[string]int
+}
+
+// NewReplayModel 加载 path 中的夹具。同一哈希被记录多次时按记录顺序依次回放，之后重复最后一条。
+func NewReplayModel(name, path string) (model.LLM, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open fixture file: %w", err)
+	}
+	defer f.Close()
+
+	entries := make(map[string][]fixtureEntry)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16<<20)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry fixtureEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("failed to parse fixture %s line %d: %w", path, line, err)
+		}
+		entries[entry.Hash] = append(entries[entry.Hash], entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read fixture file: %w", err)
+	}
+
+	return &replayModel{
+		name:    name,
+		path:    path,
+		entries: entries,
+		served:  make(map[string]int),
+	}, nil
+}
+
+func (m *replayModel) Name() string {
+	return m.name
+}
+
+func (m *replayModel) GenerateContent(ctx context.Context, req *model.LLMRequest, stream bool) iter.Seq2[*model.LLMResponse, error] {
+	return func(yield func(*model.LLMResponse, error) bool) {
+		entry, ok := m.next(RequestHash(req, stream))
+		if !ok {
+			canonical, _ := json.Marshal(canonicalRequest(req, stream))
+			yield(nil, fmt.Errorf("no recorded response in %s for request hash %s: %s", m.path, RequestHash(req, stream), canonical))
+			return
+		}
+		for _, resp := range entry.Responses {
+			if err := ctx.Err(); err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(resp, nil) {
+				return
+			}
+		}
+		if entry.Error != "" {
+			yield(nil, errors.New(entry.Error))
+		}
+	}
+}
+
+func (m *replayModel) next(hash string) (fixtureEntry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	recorded := m.entries[hash]
+	if len(recorded) == 0 {
+		return fixtureEntry{}, false
+	}
+	idx := min(m.served[hash], len(recorded)-1)
+	m.served[hash]++
+	return recorded[idx], true
+}
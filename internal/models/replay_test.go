@@ -0,0 +1,91 @@
+package models
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/adk/model"
+	"google.golang.org/genai"
+)
+
+func promptRequest(now string) *model.LLMRequest {
+	return &model.LLMRequest{
+		Model: "grok-4-fast",
+		Config: &genai.GenerateContentConfig{
+			SystemInstruction: genai.NewContentFromText("[Current Time: "+now+"]", "system"),
+		},
+		Contents: []*genai.Content{genai.NewContentFromText("早上好", "user")},
+	}
+}
+
+func generateAll(t *testing.T, llm model.LLM, req *model.LLMRequest, stream bool) ([]*model.LLMResponse, error) {
+	t.Helper()
+	var responses []*model.LLMResponse
+	for resp, err := range llm.GenerateContent(context.Background(), req, stream) {
+		if err != nil {
+			return responses, err
+		}
+		responses = append(responses, resp)
+	}
+	return responses, nil
+}
+
+func TestRecordThenReplayStreamedResponse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chat.jsonl")
+	live := &stubLLM{name: "grok-4-fast", results: [][]stubResult{{
+		{resp: textResponse("早", true)},
+		{resp: textResponse("上好", true)},
+		{resp: &model.LLMResponse{Content: genai.NewContentFromText("早上好", "model"), TurnComplete: true}},
+	}}}
+
+	recorder, err := NewRecordingModel(live, path)
+	if err != nil {
+		t.Fatalf("failed to create recorder: %v", err)
+	}
+	if _, err := generateAll(t, recorder, promptRequest("2026-01-02T08:00:00+08:00"), true); err != nil {
+		t.Fatalf("unexpected record error: %v", err)
+	}
+
+	replay, err := NewReplayModel("grok-4-fast", path)
+	if err != nil {
+		t.Fatalf("failed to load fixtures: %v", err)
+	}
+	// 时间戳不同也应命中同一夹具。
+	responses, err := generateAll(t, replay, promptRequest("2026-03-04T21:30:00Z"), true)
+	if err != nil {
+		t.Fatalf("unexpected replay error: %v", err)
+	}
+	if len(responses) != 3 || !responses[0].Partial || responses[2].Partial {
+		t.Fatalf("expected streamed chunks to be replayed in order, got %+v", responses)
+	}
+	if got := responses[2].Content.Parts[0].Text; got != "早上好" {
+		t.Fatalf("expected final text, got %q", got)
+	}
+	if live.calls != 1 {
+		t.Fatalf("expected replay to avoid live model, got %d calls", live.calls)
+	}
+}
+
+func TestReplayMissingFixtureReportsHash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chat.jsonl")
+	live := &stubLLM{name: "grok-4-fast", results: [][]stubResult{{{resp: textResponse("hi", false)}}}}
+	recorder, err := NewRecordingModel(live, path)
+	if err != nil {
+		t.Fatalf("failed to create recorder: %v", err)
+	}
+	if _, err := generateAll(t, recorder, promptRequest("2026-01-02T08:00:00Z"), false); err != nil {
+		t.Fatalf("unexpected record error: %v", err)
+	}
+
+	replay, err := NewReplayModel("grok-4-fast", path)
+	if err != nil {
+		t.Fatalf("failed to load fixtures: %v", err)
+	}
+	// 流式与非流式请求分别录制，不能互相命中。
+	_, err = generateAll(t, replay, promptRequest("2026-01-02T08:00:00Z"), true)
+	if err == nil || !strings.Contains(err.Error(), RequestHash(promptRequest("2026-01-02T08:00:00Z"), true)) {
+		t.Fatalf("expected missing fixture error with request hash, got %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"encoding/json"
+	"fmt"
 	"log/slog"
 	"strings"
 
@@ -9,6 +10,8 @@ import (
 	"github.com/openai/openai-go/v3"
 	"google.golang.org/adk/model"
 	"google.golang.org/genai"
+
+	"github.com/easeaico/project-her/internal/utils"
 )
 
 // buildOpenAIParams 将 ADK 请求映射为 OpenAI 请求参数。
@@ -37,6 +40,18 @@ func buildOpenAIParams(req *model.LLMRequest, model string) *openai.ChatCompleti
 		if req.Config.TopP != nil {
 			params.TopP = openai.Float(float64(*req.Config.TopP))
 		}
+		if req.Config.PresencePenalty != nil {
+			params.PresencePenalty = openai.Float(float64(*req.Config.PresencePenalty))
+		}
+		if req.Config.FrequencyPenalty != nil {
+			params.FrequencyPenalty = openai.Float(float64(*req.Config.FrequencyPenalty))
+		}
+		if len(req.Config.StopSequences) > 0 {
+			params.Stop = openai.ChatCompletionNewParamsStopUnion{OfStringArray: req.Config.StopSequences}
+		}
+		if req.Config.Seed != nil {
+			params.Seed = openai.Int(int64(*req.Config.Seed))
+		}
 
 		if len(req.Config.Tools) > 0 {
 			tools := convertToolsToOpenAI(req.Config.Tools)
@@ -44,6 +59,12 @@ func buildOpenAIParams(req *model.LLMRequest, model string) *openai.ChatCompleti
 				params.Tools = tools
 			}
 		}
+		if format, ok := convertResponseFormat(req.Config); ok {
+			params.ResponseFormat = format
+		}
+		if effort, ok := convertReasoningEffort(req.Config.ThinkingConfig); ok {
+			params.ReasoningEffort = effort
+		}
 	}
 
 	messages := convertContentsToMessages(req.Contents)
@@ -132,12 +153,19 @@ func convertSchemaProperty(schema *jsonschema.Schema) map[string]any {
 
 	prop := make(map[string]any)
 
-	if len(schema.Types) > 0 {
+	// 多个类型（如可空字段的 ["string","null"]）需要原样保留。
+	if len(schema.Types) > 1 {
+		prop["type"] = schema.Types
+	} else if len(schema.Types) == 1 {
 		prop["type"] = schema.Types[0]
 	} else if schema.Type != "" {
 		prop["type"] = schema.Type
 	}
 
+	if schema.Title != "" {
+		prop["title"] = schema.Title
+	}
+
 	if schema.Description != "" {
 		prop["description"] = schema.Description
 	}
@@ -187,6 +215,22 @@ func convertSchemaProperty(schema *jsonschema.Schema) map[string]any {
 	if schema.Items != nil {
 		prop["items"] = convertSchemaProperty(schema.Items)
 	}
+	if schema.MinItems != nil {
+		prop["minItems"] = *schema.MinItems
+	}
+	if schema.MaxItems != nil {
+		prop["maxItems"] = *schema.MaxItems
+	}
+
+	if len(schema.AnyOf) > 0 {
+		anyOf := make([]any, 0, len(schema.AnyOf))
+		for _, sub := range schema.AnyOf {
+			if sub != nil {
+				anyOf = append(anyOf, convertSchemaProperty(sub))
+			}
+		}
+		prop["anyOf"] = anyOf
+	}
 
 	if len(schema.Properties) > 0 {
 		properties := make(map[string]any)
@@ -208,41 +252,35 @@ func convertSchemaProperty(schema *jsonschema.Schema) map[string]any {
 }
 
 // convertContentsToMessages 将 genai.Content 转换为 OpenAI 消息序列。
+// 模型的 FunctionCall 会回放为带 tool_calls 的 assistant 消息，FunctionResponse 则转换为
+// 对应 tool_call_id 的 tool 消息；没有响应的调用补一条占位 tool 消息，保证严格校验调用序列的后端也能接受。
 func convertContentsToMessages(contents []*genai.Content) []openai.ChatCompletionMessageParamUnion {
 	var messages []openai.ChatCompletionMessageParamUnion
+	calls := &toolCallTracker{}
 
 	for _, content := range contents {
-		var hasFunctionResponse bool
-		for _, part := range content.Parts {
-			if part.FunctionResponse != nil && part.FunctionResponse.ID != "" {
-				hasFunctionResponse = true
-			}
+		if content == nil {
+			continue
 		}
 
-		if hasFunctionResponse {
-			for _, part := range content.Parts {
-				if part.FunctionResponse != nil && part.FunctionResponse.ID != "" {
-					message, err := json.Marshal(part.FunctionResponse.Response)
-					if err != nil {
-						slog.Error("failed to marshal function response", "error", err.Error())
-						continue
-					}
-
-					toolMessage := openai.ToolMessage(string(message), part.FunctionResponse.ID)
-					messages = append(messages, toolMessage)
-				}
-			}
+		if hasFunctionResponse(content) {
+			messages = append(messages, convertToolResponseMessages(content, calls)...)
+			continue
+		}
+		messages = append(messages, unansweredToolMessages(calls)...)
 
+		if hasFunctionCall(content) {
+			messages = append(messages, convertAssistantToolCallMessage(content, calls))
 			continue
 		}
 
-		var sb strings.Builder
-		for _, part := range content.Parts {
-			if part.Text != "" {
-				sb.WriteString(part.Text)
-			}
+		if content.Role == "user" && hasImagePart(content) {
+			messages = append(messages, convertUserMultimodalMessage(content))
+			continue
 		}
-		textContent := sb.String()
+
+		// 非用户角色无法携带图片，图片以文字说明形式保留。
+		textContent := utils.ExtractContentText(content)
 
 		switch content.Role {
 		case "user":
@@ -256,5 +294,184 @@ func convertContentsToMessages(contents []*genai.Content) []openai.ChatCompletio
 		}
 	}
 
+	return append(messages, unansweredToolMessages(calls)...)
+}
+
+// syntheticToolCallPrefix 为缺少 ID 的历史调用生成 ID 的前缀，不会与提供方返回的 call_ 前缀 ID 冲突。
+const syntheticToolCallPrefix = "ph_call_"
+
+// toolCallTracker 记录尚未收到响应的工具调用，用于补齐缺失的 ID 并按名称关联响应。
+type toolCallTracker struct {
+	pending []pendingToolCall
+	counter int
+}
+
+type pendingToolCall struct {
+	ID   string
+	Name string
+}
+
+// register 记录一次工具调用，ID 为空时生成合成 ID。
+func (t *toolCallTracker) register(call *genai.FunctionCall) string {
+	t.counter++
+	id := call.ID
+	if id == "" {
+		id = fmt.Sprintf("%s%d", syntheticToolCallPrefix, t.counter)
+	}
+	t.pending = append(t.pending, pendingToolCall{ID: id, Name: call.Name})
+	return id
+}
+
+// resolve 返回响应对应的 tool_call_id：优先使用响应自带 ID，否则按名称匹配最早的未完成调用。
+func (t *toolCallTracker) resolve(resp *genai.FunctionResponse) (string, bool) {
+	for i, call := range t.pending {
+		if (resp.ID != "" && call.ID == resp.ID) || (resp.ID == "" && call.Name == resp.Name) {
+			t.pending = append(t.pending[:i], t.pending[i+1:]...)
+			return call.ID, true
+		}
+	}
+	if resp.ID != "" {
+		return resp.ID, true
+	}
+	return "", false
+}
+
+// unanswered 返回并清空仍未收到响应的调用。
+func (t *toolCallTracker) unanswered() []pendingToolCall {
+	pending := t.pending
+	t.pending = nil
+	return pending
+}
+
+// unansweredToolMessages 为没有响应的调用补写占位 tool 消息，紧跟在调用所在的 assistant 消息之后。
+func unansweredToolMessages(calls *toolCallTracker) []openai.ChatCompletionMessageParamUnion {
+	var messages []openai.ChatCompletionMessageParamUnion
+	for _, call := range calls.unanswered() {
+		slog.Warn("tool call has no response, sending placeholder", "name", call.Name, "id", call.ID)
+		messages = append(messages, openai.ToolMessage(`{"error":"no result was recorded for this tool call"}`, call.ID))
+	}
+	return messages
+}
+
+func hasFunctionCall(content *genai.Content) bool {
+	for _, part := range content.Parts {
+		if part != nil && part.FunctionCall != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func hasFunctionResponse(content *genai.Content) bool {
+	for _, part := range content.Parts {
+		if part != nil && part.FunctionResponse != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// convertAssistantToolCallMessage 将包含 FunctionCall 的模型内容转换为 assistant 消息。
+func convertAssistantToolCallMessage(content *genai.Content, calls *toolCallTracker) openai.ChatCompletionMessageParamUnion {
+	var assistant openai.ChatCompletionAssistantMessageParam
+	var sb strings.Builder
+	for _, part := range content.Parts {
+		if part == nil {
+			continue
+		}
+		if part.FunctionCall == nil {
+			// 历史中的思考内容不回传给模型。
+			if part.Text != "" && !part.Thought {
+				sb.WriteString(part.Text)
+			}
+			continue
+		}
+
+		args, err := json.Marshal(part.FunctionCall.Args)
+		if err != nil || part.FunctionCall.Args == nil {
+			args = []byte("{}")
+		}
+		assistant.ToolCalls = append(assistant.ToolCalls, openai.ChatCompletionMessageToolCallUnionParam{
+			OfFunction: &openai.ChatCompletionMessageFunctionToolCallParam{
+				ID: calls.register(part.FunctionCall),
+				Function: openai.ChatCompletionMessageFunctionToolCallFunctionParam{
+					Name:      part.FunctionCall.Name,
+					Arguments: string(args),
+				},
+			},
+		})
+	}
+	if sb.Len() > 0 {
+		assistant.Content.OfString = openai.String(sb.String())
+	}
+	return openai.ChatCompletionMessageParamUnion{OfAssistant: &assistant}
+}
+
+// convertToolResponseMessages 将一轮中的多个 FunctionResponse 依次转换为 tool 消息。
+func convertToolResponseMessages(content *genai.Content, calls *toolCallTracker) []openai.ChatCompletionMessageParamUnion {
+	var messages []openai.ChatCompletionMessageParamUnion
+	var sb strings.Builder
+	for _, part := range content.Parts {
+		if part == nil {
+			continue
+		}
+		if part.FunctionResponse == nil {
+			if part.Text != "" {
+				sb.WriteString(part.Text)
+			}
+			continue
+		}
+
+		id, ok := calls.resolve(part.FunctionResponse)
+		if !ok {
+			slog.Warn("dropping function response without matching call", "name", part.FunctionResponse.Name)
+			continue
+		}
+		message, err := json.Marshal(part.FunctionResponse.Response)
+		if err != nil {
+			// 调用已回放给模型，必须回填结果，否则后端会拒绝不完整的调用序列。
+			slog.Error("failed to marshal function response", "error", err.Error())
+			message, _ = json.Marshal(map[string]string{"error": "failed to encode tool result"})
+		}
+		messages = append(messages, openai.ToolMessage(string(message), id))
+	}
+	// 与工具结果同轮的文本需在全部 tool 消息之后追加，避免打断调用序列。
+	if sb.Len() > 0 {
+		messages = append(messages, openai.UserMessage(sb.String()))
+	}
 	return messages
 }
+
+func hasImagePart(content *genai.Content) bool {
+	for _, part := range content.Parts {
+		if utils.IsImagePart(part) {
+			return true
+		}
+	}
+	return false
+}
+
+// convertUserMultimodalMessage 将包含图片的用户消息转换为多段内容，图片不可用时退化为文字说明。
+func convertUserMultimodalMessage(content *genai.Content) openai.ChatCompletionMessageParamUnion {
+	var parts []openai.ChatCompletionContentPartUnionParam
+	for _, part := range content.Parts {
+		if part == nil {
+			continue
+		}
+		if part.Text != "" {
+			parts = append(parts, openai.TextContentPart(part.Text))
+			continue
+		}
+		if !utils.IsImagePart(part) {
+			continue
+		}
+		imagePart, err := convertImagePart(part)
+		if err != nil {
+			slog.Warn("dropping image part", "error", err.Error())
+			parts = append(parts, openai.TextContentPart(utils.ImageNote(part)))
+			continue
+		}
+		parts = append(parts, imagePart)
+	}
+	return openai.UserMessage(parts)
+}
@@ -0,0 +1,299 @@
+package models
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	"google.golang.org/adk/model"
+	"google.golang.org/genai"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func marshalMessages(t *testing.T, contents []*genai.Content) []map[string]any {
+	t.Helper()
+	raw, err := json.Marshal(convertContentsToMessages(contents))
+	if err != nil {
+		t.Fatalf("failed to marshal messages: %v", err)
+	}
+	var decoded []map[string]any
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		t.Fatalf("failed to decode messages: %v", err)
+	}
+	return decoded
+}
+
+func TestConvertContentsToMessagesInlineImage(t *testing.T) {
+	contents := []*genai.Content{{
+		Role: "user",
+		Parts: []*genai.Part{
+			{Text: "看看我的猫"},
+			{InlineData: &genai.Blob{MIMEType: "image/png", Data: pngHeader, DisplayName: "cat.png"}},
+		},
+	}}
+
+	messages := marshalMessages(t, contents)
+	if len(messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(messages))
+	}
+	parts, ok := messages[0]["content"].([]any)
+	if !ok || len(parts) != 2 {
+		t.Fatalf("expected 2 content parts, got %#v", messages[0]["content"])
+	}
+	image := parts[1].(map[string]any)
+	if image["type"] != "image_url" {
+		t.Fatalf("expected image_url part, got %#v", image)
+	}
+	url := image["image_url"].(map[string]any)["url"].(string)
+	if !strings.HasPrefix(url, "data:image/png;base64,") {
+		t.Fatalf("expected png data url, got %s", url)
+	}
+}
+
+func TestConvertContentsToMessagesRejectedImageFallsBackToNote(t *testing.T) {
+	contents := []*genai.Content{{
+		Role: "user",
+		Parts: []*genai.Part{
+			{InlineData: &genai.Blob{MIMEType: "image/tiff", Data: []byte("II*\x00"), DisplayName: "scan.tiff"}},
+		},
+	}}
+
+	messages := marshalMessages(t, contents)
+	parts := messages[0]["content"].([]any)
+	text := parts[0].(map[string]any)
+	if text["type"] != "text" || text["text"] != "[Image shared: scan.tiff]" {
+		t.Fatalf("expected image note fallback, got %#v", text)
+	}
+}
+
+func TestConvertContentsToMessagesModelImageBecomesNote(t *testing.T) {
+	contents := []*genai.Content{{
+		Role: "model",
+		Parts: []*genai.Part{
+			{Text: "好可爱"},
+			{FileData: &genai.FileData{MIMEType: "image/jpeg", FileURI: "https://example.com/a/dog.jpg?x=1"}},
+		},
+	}}
+
+	messages := marshalMessages(t, contents)
+	if got := messages[0]["content"]; got != "好可爱\n[Image shared: dog.jpg]" {
+		t.Fatalf("unexpected assistant content %#v", got)
+	}
+}
+
+func TestConvertContentsToMessagesReplaysToolCalls(t *testing.T) {
+	contents := []*genai.Content{
+		genai.NewContentFromText("明天天气怎么样？", "user"),
+		{
+			Role: "model",
+			Parts: []*genai.Part{
+				{Text: "我查一下"},
+				{FunctionCall: &genai.FunctionCall{ID: "call_a", Name: "weather", Args: map[string]any{"city": "上海"}}},
+				{FunctionCall: &genai.FunctionCall{Name: "clock"}},
+			},
+		},
+		{
+			Role: "user",
+			Parts: []*genai.Part{
+				{FunctionResponse: &genai.FunctionResponse{ID: "call_a", Name: "weather", Response: map[string]any{"output": "晴"}}},
+				{FunctionResponse: &genai.FunctionResponse{Name: "clock", Response: map[string]any{"output": "09:00"}}},
+			},
+		},
+	}
+
+	messages := marshalMessages(t, contents)
+	if len(messages) != 4 {
+		t.Fatalf("expected 4 messages, got %d: %#v", len(messages), messages)
+	}
+
+	assistant := messages[1]
+	if assistant["role"] != "assistant" || assistant["content"] != "我查一下" {
+		t.Fatalf("unexpected assistant message %#v", assistant)
+	}
+	toolCalls := assistant["tool_calls"].([]any)
+	if len(toolCalls) != 2 {
+		t.Fatalf("expected 2 tool calls, got %d", len(toolCalls))
+	}
+	first := toolCalls[0].(map[string]any)
+	if first["id"] != "call_a" || first["function"].(map[string]any)["arguments"] != `{"city":"上海"}` {
+		t.Fatalf("unexpected first tool call %#v", first)
+	}
+	secondID := toolCalls[1].(map[string]any)["id"].(string)
+	if !strings.HasPrefix(secondID, syntheticToolCallPrefix) {
+		t.Fatalf("expected synthesized id outside the provider namespace, got %q", secondID)
+	}
+
+	if messages[2]["role"] != "tool" || messages[2]["tool_call_id"] != "call_a" {
+		t.Fatalf("unexpected first tool message %#v", messages[2])
+	}
+	if messages[3]["role"] != "tool" || messages[3]["tool_call_id"] != secondID {
+		t.Fatalf("expected second tool message to correlate with %s, got %#v", secondID, messages[3])
+	}
+}
+
+func TestConvertContentsToMessagesAnswersDanglingToolCalls(t *testing.T) {
+	contents := []*genai.Content{
+		{
+			Role: "model",
+			Parts: []*genai.Part{
+				{FunctionCall: &genai.FunctionCall{ID: "call_a", Name: "weather"}},
+				{FunctionCall: &genai.FunctionCall{ID: "call_b", Name: "clock"}},
+			},
+		},
+		{
+			Role:  "user",
+			Parts: []*genai.Part{{FunctionResponse: &genai.FunctionResponse{ID: "call_a", Name: "weather", Response: map[string]any{"output": "晴"}}}},
+		},
+		genai.NewContentFromText("算了，不用查了", "user"),
+		{
+			Role:  "model",
+			Parts: []*genai.Part{{FunctionCall: &genai.FunctionCall{ID: "call_c", Name: "weather"}}},
+		},
+	}
+
+	messages := marshalMessages(t, contents)
+	var roles, ids []string
+	for _, message := range messages {
+		roles = append(roles, message["role"].(string))
+		if id, ok := message["tool_call_id"].(string); ok {
+			ids = append(ids, id)
+		}
+	}
+	// 未响应的调用在下一条消息之前、以及历史末尾补上占位结果。
+	if !slices.Equal(roles, []string{"assistant", "tool", "tool", "user", "assistant", "tool"}) || !slices.Equal(ids, []string{"call_a", "call_b", "call_c"}) {
+		t.Fatalf("expected every tool call to be answered, got roles %v ids %v", roles, ids)
+	}
+}
+
+func marshalParams(t *testing.T, req *model.LLMRequest) map[string]any {
+	t.Helper()
+	raw, err := json.Marshal(buildOpenAIParams(req, "grok-4-fast"))
+	if err != nil {
+		t.Fatalf("failed to marshal params: %v", err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		t.Fatalf("failed to decode params: %v", err)
+	}
+	return decoded
+}
+
+func TestBuildOpenAIParamsResponseSchemaBecomesJSONSchema(t *testing.T) {
+	params := marshalParams(t, &model.LLMRequest{
+		Config: &genai.GenerateContentConfig{
+			ResponseMIMEType: "application/json",
+			ResponseSchema: &genai.Schema{
+				Type:     genai.TypeObject,
+				Required: []string{"summary"},
+				Properties: map[string]*genai.Schema{
+					"summary": {Type: genai.TypeString},
+					"facts":   {Type: genai.TypeArray, Items: &genai.Schema{Type: genai.TypeString}},
+					"mood":    {Type: genai.TypeString, Nullable: genai.Ptr(true), Enum: []string{"happy", "sad"}},
+				},
+			},
+		},
+		Contents: []*genai.Content{genai.NewContentFromText("总结", "user")},
+	})
+
+	format := params["response_format"].(map[string]any)
+	if format["type"] != "json_schema" {
+		t.Fatalf("expected json_schema response format, got %#v", format)
+	}
+	spec := format["json_schema"].(map[string]any)
+	if spec["name"] != "response" {
+		t.Fatalf("expected default schema name, got %#v", spec["name"])
+	}
+	schema := spec["schema"].(map[string]any)
+	props := schema["properties"].(map[string]any)
+	if schema["type"] != "object" || len(props) != 3 {
+		t.Fatalf("unexpected root schema %#v", schema)
+	}
+	facts := props["facts"].(map[string]any)
+	if facts["type"] != "array" || facts["items"].(map[string]any)["type"] != "string" {
+		t.Fatalf("expected lower-cased array of strings, got %#v", facts)
+	}
+	mood := props["mood"].(map[string]any)
+	if types, ok := mood["type"].([]any); !ok || len(types) != 2 || types[1] != "null" {
+		t.Fatalf("expected nullable type pair, got %#v", mood["type"])
+	}
+}
+
+func TestBuildOpenAIParamsResponseFormatFallsBackToJSONObject(t *testing.T) {
+	cases := map[string]*genai.GenerateContentConfig{
+		"mime only":       {ResponseMIMEType: "application/json"},
+		"non-object root": {ResponseSchema: &genai.Schema{Type: genai.TypeArray, Items: &genai.Schema{Type: genai.TypeString}}},
+	}
+	for name, cfg := range cases {
+		t.Run(name, func(t *testing.T) {
+			params := marshalParams(t, &model.LLMRequest{Config: cfg})
+			format, _ := params["response_format"].(map[string]any)
+			if format["type"] != "json_object" {
+				t.Fatalf("expected json_object fallback, got %#v", params["response_format"])
+			}
+		})
+	}
+
+	if params := marshalParams(t, &model.LLMRequest{Config: &genai.GenerateContentConfig{}}); params["response_format"] != nil {
+		t.Fatalf("expected no response_format for plain text, got %#v", params["response_format"])
+	}
+}
+
+func TestBuildOpenAIParamsResponseJSONSchemaMap(t *testing.T) {
+	raw := map[string]any{
+		"title":      "Reply Card",
+		"properties": map[string]any{"text": map[string]any{"type": "string"}},
+	}
+	params := marshalParams(t, &model.LLMRequest{Config: &genai.GenerateContentConfig{ResponseJsonSchema: raw}})
+	spec := params["response_format"].(map[string]any)["json_schema"].(map[string]any)
+	if spec["name"] != "Reply_Card" || spec["schema"].(map[string]any)["type"] != "object" {
+		t.Fatalf("unexpected json_schema %#v", spec)
+	}
+	if _, mutated := raw["type"]; mutated {
+		t.Fatalf("expected caller schema to stay untouched")
+	}
+}
+
+func TestBuildOpenAIParamsMapsGenerationProfile(t *testing.T) {
+	params := marshalParams(t, &model.LLMRequest{
+		Config: &genai.GenerateContentConfig{
+			Temperature:      genai.Ptr[float32](1.25),
+			TopP:             genai.Ptr[float32](0.5),
+			PresencePenalty:  genai.Ptr[float32](0.75),
+			FrequencyPenalty: genai.Ptr[float32](-0.5),
+			StopSequences:    []string{"\n{{user}}:"},
+			Seed:             genai.Ptr[int32](42),
+			MaxOutputTokens:  200,
+		},
+		Contents: []*genai.Content{genai.NewContentFromText("hi", "user")},
+	})
+
+	want := map[string]any{
+		"temperature":       1.25,
+		"top_p":             0.5,
+		"presence_penalty":  0.75,
+		"frequency_penalty": -0.5,
+		"seed":              float64(42),
+		"max_tokens":        float64(200),
+	}
+	for key, value := range want {
+		if params[key] != value {
+			t.Fatalf("expected %s=%v, got %v", key, value, params[key])
+		}
+	}
+	if stop, ok := params["stop"].([]any); !ok || len(stop) != 1 || stop[0] != "\n{{user}}:" {
+		t.Fatalf("expected stop sequences array, got %#v", params["stop"])
+	}
+}
+
+func TestBuildOpenAIParamsOmitsUnsetGenerationProfile(t *testing.T) {
+	params := marshalParams(t, &model.LLMRequest{
+		Contents: []*genai.Content{genai.NewContentFromText("hi", "user")},
+	})
+	for _, key := range []string{"temperature", "top_p", "presence_penalty", "frequency_penalty", "stop", "seed", "max_tokens"} {
+		if _, ok := params[key]; ok {
+			t.Fatalf("expected %s to be omitted, got %v", key, params[key])
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package models
+
+import (
+	"encoding/json"
+	"log/slog"
+	"maps"
+	"regexp"
+	"strings"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/openai/openai-go/v3"
+	"google.golang.org/genai"
+)
+
+const jsonMIMEType = "application/json"
+
+// responseFormatNamePattern 过滤 json_schema.name 中 OpenAI 不接受的字符。
+var responseFormatNamePattern = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// convertResponseFormat 将 genai 的结构化输出配置映射为 OpenAI 的 response_format。
+// 优先使用 ResponseJsonSchema，其次 ResponseSchema，转换为 json_schema；
+// 仅要求 JSON 输出或 schema 无法转换时退回 json_object。未要求结构化输出时返回 false。
+func convertResponseFormat(cfg *genai.GenerateContentConfig) (openai.ChatCompletionNewParamsResponseFormatUnion, bool) {
+	if cfg == nil {
+		return openai.ChatCompletionNewParamsResponseFormatUnion{}, false
+	}
+	wantsJSON := strings.EqualFold(strings.TrimSpace(cfg.ResponseMIMEType), jsonMIMEType)
+	if cfg.ResponseJsonSchema == nil && cfg.ResponseSchema == nil && !wantsJSON {
+		return openai.ChatCompletionNewParamsResponseFormatUnion{}, false
+	}
+
+	schema, name := responseJSONSchema(cfg)
+	if schema == nil {
+		return openai.ChatCompletionNewParamsResponseFormatUnion{OfJSONObject: &openai.ResponseFormatJSONObjectParam{}}, true
+	}
+
+	return openai.ChatCompletionNewParamsResponseFormatUnion{
+		OfJSONSchema: &openai.ResponseFormatJSONSchemaParam{
+			// 不开启 strict：strict 要求所有字段必填且禁止额外字段，会拒绝大多数现有 schema。
+			JSONSchema: openai.ResponseFormatJSONSchemaJSONSchemaParam{
+				Name:   name,
+				Schema: schema,
+			},
+		},
+	}, true
+}
+
+// responseJSONSchema 返回可用于 json_schema 的根 schema 与名称；根节点必须是对象，否则返回 nil。
+func responseJSONSchema(cfg *genai.GenerateContentConfig) (map[string]any, string) {
+	var schema map[string]any
+	switch {
+	case cfg.ResponseJsonSchema != nil:
+		schema = anyToJSONSchema(cfg.ResponseJsonSchema)
+	case cfg.ResponseSchema != nil:
+		schema = convertSchemaProperty(genaiSchemaToJSONSchema(cfg.ResponseSchema))
+	}
+	if schema == nil {
+		return nil, ""
+	}
+	if t, _ := schema["type"].(string); t != "" && t != "object" {
+		slog.Warn("response schema root is not an object, falling back to json_object", "type", t)
+		return nil, ""
+	}
+	schema["type"] = "object"
+
+	name := "response"
+	if title, _ := schema["title"].(string); title != "" {
+		if sanitized := responseFormatNamePattern.ReplaceAllString(title, "_"); strings.Trim(sanitized, "_") != "" {
+			name = sanitized
+		}
+	}
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return schema, name
+}
+
+// anyToJSONSchema 处理 ResponseJsonSchema 的常见形态：*jsonschema.Schema、map 或可 JSON 编码的值。
+func anyToJSONSchema(value any) map[string]any {
+	switch v := value.(type) {
+	case *jsonschema.Schema:
+		return convertSchemaProperty(v)
+	case map[string]any:
+		// 复制一层，避免修改调用方共享的 schema。
+		return maps.Clone(v)
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		slog.Warn("failed to encode response json schema", "error", err.Error())
+		return nil
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		slog.Warn("response json schema is not an object", "error", err.Error())
+		return nil
+	}
+	return schema
+}
+
+// genaiSchemaToJSONSchema 将 genai.Schema（OpenAPI 子集）转换为 jsonschema.Schema，
+// 以复用 convertSchemaProperty 的映射逻辑。
+func genaiSchemaToJSONSchema(schema *genai.Schema) *jsonschema.Schema {
+	if schema == nil {
+		return nil
+	}
+
+	out := &jsonschema.Schema{
+		Title:       schema.Title,
+		Description: schema.Description,
+		Format:      schema.Format,
+		Pattern:     schema.Pattern,
+		Minimum:     schema.Minimum,
+		Maximum:     schema.Maximum,
+		MinLength:   intFromInt64(schema.MinLength),
+		MaxLength:   intFromInt64(schema.MaxLength),
+		MinItems:    intFromInt64(schema.MinItems),
+		MaxItems:    intFromInt64(schema.MaxItems),
+		Required:    schema.Required,
+		Items:       genaiSchemaToJSONSchema(schema.Items),
+	}
+
+	if schema.Type != "" && schema.Type != genai.TypeUnspecified {
+		typ := strings.ToLower(string(schema.Type))
+		if schema.Nullable != nil && *schema.Nullable {
+			out.Types = []string{typ, "null"}
+		} else {
+			out.Type = typ
+		}
+	}
+	for _, value := range schema.Enum {
+		out.Enum = append(out.Enum, value)
+	}
+	if schema.Default != nil {
+		if raw, err := json.Marshal(schema.Default); err == nil {
+			out.Default = raw
+		}
+	}
+	if len(schema.Properties) > 0 {
+		out.Properties = make(map[string]*jsonschema.Schema, len(schema.Properties))
+		for name, prop := range schema.Properties {
+			out.Properties[name] = genaiSchemaToJSONSchema(prop)
+		}
+	}
+	for _, sub := range schema.AnyOf {
+		out.AnyOf = append(out.AnyOf, genaiSchemaToJSONSchema(sub))
+	}
+	return out
+}
+
+func intFromInt64(v *int64) *int {
+	if v == nil {
+		return nil
+	}
+	n := int(*v)
+	return &n
+}
@@ -0,0 +1,124 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"google.golang.org/genai"
+)
+
+// MetadataToolCallKey 为流式部分响应 CustomMetadata 中记录已完整工具调用的键，值为 *genai.FunctionCall。
+const MetadataToolCallKey = "tool_call"
+
+// toolCallBuilder 聚合单个工具调用的流式增量。
+type toolCallBuilder struct {
+	Index    int64
+	ID       string
+	Name     string
+	Args     strings.Builder
+	complete bool
+	part     *genai.Part
+}
+
+// toolCallAccumulator 按 index 聚合流式 tool_call 增量，并在参数完整时立即定型。
+//
+// 参数完整的判定：后续 index 已开始，或累计参数已是合法 JSON 对象。
+// 定型后的调用不会再被后续增量修改，避免不同调用的参数被拼接到一起。
+//
+// ADK 会对每个包含 FunctionCall 的事件（包括部分事件）立即执行工具并结束本步，
+// 因此已完整的调用通过 completed 以元数据形式提前下发，供界面展示；真正执行用的
+// FunctionCall part 仍在最终响应中由 parts 一并下发。
+type toolCallAccumulator struct {
+	builders map[int64]*toolCallBuilder
+	// ready 记录尚未被 completed 取走的已定型调用。
+	ready []*genai.FunctionCall
+}
+
+func newToolCallAccumulator() *toolCallAccumulator {
+	return &toolCallAccumulator{builders: make(map[int64]*toolCallBuilder)}
+}
+
+// add 合并一个 tool_call 增量。
+func (a *toolCallAccumulator) add(index int64, id, name, args string) {
+	builder, exists := a.builders[index]
+	if !exists {
+		// 新调用开始意味着之前的调用参数已经完整。
+		for _, prev := range a.builders {
+			if prev.Index < index {
+				a.finish(prev)
+			}
+		}
+		builder = &toolCallBuilder{Index: index}
+		a.builders[index] = builder
+	}
+	if builder.complete {
+		slog.Warn("ignoring delta for completed tool call", "index", index, "name", builder.Name)
+		return
+	}
+
+	if id != "" {
+		builder.ID = id
+	}
+	if name != "" {
+		builder.Name = name
+	}
+	if args != "" {
+		builder.Args.WriteString(args)
+		if raw := strings.TrimSpace(builder.Args.String()); strings.HasSuffix(raw, "}") && json.Valid([]byte(raw)) {
+			a.finish(builder)
+		}
+	}
+}
+
+// finish 将调用定型为 FunctionCall part。
+func (a *toolCallAccumulator) finish(builder *toolCallBuilder) {
+	if builder.complete {
+		return
+	}
+	builder.complete = true
+	if builder.Name == "" {
+		slog.Warn("dropping tool call without name", "index", builder.Index)
+		return
+	}
+	id := builder.ID
+	if id == "" {
+		id = fmt.Sprintf("call_%d", builder.Index)
+	}
+	builder.part = &genai.Part{
+		FunctionCall: &genai.FunctionCall{
+			ID:   id,
+			Name: builder.Name,
+			Args: parseFunctionArgs(builder.Args.String()),
+		},
+	}
+	a.ready = append(a.ready, builder.part.FunctionCall)
+}
+
+// completed 返回自上次调用以来新定型的工具调用。
+func (a *toolCallAccumulator) completed() []*genai.FunctionCall {
+	ready := a.ready
+	a.ready = nil
+	return ready
+}
+
+// parts 定型全部调用，并按 index 顺序返回独立的 FunctionCall part。
+func (a *toolCallAccumulator) parts() []*genai.Part {
+	indices := make([]int64, 0, len(a.builders))
+	for idx := range a.builders {
+		indices = append(indices, idx)
+	}
+	sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+
+	var parts []*genai.Part
+	for _, idx := range indices {
+		builder := a.builders[idx]
+		a.finish(builder)
+		if builder.part != nil {
+			parts = append(parts, builder.part)
+		}
+	}
+	return parts
+}
@@ -0,0 +1,51 @@
+package models
+
+import "testing"
+
+func TestToolCallAccumulatorKeepsParallelCallsSeparate(t *testing.T) {
+	acc := newToolCallAccumulator()
+	acc.add(0, "call_a", "weather", `{"city":`)
+	acc.add(0, "", "", `"上海"}`)
+	acc.add(1, "call_b", "clock", `{}`)
+	// 已定型的调用不再接受增量。
+	acc.add(0, "", "", `{"city":"北京"}`)
+
+	parts := acc.parts()
+	if len(parts) != 2 {
+		t.Fatalf("expected 2 function call parts, got %d", len(parts))
+	}
+	first := parts[0].FunctionCall
+	if first.ID != "call_a" || first.Name != "weather" || first.Args["city"] != "上海" {
+		t.Fatalf("unexpected first call %#v", first)
+	}
+	second := parts[1].FunctionCall
+	if second.ID != "call_b" || second.Name != "clock" || len(second.Args) != 0 {
+		t.Fatalf("unexpected second call %#v", second)
+	}
+}
+
+func TestToolCallAccumulatorSynthesizesMissingID(t *testing.T) {
+	acc := newToolCallAccumulator()
+	acc.add(2, "", "clock", "")
+
+	parts := acc.parts()
+	if len(parts) != 1 || parts[0].FunctionCall.ID != "call_2" {
+		t.Fatalf("expected synthesized id call_2, got %#v", parts)
+	}
+}
+
+func TestToolCallAccumulatorReportsCompletedCallsOnce(t *testing.T) {
+	acc := newToolCallAccumulator()
+	acc.add(0, "call_a", "weather", `{"city":`)
+	if got := acc.completed(); len(got) != 0 {
+		t.Fatalf("expected no completed call yet, got %#v", got)
+	}
+	acc.add(0, "", "", `"上海"}`)
+	got := acc.completed()
+	if len(got) != 1 || got[0].ID != "call_a" {
+		t.Fatalf("expected call_a to complete, got %#v", got)
+	}
+	if again := acc.completed(); len(again) != 0 {
+		t.Fatalf("expected completed calls to be drained, got %#v", again)
+	}
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"strings"
+
+	"github.com/openai/openai-go/v3"
+	"google.golang.org/genai"
+
+	"github.com/easeaico/project-her/internal/config"
+)
+
+// MetadataCostKey 为 LLMResponse.CustomMetadata 中记录本次调用估算费用（美元）的键。
+const MetadataCostKey = "estimated_cost_usd"
+
+// DefaultPrices 为内置的模型价格表（美元/百万 token），键为不含提供方前缀的模型名。
+// 价格仅用于估算，以提供方账单为准；可通过 MODEL_PRICES 覆盖或补充。
+var DefaultPrices = PriceTable{
+	"grok-4-fast":               {Input: 0.20, CachedInput: 0.05, Output: 0.50},
+	"grok-4":                    {Input: 3.00, CachedInput: 0.75, Output: 15.00},
+	"grok-3-mini":               {Input: 0.30, CachedInput: 0.075, Output: 0.50},
+	"gpt-4o":                    {Input: 2.50, CachedInput: 1.25, Output: 10.00},
+	"gpt-4o-mini":               {Input: 0.15, CachedInput: 0.075, Output: 0.60},
+	"gpt-4.1":                   {Input: 2.00, CachedInput: 0.50, Output: 8.00},
+	"gpt-4.1-mini":              {Input: 0.40, CachedInput: 0.10, Output: 1.60},
+	"gemini-2.0-flash":          {Input: 0.10, CachedInput: 0.025, Output: 0.40},
+	"gemini-2.5-flash":          {Input: 0.30, CachedInput: 0.075, Output: 2.50},
+	"gemini-2.5-pro":            {Input: 1.25, CachedInput: 0.31, Output: 10.00},
+	"anthropic/claude-sonnet-4": {Input: 3.00, CachedInput: 0.30, Output: 15.00},
+	"claude-sonnet-4-5":         {Input: 3.00, CachedInput: 0.30, Output: 15.00},
+	"claude-haiku-4-5":          {Input: 1.00, CachedInput: 0.10, Output: 5.00},
+}
+
+// PriceTable 按模型规格或模型名查询价格。
+type PriceTable map[string]config.ModelPrice
+
+// NewPriceTable 合并内置价格与配置中的覆盖项。
+func NewPriceTable(overrides map[string]config.ModelPrice) PriceTable {
+	table := make(PriceTable, len(DefaultPrices)+len(overrides))
+	for name, price := range DefaultPrices {
+		table[name] = price
+	}
+	for name, price := range overrides {
+		table[strings.ToLower(strings.TrimSpace(name))] = price
+	}
+	return table
+}
+
+// Lookup 先按完整规格（如 "openrouter/anthropic/claude-sonnet-4"）查找，再去掉提供方前缀按模型名查找。
+func (t PriceTable) Lookup(name string) (config.ModelPrice, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if price, ok := t[name]; ok {
+		return price, true
+	}
+	if provider, modelName, found := strings.Cut(name, "/"); found && isBuiltinProvider(provider) {
+		price, ok := t[modelName]
+		return price, ok
+	}
+	return config.ModelPrice{}, false
+}
+
+// EstimateCost 根据用量估算一次调用的费用（美元），未知模型或无用量时返回 false。
+// 缓存命中的输入按缓存价计费，思考 token 按输出价计费。
+func (t PriceTable) EstimateCost(name string, usage *genai.GenerateContentResponseUsageMetadata) (float64, bool) {
+	if usage == nil {
+		return 0, false
+	}
+	price, ok := t.Lookup(name)
+	if !ok {
+		return 0, false
+	}
+	cached := float64(usage.CachedContentTokenCount)
+	uncached := max(float64(usage.PromptTokenCount)-cached, 0)
+	output := float64(usage.CandidatesTokenCount + usage.ThoughtsTokenCount)
+	cost := uncached*price.Input + cached*price.CachedInput + output*price.Output
+	return cost / 1e6, true
+}
+
+// convertUsage 将 OpenAI 的用量转换为 genai 的用量元数据；
+// OpenAI 的 completion_tokens 含推理 token，这里拆分为候选与思考两部分。
+func convertUsage(usage openai.CompletionUsage) *genai.GenerateContentResponseUsageMetadata {
+	if usage.PromptTokens == 0 && usage.CompletionTokens == 0 && usage.TotalTokens == 0 {
+		return nil
+	}
+	reasoning := usage.CompletionTokensDetails.ReasoningTokens
+	total := usage.TotalTokens
+	if total == 0 {
+		total = usage.PromptTokens + usage.CompletionTokens
+	}
+	return &genai.GenerateContentResponseUsageMetadata{
+		PromptTokenCount:        int32(usage.PromptTokens),
+		CachedContentTokenCount: int32(usage.PromptTokensDetails.CachedTokens),
+		CandidatesTokenCount:    int32(max(usage.CompletionTokens-reasoning, 0)),
+		ThoughtsTokenCount:      int32(reasoning),
+		TotalTokenCount:         int32(total),
+	}
+}
@@ -7,7 +7,6 @@ import (
 	"strings"
 
 	"github.com/openai/openai-go/v3"
-	"github.com/openai/openai-go/v3/option"
 	"google.golang.org/adk/model"
 	"google.golang.org/genai"
 )
@@ -24,10 +23,7 @@ func NewGrokModel(ctx context.Context, modelName string, cfg *genai.ClientConfig
 		return nil, fmt.Errorf("model name cannot be empty")
 	}
 
-	client := openai.NewClient(
-		option.WithAPIKey(cfg.APIKey),
-		option.WithBaseURL("https://api.x.ai/v1"),
-	)
+	client := openai.NewClient(clientOptions(cfg, "https://api.x.ai/v1")...)
 
 	headerValue := fmt.Sprintf("grok-go/%s go/%s",
 		"1.0.0", strings.TrimPrefix(runtime.Version(), "go"))
@@ -0,0 +1,209 @@
+// Package prompt 按 PRD FR-2.1 的分层结构组装角色扮演提示词。
+//
+// 提示词由有序的段落组成：System、Persona、World/State、Lore、Memory、Few-Shot、History、Anchor。
+// 每个段落是一个 text/template 模板，默认模板位于 templates 目录，可由 PROMPT_DIR
+// 下的同名文件整体替换，也可由角色在数据库中单独覆盖、禁用或调整 token 预算。
+package prompt
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/easeaico/project-her/internal/types"
+	"github.com/easeaico/project-her/internal/utils"
+)
+
+// 段落名称，与模板文件名（不含 .tmpl）及数据库中的 section 字段一致。
+const (
+	SectionSystem  = "system"
+	SectionPersona = "persona"
+	SectionWorld   = "world"
+	SectionLore    = "lore"
+	SectionMemory  = "memory"
+	SectionFewShot = "few_shot"
+	SectionHistory = "history"
+	SectionAnchor  = "anchor"
+)
+
+// Sections 为段落的固定顺序。History 段落的模板作为历史对话前的引导语，
+// 其预算用于裁剪对话历史；Anchor 段落追加在历史之后，而非系统提示中。
+var Sections = []string{
+	SectionSystem,
+	SectionPersona,
+	SectionWorld,
+	SectionLore,
+	SectionMemory,
+	SectionFewShot,
+	SectionHistory,
+	SectionAnchor,
+}
+
+//go:embed templates/*.tmpl
+var defaultTemplates embed.FS
+
+// Data 为渲染段落模板时可用的字段。
+type Data struct {
+	CharName string
+	// UserName 为用户资料中的名字，未设置时为用户 ID。
+	UserName string
+	// UserPronouns、UserDescription、UserLanguage 与 UserPersona 来自用户资料，可能为空。
+	UserPronouns    string
+	UserDescription string
+	UserLanguage    string
+	UserPersona     string
+	Personality     string
+	Description     string
+	Scenario        string
+	SystemPrompt    string
+	MessageExample  string
+	// PostHistoryInstructions 为角色卡的 post_history_instructions，非空时替换默认的 Anchor 内容。
+	PostHistoryInstructions string
+	Now                     string
+	Location                string
+	RelationshipLevel       string
+	StorySoFar              string
+	// Lore 为本轮激活的世界书条目。
+	Lore string
+	// Facts 为当前有效的用户事实，优先于检索记忆注入。
+	Facts    string
+	Memories string
+}
+
+// LoadTemplates 读取内置的默认模板，并用 dir 中存在的同名文件替换；dir 为空或不存在时仅使用默认模板。
+func LoadTemplates(dir string) (map[string]string, error) {
+	templates := make(map[string]string, len(Sections))
+	for _, name := range Sections {
+		raw, err := defaultTemplates.ReadFile("templates/" + name + ".tmpl")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read default %s template: %w", name, err)
+		}
+		templates[name] = string(raw)
+
+		if dir == "" {
+			continue
+		}
+		raw, err = os.ReadFile(filepath.Join(dir, name+".tmpl"))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s template: %w", name, err)
+		}
+		templates[name] = string(raw)
+	}
+	return templates, nil
+}
+
+type section struct {
+	name      string
+	tmpl      *template.Template
+	enabled   bool
+	maxTokens int
+}
+
+// Assembler 按顺序渲染一个角色的全部段落。
+type Assembler struct {
+	sections map[string]*section
+}
+
+// NewAssembler 解析模板并应用角色的覆盖项。budgets 为各段落的默认 token 预算（0 为不限制）。
+func NewAssembler(templates map[string]string, budgets map[string]int, overrides []types.PromptSection) (*Assembler, error) {
+	a := &Assembler{sections: make(map[string]*section, len(Sections))}
+	sources := make(map[string]string, len(Sections))
+	for _, name := range Sections {
+		a.sections[name] = &section{name: name, enabled: true, maxTokens: budgets[name]}
+		sources[name] = templates[name]
+	}
+
+	for _, override := range overrides {
+		name := strings.ToLower(strings.TrimSpace(override.Section))
+		s, ok := a.sections[name]
+		if !ok {
+			slog.Warn("ignoring unknown prompt section override", "section", override.Section)
+			continue
+		}
+		s.enabled = override.Enabled
+		if strings.TrimSpace(override.Template) != "" {
+			sources[name] = override.Template
+		}
+		if override.MaxTokens > 0 {
+			s.maxTokens = override.MaxTokens
+		}
+	}
+
+	for _, name := range Sections {
+		tmpl, err := template.New(name).Option("missingkey=zero").Parse(sources[name])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s prompt section: %w", name, err)
+		}
+		a.sections[name].tmpl = tmpl
+	}
+	return a, nil
+}
+
+// Enabled 返回段落是否启用。
+func (a *Assembler) Enabled(name string) bool {
+	s, ok := a.sections[name]
+	return ok && s.enabled
+}
+
+// Budget 返回段落的 token 预算，0 表示不限制。
+func (a *Assembler) Budget(name string) int {
+	if s, ok := a.sections[name]; ok {
+		return s.maxTokens
+	}
+	return 0
+}
+
+// Instruction 渲染系统提示：除 Anchor 外的所有启用段落，按顺序以空行分隔，空段落省略。
+func (a *Assembler) Instruction(data Data) (string, error) {
+	var parts []string
+	for _, name := range Sections {
+		if name == SectionAnchor {
+			continue
+		}
+		text, err := a.render(name, data)
+		if err != nil {
+			return "", err
+		}
+		if text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, "\n\n"), nil
+}
+
+// Anchor 渲染追加在对话历史之后的尾部指令，未启用时返回空字符串。
+func (a *Assembler) Anchor(data Data) (string, error) {
+	return a.render(SectionAnchor, data)
+}
+
+// render 渲染单个段落并按预算截断。
+func (a *Assembler) render(name string, data Data) (string, error) {
+	s := a.sections[name]
+	if s == nil || !s.enabled {
+		return "", nil
+	}
+	var buf bytes.Buffer
+	if err := s.tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render %s prompt section: %w", name, err)
+	}
+	text := strings.TrimSpace(buf.String())
+	// History 的预算作用于对话历史本身，不截断引导语；Lore 的预算由世界书引擎按整条目控制。
+	if name == SectionHistory || name == SectionLore {
+		return text, nil
+	}
+	if truncated := utils.TruncateToTokens(text, s.maxTokens); len(truncated) < len(text) {
+		slog.Info("prompt section trimmed to token budget", "section", name, "budget", s.maxTokens, "tokens", utils.EstimateTokens(text))
+		text = truncated
+	}
+	return text, nil
+}
@@ -0,0 +1,119 @@
+package prompt
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/easeaico/project-her/internal/types"
+)
+
+func sampleData() Data {
+	return Data{
+		CharName:          "Ava",
+		UserName:          "小明",
+		Personality:       "温柔",
+		Now:               "2025-01-01T08:00:00Z",
+		RelationshipLevel: "Friend",
+		Facts:             "- 小明住在上海 (since 2026-05-01)\n",
+		Memories:          "- 小明喜欢猫",
+		MessageExample:    "Ava: *挥手* 你好呀",
+	}
+}
+
+func TestAssemblerRendersSectionsInOrder(t *testing.T) {
+	templates, err := LoadTemplates("")
+	if err != nil {
+		t.Fatalf("failed to load templates: %v", err)
+	}
+	assembler, err := NewAssembler(templates, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create assembler: %v", err)
+	}
+
+	instruction, err := assembler.Instruction(sampleData())
+	if err != nil {
+		t.Fatalf("failed to render instruction: %v", err)
+	}
+	markers := []string{"You are a roleplay engine", "[Character Name: Ava]", "The user's name is 小明", "[Known Facts about 小明:\n- 小明住在上海", "[Memories: - 小明喜欢猫]", "[Message Example:", "(The conversation continues below...)"}
+	last := -1
+	for _, marker := range markers {
+		idx := strings.Index(instruction, marker)
+		if idx <= last {
+			t.Fatalf("expected %q after previous sections, got instruction:\n%s", marker, instruction)
+		}
+		last = idx
+	}
+	if strings.Contains(instruction, "Story So Far") || strings.Contains(instruction, "Location") {
+		t.Fatalf("expected empty blocks to be omitted, got:\n%s", instruction)
+	}
+	if strings.Contains(instruction, "System Note") {
+		t.Fatalf("anchor must not be part of the system instruction")
+	}
+
+	anchor, err := assembler.Anchor(sampleData())
+	if err != nil || !strings.Contains(anchor, "Stay in character") {
+		t.Fatalf("unexpected anchor %q, err %v", anchor, err)
+	}
+
+	// 角色卡的 post_history_instructions 替换默认的 Anchor 内容。
+	data := sampleData()
+	data.PostHistoryInstructions = "[Ava 只用短句回答]"
+	if anchor, err := assembler.Anchor(data); err != nil || anchor != "[Ava 只用短句回答]" {
+		t.Fatalf("unexpected anchor %q, err %v", anchor, err)
+	}
+}
+
+func TestAssemblerAppliesCharacterOverrides(t *testing.T) {
+	templates, err := LoadTemplates("")
+	if err != nil {
+		t.Fatalf("failed to load templates: %v", err)
+	}
+	assembler, err := NewAssembler(templates, map[string]int{SectionPersona: 1000}, []types.PromptSection{
+		{Section: "anchor", Enabled: true, Template: "[System Note: {{.CharName}} 说话很少，每次不超过 20 字。]"},
+		{Section: "few_shot", Enabled: false},
+		{Section: "persona", Enabled: true, MaxTokens: 5},
+		{Section: "unknown", Enabled: true},
+	})
+	if err != nil {
+		t.Fatalf("failed to create assembler: %v", err)
+	}
+
+	instruction, err := assembler.Instruction(sampleData())
+	if err != nil {
+		t.Fatalf("failed to render instruction: %v", err)
+	}
+	if strings.Contains(instruction, "Message Example") {
+		t.Fatalf("expected disabled few-shot section to be dropped, got:\n%s", instruction)
+	}
+	if strings.Contains(instruction, "[Personality: 温柔]") || assembler.Budget(SectionPersona) != 5 {
+		t.Fatalf("expected persona section to be cut to its budget, got:\n%s", instruction)
+	}
+	anchor, err := assembler.Anchor(sampleData())
+	if err != nil || anchor != "[System Note: Ava 说话很少，每次不超过 20 字。]" {
+		t.Fatalf("unexpected anchor %q, err %v", anchor, err)
+	}
+}
+
+func TestLoadTemplatesPrefersFilesOnDisk(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "system.tmpl"), []byte("你是一个中文角色扮演引擎。"), 0o644); err != nil {
+		t.Fatalf("failed to write template: %v", err)
+	}
+
+	templates, err := LoadTemplates(dir)
+	if err != nil {
+		t.Fatalf("failed to load templates: %v", err)
+	}
+	if templates[SectionSystem] != "你是一个中文角色扮演引擎。" {
+		t.Fatalf("expected disk template to replace the default, got %q", templates[SectionSystem])
+	}
+	if !strings.Contains(templates[SectionPersona], "{{.CharName}}") {
+		t.Fatalf("expected missing files to keep the default, got %q", templates[SectionPersona])
+	}
+
+	if _, err := NewAssembler(templates, nil, []types.PromptSection{{Section: "world", Enabled: true, Template: "{{.Broken"}}); err == nil {
+		t.Fatalf("expected invalid override template to fail")
+	}
+}
@@ -2,12 +2,15 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
 	"gorm.io/gorm"
 
 	"github.com/easeaico/project-her/internal/agent"
+	"github.com/easeaico/project-her/internal/card"
 	"github.com/easeaico/project-her/internal/types"
 )
 
@@ -21,14 +24,46 @@ type characterModel struct {
 	MesExample   string `gorm:"column:mes_example"`
 	SystemPrompt string
 	Avatar       string `gorm:"column:avatar"`
-	CreatedAt    time.Time
-	UpdatedAt    time.Time
+	// Generation profile columns; NULL falls back to provider defaults.
+	Temperature      *float32
+	TopP             *float32
+	PresencePenalty  *float32
+	FrequencyPenalty *float32
+	StopSequences    json.RawMessage `gorm:"type:jsonb"`
+	Seed             *int32
+	MaxOutputTokens  *int32
+	// Character card columns; arrays and objects are stored as JSONB.
+	PostHistoryInstructions string
+	AlternateGreetings      json.RawMessage `gorm:"type:jsonb"`
+	Tags                    json.RawMessage `gorm:"type:jsonb"`
+	Creator                 string
+	CreatorNotes            string
+	CharacterVersion        string
+	CharacterBook           json.RawMessage `gorm:"type:jsonb"`
+	Extensions              json.RawMessage `gorm:"type:jsonb"`
+	// AvatarImage is written on create only; read it through GetAvatar.
+	AvatarImage []byte `gorm:"->:false;<-:create"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
 }
 
 func (characterModel) TableName() string {
 	return "characters"
 }
 
+// promptSectionModel maps to the character_prompt_sections table.
+type promptSectionModel struct {
+	CharacterID int
+	Section     string
+	Template    *string
+	Enabled     bool
+	MaxTokens   *int
+}
+
+func (promptSectionModel) TableName() string {
+	return "character_prompt_sections"
+}
+
 // CharacterRepo accesses characters data.
 type characterRepo struct {
 	db *gorm.DB
@@ -39,34 +74,173 @@ func NewCharacterRepo(db *gorm.DB) agent.CharacterRepo {
 	return &characterRepo{db: db}
 }
 
+// NewCardRepo returns the character repository used by card import/export.
+func NewCardRepo(db *gorm.DB) card.Repo {
+	return &characterRepo{db: db}
+}
+
 func (r *characterRepo) GetByID(ctx context.Context, id int) (*types.Character, error) {
 	var model characterModel
-	if err := r.db.WithContext(ctx).First(&model, id).Error; err != nil {
+	err := r.db.WithContext(ctx).Omit("avatar_image").First(&model, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to get character by id %d: %w", id, agent.ErrCharacterNotFound)
+	}
+	if err != nil {
 		return nil, fmt.Errorf("failed to get character by id: %w", err)
 	}
-	return characterFromModel(model), nil
+	return r.withPromptSections(ctx, characterFromModel(model))
 }
 
 func (r *characterRepo) GetDefault(ctx context.Context) (*types.Character, error) {
 	var model characterModel
-	if err := r.db.WithContext(ctx).Order("id ASC").Limit(1).First(&model).Error; err != nil {
+	if err := r.db.WithContext(ctx).Omit("avatar_image").Order("id ASC").Limit(1).First(&model).Error; err != nil {
 		return nil, fmt.Errorf("failed to get default character: %w", err)
 	}
-	return characterFromModel(model), nil
+	return r.withPromptSections(ctx, characterFromModel(model))
+}
+
+func (r *characterRepo) ListUpdatedAt(ctx context.Context) (map[int]time.Time, error) {
+	var models []characterModel
+	if err := r.db.WithContext(ctx).Select("id", "updated_at").Find(&models).Error; err != nil {
+		return nil, fmt.Errorf("failed to list characters: %w", err)
+	}
+	versions := make(map[int]time.Time, len(models))
+	for _, model := range models {
+		versions[model.ID] = model.UpdatedAt
+	}
+	return versions, nil
+}
+
+func (r *characterRepo) Create(ctx context.Context, character *types.Character, avatar []byte) (int, error) {
+	model, err := characterToModel(character)
+	if err != nil {
+		return 0, err
+	}
+	model.AvatarImage = avatar
+	if err := r.db.WithContext(ctx).Create(&model).Error; err != nil {
+		return 0, fmt.Errorf("failed to create character: %w", err)
+	}
+	return model.ID, nil
+}
+
+func (r *characterRepo) GetAvatar(ctx context.Context, id int) ([]byte, error) {
+	var avatar []byte
+	row := r.db.WithContext(ctx).Model(&characterModel{}).Select("avatar_image").Where("id = ?", id).Row()
+	if err := row.Scan(&avatar); err != nil {
+		return nil, fmt.Errorf("failed to get character avatar: %w", err)
+	}
+	return avatar, nil
+}
+
+// withPromptSections loads the character's prompt section overrides.
+func (r *characterRepo) withPromptSections(ctx context.Context, character *types.Character) (*types.Character, error) {
+	var models []promptSectionModel
+	if err := r.db.WithContext(ctx).Where("character_id = ?", character.ID).Order("section ASC").Find(&models).Error; err != nil {
+		return nil, fmt.Errorf("failed to get prompt sections: %w", err)
+	}
+	for _, model := range models {
+		section := types.PromptSection{Section: model.Section, Enabled: model.Enabled}
+		if model.Template != nil {
+			section.Template = *model.Template
+		}
+		if model.MaxTokens != nil {
+			section.MaxTokens = *model.MaxTokens
+		}
+		character.PromptSections = append(character.PromptSections, section)
+	}
+	return character, nil
 }
 
 func characterFromModel(model characterModel) *types.Character {
+	var stops []string
+	if err := unmarshalJSON(model.StopSequences, &stops); err != nil {
+		fmt.Printf("Warning: failed to unmarshal stop_sequences for character ID %d: %v\n", model.ID, err)
+	}
+	var maxTokens int32
+	if model.MaxOutputTokens != nil {
+		maxTokens = *model.MaxOutputTokens
+	}
+	var greetings, tags []string
+	if err := unmarshalJSON(model.AlternateGreetings, &greetings); err != nil {
+		fmt.Printf("Warning: failed to unmarshal alternate_greetings for character ID %d: %v\n", model.ID, err)
+	}
+	if err := unmarshalJSON(model.Tags, &tags); err != nil {
+		fmt.Printf("Warning: failed to unmarshal tags for character ID %d: %v\n", model.ID, err)
+	}
 	return &types.Character{
-		ID:             model.ID,
-		Name:           model.Name,
-		Description:    model.Description,
-		Personality:    model.Personality,
-		Scenario:       model.Scenario,
-		FirstMessage:   model.FirstMessage,
-		MessageExample: model.MesExample,
-		SystemPrompt:   model.SystemPrompt,
-		Avatar:         model.Avatar,
-		CreatedAt:      model.CreatedAt,
-		UpdatedAt:      model.UpdatedAt,
+		ID:                      model.ID,
+		Name:                    model.Name,
+		Description:             model.Description,
+		Personality:             model.Personality,
+		Scenario:                model.Scenario,
+		FirstMessage:            model.FirstMessage,
+		MessageExample:          model.MesExample,
+		SystemPrompt:            model.SystemPrompt,
+		Avatar:                  model.Avatar,
+		PostHistoryInstructions: model.PostHistoryInstructions,
+		AlternateGreetings:      greetings,
+		Tags:                    tags,
+		Creator:                 model.Creator,
+		CreatorNotes:            model.CreatorNotes,
+		CharacterVersion:        model.CharacterVersion,
+		CharacterBook:           model.CharacterBook,
+		Extensions:              model.Extensions,
+		Generation: types.GenerationProfile{
+			Temperature:      model.Temperature,
+			TopP:             model.TopP,
+			PresencePenalty:  model.PresencePenalty,
+			FrequencyPenalty: model.FrequencyPenalty,
+			StopSequences:    stops,
+			Seed:             model.Seed,
+			MaxOutputTokens:  maxTokens,
+		},
+		CreatedAt: model.CreatedAt,
+		UpdatedAt: model.UpdatedAt,
+	}
+}
+
+func characterToModel(character *types.Character) (characterModel, error) {
+	model := characterModel{
+		Name:                    character.Name,
+		Description:             character.Description,
+		Personality:             character.Personality,
+		Scenario:                character.Scenario,
+		FirstMessage:            character.FirstMessage,
+		MesExample:              character.MessageExample,
+		SystemPrompt:            character.SystemPrompt,
+		Avatar:                  character.Avatar,
+		Temperature:             character.Generation.Temperature,
+		TopP:                    character.Generation.TopP,
+		PresencePenalty:         character.Generation.PresencePenalty,
+		FrequencyPenalty:        character.Generation.FrequencyPenalty,
+		Seed:                    character.Generation.Seed,
+		PostHistoryInstructions: character.PostHistoryInstructions,
+		Creator:                 character.Creator,
+		CreatorNotes:            character.CreatorNotes,
+		CharacterVersion:        character.CharacterVersion,
+		CharacterBook:           character.CharacterBook,
+		Extensions:              character.Extensions,
+	}
+	if character.Generation.MaxOutputTokens > 0 {
+		model.MaxOutputTokens = &character.Generation.MaxOutputTokens
+	}
+	var err error
+	if model.StopSequences, err = marshalJSONArray(character.Generation.StopSequences); err != nil {
+		return model, fmt.Errorf("failed to marshal stop_sequences: %w", err)
+	}
+	if model.AlternateGreetings, err = marshalJSONArray(character.AlternateGreetings); err != nil {
+		return model, fmt.Errorf("failed to marshal alternate_greetings: %w", err)
+	}
+	if model.Tags, err = marshalJSONArray(character.Tags); err != nil {
+		return model, fmt.Errorf("failed to marshal tags: %w", err)
+	}
+	return model, nil
+}
+
+// marshalJSONArray encodes values as a JSON array; empty slices are stored as NULL.
+func marshalJSONArray(values []string) (json.RawMessage, error) {
+	if len(values) == 0 {
+		return nil, nil
 	}
+	return json.Marshal(values)
 }
@@ -16,10 +16,13 @@ type chatHistoryModel struct {
 	ID         int
 	UserID     string
 	AppName    string
+	SessionID  *string
 	Content    string
 	TurnCount  int
 	Summarized bool
+	ClosedAt   *time.Time
 	CreatedAt  time.Time
+	UpdatedAt  time.Time
 }
 
 func (chatHistoryModel) TableName() string {
@@ -47,9 +50,15 @@ func (r *chatHistoryRepo) CreateWindow(ctx context.Context, history *types.ChatH
 		TurnCount:  history.TurnCount,
 		Summarized: history.Summarized,
 	}
+	if history.SessionID != "" {
+		record.SessionID = &history.SessionID
+	}
 	if err := r.db.WithContext(ctx).Create(&record).Error; err != nil {
 		return fmt.Errorf("failed to insert chat history: %w", err)
 	}
+	history.ID = record.ID
+	history.CreatedAt = record.CreatedAt
+	history.UpdatedAt = record.UpdatedAt
 	return nil
 }
 
@@ -76,20 +85,74 @@ func (r *chatHistoryRepo) GetLatestWindow(ctx context.Context, userID, appName s
 	return &result, nil
 }
 
+func (r *chatHistoryRepo) GetWindow(ctx context.Context, id int) (*types.ChatHistory, error) {
+	var record chatHistoryModel
+	if err := r.db.WithContext(ctx).Where("id = ?", id).Limit(1).Find(&record).Error; err != nil {
+		return nil, fmt.Errorf("failed to query chat window: %w", err)
+	}
+	if record.ID == 0 {
+		return nil, nil
+	}
+	result := chatHistoryFromModel(record)
+	return &result, nil
+}
+
 func (r *chatHistoryRepo) UpdateWindow(ctx context.Context, history *types.ChatHistory, content string, turnCount int) error {
-	if err := r.db.WithContext(ctx).
+	result := r.db.WithContext(ctx).
 		Model(&chatHistoryModel{}).
 		Where("id = ?", history.ID).
 		Where("turn_count = ?", history.TurnCount).
+		Where("closed_at IS NULL AND NOT summarized").
 		Updates(map[string]any{
 			"content":    content,
 			"turn_count": turnCount,
-		}).Error; err != nil {
-		return fmt.Errorf("failed to update chat window: %w", err)
+			"updated_at": time.Now(),
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update chat window: %w", result.Error)
+	}
+	// The window was closed, summarized or appended to since it was read.
+	if result.RowsAffected == 0 {
+		return memory.ErrStaleWindow
+	}
+	return nil
+}
+
+func (r *chatHistoryRepo) CloseWindow(ctx context.Context, id int) error {
+	if err := r.db.WithContext(ctx).
+		Model(&chatHistoryModel{}).
+		Where("id = ? AND closed_at IS NULL", id).
+		Update("closed_at", time.Now()).Error; err != nil {
+		return fmt.Errorf("failed to close chat window: %w", err)
 	}
 	return nil
 }
 
+func (r *chatHistoryRepo) ListOpenWindows(ctx context.Context, idleBefore, openedBefore time.Time) ([]types.ChatHistory, error) {
+	if idleBefore.IsZero() && openedBefore.IsZero() {
+		return nil, nil
+	}
+	query := r.db.WithContext(ctx).Where("NOT summarized AND closed_at IS NULL")
+	switch {
+	case idleBefore.IsZero():
+		query = query.Where("created_at < ?", openedBefore)
+	case openedBefore.IsZero():
+		query = query.Where("updated_at < ?", idleBefore)
+	default:
+		query = query.Where("updated_at < ? OR created_at < ?", idleBefore, openedBefore)
+	}
+
+	var records []chatHistoryModel
+	if err := query.Order("updated_at").Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to query open chat windows: %w", err)
+	}
+	results := make([]types.ChatHistory, 0, len(records))
+	for _, record := range records {
+		results = append(results, chatHistoryFromModel(record))
+	}
+	return results, nil
+}
+
 func (r *chatHistoryRepo) GetRecent(ctx context.Context, userID, appName string, limit int) ([]types.ChatHistory, error) {
 	query := r.db.WithContext(ctx).Order("created_at DESC").Limit(limit)
 	if userID != "" {
@@ -127,13 +190,19 @@ func (r *chatHistoryRepo) MarkSummarized(ctx context.Context, id int) error {
 }
 
 func chatHistoryFromModel(model chatHistoryModel) types.ChatHistory {
-	return types.ChatHistory{
+	history := types.ChatHistory{
 		ID:         model.ID,
 		UserID:     model.UserID,
 		AppName:    model.AppName,
 		Content:    model.Content,
 		TurnCount:  model.TurnCount,
 		Summarized: model.Summarized,
+		ClosedAt:   model.ClosedAt,
 		CreatedAt:  model.CreatedAt,
+		UpdatedAt:  model.UpdatedAt,
+	}
+	if model.SessionID != nil {
+		history.SessionID = *model.SessionID
 	}
+	return history
 }
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/easeaico/project-her/internal/lorebook"
+	"github.com/easeaico/project-her/internal/types"
+)
+
+// lorebookEntryModel maps to the lorebook_entries table.
+type lorebookEntryModel struct {
+	ID               int
+	CharacterID      *int
+	Name             string
+	Keys             json.RawMessage `gorm:"type:jsonb"`
+	SecondaryKeys    json.RawMessage `gorm:"type:jsonb"`
+	Content          string
+	Enabled          bool
+	Constant         bool
+	CaseSensitive    bool
+	InsertionOrder   int
+	Depth            *int
+	Probability      int
+	ScanDepth        *int
+	PreventRecursion bool
+	ExcludeRecursion bool
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
+
+func (lorebookEntryModel) TableName() string {
+	return "lorebook_entries"
+}
+
+// lorebookRepo accesses lorebook entries.
+type lorebookRepo struct {
+	db *gorm.DB
+}
+
+// NewLorebookRepo returns a lorebook Repo.
+func NewLorebookRepo(db *gorm.DB) lorebook.Repo {
+	return &lorebookRepo{db: db}
+}
+
+func (r *lorebookRepo) ListEntries(ctx context.Context, characterID int) ([]types.LoreEntry, error) {
+	var models []lorebookEntryModel
+	err := r.db.WithContext(ctx).
+		Where("enabled AND (character_id = ? OR character_id IS NULL)", characterID).
+		Order("insertion_order ASC, id ASC").
+		Find(&models).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list lorebook entries: %w", err)
+	}
+
+	entries := make([]types.LoreEntry, 0, len(models))
+	for _, model := range models {
+		entries = append(entries, loreEntryFromModel(model))
+	}
+	return entries, nil
+}
+
+func loreEntryFromModel(model lorebookEntryModel) types.LoreEntry {
+	var keys, secondary []string
+	if err := unmarshalJSON(model.Keys, &keys); err != nil {
+		fmt.Printf("Warning: failed to unmarshal keys for lorebook entry ID %d: %v\n", model.ID, err)
+	}
+	if err := unmarshalJSON(model.SecondaryKeys, &secondary); err != nil {
+		fmt.Printf("Warning: failed to unmarshal secondary_keys for lorebook entry ID %d: %v\n", model.ID, err)
+	}
+	entry := types.LoreEntry{
+		ID:               model.ID,
+		CharacterID:      model.CharacterID,
+		Name:             model.Name,
+		Keys:             keys,
+		SecondaryKeys:    secondary,
+		Content:          model.Content,
+		Constant:         model.Constant,
+		CaseSensitive:    model.CaseSensitive,
+		Order:            model.InsertionOrder,
+		Depth:            model.Depth,
+		Probability:      model.Probability,
+		PreventRecursion: model.PreventRecursion,
+		ExcludeRecursion: model.ExcludeRecursion,
+	}
+	if model.ScanDepth != nil {
+		entry.ScanDepth = *model.ScanDepth
+	}
+	return entry
+}
@@ -4,10 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
 
 	"github.com/pgvector/pgvector-go"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/easeaico/project-her/internal/types"
 )
@@ -28,7 +32,13 @@ type memoryModel struct {
 	Salience float64 `gorm:"column:salience_score"`
 	// Embedding stores vector representation for similarity search.
 	Embedding *pgvector.Vector `gorm:"type:vector"`
-	CreatedAt time.Time
+	// ChatHistoryID links turn memories to their chat window.
+	ChatHistoryID *int
+	// FactKey/ValidFrom/ValidUntil describe fact memories.
+	FactKey    *string
+	ValidFrom  *time.Time
+	ValidUntil *time.Time
+	CreatedAt  time.Time
 }
 
 func (memoryModel) TableName() string {
@@ -80,12 +90,87 @@ func (r *MemoryRepo) AddMemory(ctx context.Context, mem types.Memory) error {
 		Salience:    mem.Salience,
 		Embedding:   vector,
 	}
+	if mem.ChatHistoryID != 0 {
+		record.ChatHistoryID = &mem.ChatHistoryID
+	}
 	if err := r.db.WithContext(ctx).Create(&record).Error; err != nil {
 		return fmt.Errorf("failed to insert memory: %w", err)
 	}
 	return nil
 }
 
+// SaveFact stores a fact memory. A current fact with the same key and text
+// makes it a no-op; a current fact with the same key but other text is
+// superseded, its validity ending where the new fact's begins.
+func (r *MemoryRepo) SaveFact(ctx context.Context, fact types.Memory) error {
+	validFrom := time.Now()
+	if fact.ValidFrom != nil {
+		validFrom = *fact.ValidFrom
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var current []memoryModel
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND app_name = ? AND type = ? AND fact_key = ? AND valid_until IS NULL",
+				fact.UserID, fact.AppName, types.MemoryTypeFacts, fact.FactKey).
+			Find(&current).Error; err != nil {
+			return fmt.Errorf("failed to query current fact: %w", err)
+		}
+		ids := make([]int, 0, len(current))
+		for _, record := range current {
+			if record.Summary == fact.Summary {
+				return nil
+			}
+			ids = append(ids, record.ID)
+		}
+		if len(ids) > 0 {
+			if err := tx.Model(&memoryModel{}).
+				Where("id IN ?", ids).
+				Update("valid_until", validFrom).Error; err != nil {
+				return fmt.Errorf("failed to supersede fact: %w", err)
+			}
+		}
+
+		var vector *pgvector.Vector
+		if len(fact.Embedding) > 0 {
+			v := pgvector.NewVector(fact.Embedding)
+			vector = &v
+		}
+		record := memoryModel{
+			UserID:    fact.UserID,
+			AppName:   fact.AppName,
+			Type:      types.MemoryTypeFacts,
+			Summary:   fact.Summary,
+			Salience:  fact.Salience,
+			Embedding: vector,
+			FactKey:   &fact.FactKey,
+			ValidFrom: &validFrom,
+		}
+		if err := tx.Create(&record).Error; err != nil {
+			return fmt.Errorf("failed to insert fact: %w", err)
+		}
+		return nil
+	})
+}
+
+// ListActiveFacts returns the user's current facts, newest first.
+func (r *MemoryRepo) ListActiveFacts(ctx context.Context, userID, appName string, limit int) ([]types.Memory, error) {
+	query := r.db.WithContext(ctx).
+		Where("user_id = ? AND app_name = ? AND type = ? AND valid_until IS NULL", userID, appName, types.MemoryTypeFacts).
+		Order("valid_from DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	var records []memoryModel
+	if err := query.Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to query facts: %w", err)
+	}
+	results := make([]types.Memory, 0, len(records))
+	for _, record := range records {
+		results = append(results, memoryFromModel(record))
+	}
+	return results, nil
+}
+
 func (r *MemoryRepo) GetRecentMemories(ctx context.Context, memoryType string, limit int) ([]types.Memory, error) {
 	query := r.db.WithContext(ctx).Order("created_at DESC").Limit(limit)
 	if memoryType != "" {
@@ -109,53 +194,135 @@ func (r *MemoryRepo) GetRecentMemories(ctx context.Context, memoryType string, l
 	return results, nil
 }
 
-func (r *MemoryRepo) SearchSimilar(ctx context.Context, userID, appName, memoryType string, embedding []float32, topK int, threshold float64) ([]types.RetrievedMemory, error) {
-	if len(embedding) == 0 {
+// DeleteWindowMemories removes the memories of the given type that belong to a chat window.
+func (r *MemoryRepo) DeleteWindowMemories(ctx context.Context, chatHistoryID int, memoryType string) error {
+	if err := r.db.WithContext(ctx).
+		Where("chat_history_id = ? AND type = ?", chatHistoryID, memoryType).
+		Delete(&memoryModel{}).Error; err != nil {
+		return fmt.Errorf("failed to delete window memories: %w", err)
+	}
+	return nil
+}
+
+// SearchHybrid fuses two candidate rankings with reciprocal rank fusion: the
+// nearest embeddings above the similarity threshold, and lexical hits on the
+// full-text index (any query term matches) or the trigram index (which also
+// covers Chinese text without word boundaries when the database LC_CTYPE is
+// a UTF-8 locale). Each ranking adds
+// weight / (k + rank); salience then ranks the fused hits as a third list.
+// Turn memories whose window has already been summarized are covered by the
+// summary and skipped.
+func (r *MemoryRepo) SearchHybrid(ctx context.Context, query types.MemoryQuery) ([]types.RetrievedMemory, error) {
+	text := strings.TrimSpace(query.Text)
+	if len(query.Embedding) == 0 && text == "" {
 		return nil, nil
 	}
+	sql, args := hybridSearchSQL(query, text)
+
+	var results []types.RetrievedMemory
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// The <% operator uses this threshold and can be served by the trigram index.
+		if err := tx.Exec("SELECT set_config('pg_trgm.word_similarity_threshold', ?, true)",
+			strconv.FormatFloat(query.LexicalThreshold, 'f', -1, 64)).Error; err != nil {
+			return err
+		}
+		return tx.Raw(sql, args...).Scan(&results).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search memories: %w", err)
+	}
+	return results, nil
+}
 
-	// Filter by cosine similarity and then re-rank by salience.
-	conditions := "embedding IS NOT NULL AND 1 - (embedding <=> $1) > $2"
-	args := []any{pgvector.NewVector(embedding), threshold}
-	argIndex := 3
+// hybridSearchSQL builds the SearchHybrid statement with positional ($n)
+// arguments. A ranking whose input is empty becomes an empty relation, so the
+// FULL JOIN keeps the other ranking as is.
+func hybridSearchSQL(query types.MemoryQuery, text string) (string, []any) {
+	var args []any
+	arg := func(value any) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
 
-	if userID != "" {
-		conditions += fmt.Sprintf(" AND user_id = $%d", argIndex)
-		args = append(args, userID)
-		argIndex++
+	conditions := `NOT EXISTS (
+			SELECT 1 FROM chat_histories h
+			WHERE h.id = memories.chat_history_id AND h.summarized
+		)`
+	if query.UserID != "" {
+		conditions += " AND user_id = " + arg(query.UserID)
 	}
-	if memoryType != "" {
-		conditions += fmt.Sprintf(" AND type = $%d", argIndex)
-		args = append(args, memoryType)
-		argIndex++
+	if len(query.Types) > 0 {
+		conditions += " AND type = ANY(" + arg(query.Types) + ")"
 	}
-	if appName != "" {
-		conditions += fmt.Sprintf(" AND app_name = $%d", argIndex)
-		args = append(args, appName)
-		argIndex++
+	if query.AppName != "" {
+		conditions += " AND app_name = " + arg(query.AppName)
 	}
+	candidates := arg(max(query.Candidates, query.TopK))
 
-	query := fmt.Sprintf(`
-		SELECT role, content, type, created_at, similarity, salience_score
-		FROM (
-			SELECT 'assistant' AS role, summary AS content, type, created_at,
-			       1 - (embedding <=> $1) AS similarity,
-			       COALESCE(salience_score, 0) AS salience_score
-			FROM memories
-			WHERE %s
-		) AS scored
-		ORDER BY (0.85 * similarity + 0.15 * salience_score) DESC
-		LIMIT $%d`, conditions, argIndex)
+	vectorHits := `SELECT NULL::int AS id, NULL::bigint AS rank, NULL::float8 AS similarity WHERE false`
+	if len(query.Embedding) > 0 {
+		embedding := arg(pgvector.NewVector(query.Embedding))
+		vectorHits = fmt.Sprintf(`
+			SELECT id, row_number() OVER (ORDER BY distance) AS rank, 1 - distance AS similarity
+			FROM (
+				SELECT id, embedding <=> %[1]s AS distance
+				FROM memories
+				WHERE embedding IS NOT NULL AND 1 - (embedding <=> %[1]s) > %[2]s AND %[3]s
+				ORDER BY embedding <=> %[1]s
+				LIMIT %[4]s
+			) AS nearest`, embedding, arg(query.SimilarityThreshold), conditions, candidates)
+	}
 
-	args = append(args, topK)
+	lexicalHits := `SELECT NULL::int AS id, NULL::bigint AS rank WHERE false`
+	if text != "" {
+		textArg := arg(text)
+		lexicalHits = fmt.Sprintf(`
+			SELECT id, row_number() OVER (ORDER BY score DESC) AS rank
+			FROM (
+				SELECT id, GREATEST(ts_rank_cd(search_tsv, q), word_similarity(%[1]s, search_text)) AS score
+				FROM memories, to_tsquery('simple', %[2]s) AS q
+				WHERE (search_tsv @@ q OR %[1]s <%% search_text) AND %[3]s
+				ORDER BY score DESC
+				LIMIT %[4]s
+			) AS matched`, textArg, arg(anyTermQuery(text)), conditions, candidates)
+	}
 
-	var results []types.RetrievedMemory
-	if err := r.db.WithContext(ctx).
-		Raw(query, args...).
-		Scan(&results).Error; err != nil {
-		return nil, fmt.Errorf("failed to search similar memories: %w", err)
+	k := arg(max(query.RRFK, 1))
+	sql := fmt.Sprintf(`
+		WITH vector_hits AS (%[1]s),
+		lexical_hits AS (%[2]s),
+		fused AS (
+			SELECT id,
+			       COALESCE(v.similarity, 0) AS similarity,
+			       COALESCE(%[3]s::float8 / (%[6]s + v.rank), 0)
+			       + COALESCE(%[4]s::float8 / (%[6]s + l.rank), 0) AS score
+			FROM vector_hits v FULL JOIN lexical_hits l USING (id)
+		)
+		SELECT role, content, type, created_at, similarity, salience_score, score
+		FROM (
+			SELECT CASE WHEN m.type = 'turn' THEN '' ELSE 'assistant' END AS role,
+			       m.summary AS content, m.type, m.created_at, f.similarity,
+			       COALESCE(m.salience_score, 0) AS salience_score,
+			       f.score + %[5]s::float8 / (%[6]s + row_number() OVER (ORDER BY COALESCE(m.salience_score, 0) DESC)) AS score
+			FROM fused f JOIN memories m ON m.id = f.id
+		) AS ranked
+		ORDER BY score DESC
+		LIMIT %[7]s`,
+		vectorHits, lexicalHits,
+		arg(query.VectorWeight), arg(query.LexicalWeight), arg(query.SalienceWeight), k, arg(query.TopK))
+	return sql, args
+}
+
+// anyTermQuery builds a tsquery source matching any word of text. Terms keep
+// only letters and digits, so they never need escaping.
+func anyTermQuery(text string) string {
+	terms := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, term := range terms {
+		terms[i] = "'" + term + "'"
 	}
-	return results, nil
+	return strings.Join(terms, " | ")
 }
 
 // memoryFromModel converts database model to domain struct.
@@ -179,7 +346,7 @@ func memoryFromModel(model memoryModel) types.Memory {
 		fmt.Printf("Warning: failed to unmarshal time_range for memory ID %d: %v\n", model.ID, err)
 	}
 
-	return types.Memory{
+	mem := types.Memory{
 		ID:          model.ID,
 		UserID:      model.UserID,
 		AppName:     model.AppName,
@@ -190,8 +357,17 @@ func memoryFromModel(model memoryModel) types.Memory {
 		Emotions:    emotions,
 		TimeRange:   timeRange,
 		Salience:    model.Salience,
+		ValidFrom:   model.ValidFrom,
+		ValidUntil:  model.ValidUntil,
 		CreatedAt:   model.CreatedAt,
 	}
+	if model.FactKey != nil {
+		mem.FactKey = *model.FactKey
+	}
+	if model.ChatHistoryID != nil {
+		mem.ChatHistoryID = *model.ChatHistoryID
+	}
+	return mem
 }
 
 // marshalJSON encodes a value into JSONB, returning nil for empty values.
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/easeaico/project-her/internal/types"
+)
+
+// placeholders returns the distinct $n numbers used in sql, in ascending order.
+func placeholders(sql string) []int {
+	var numbers []int
+	for _, match := range regexp.MustCompile(`\$(\d+)`).FindAllStringSubmatch(sql, -1) {
+		n, _ := strconv.Atoi(match[1])
+		if !slices.Contains(numbers, n) {
+			numbers = append(numbers, n)
+		}
+	}
+	slices.Sort(numbers)
+	return numbers
+}
+
+func TestHybridSearchSQLNumbersEveryArgument(t *testing.T) {
+	query := types.MemoryQuery{
+		UserID:         "user",
+		AppName:        "project_her_roleplay_1",
+		Types:          []string{types.MemoryTypeChat, types.MemoryTypeTurn},
+		Embedding:      []float32{0.1, 0.2},
+		TopK:           5,
+		Candidates:     20,
+		RRFK:           60,
+		VectorWeight:   1,
+		LexicalWeight:  1,
+		SalienceWeight: 0.3,
+	}
+	for _, tc := range []struct {
+		name      string
+		embedding []float32
+		text      string
+	}{
+		{"both", query.Embedding, "年糕 Zootopia"},
+		{"vector only", query.Embedding, ""},
+		{"lexical only", nil, "年糕"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			q := query
+			q.Embedding = tc.embedding
+			sql, args := hybridSearchSQL(q, tc.text)
+
+			// 每个参数恰好对应一个连续编号的占位符。
+			want := make([]int, len(args))
+			for i := range args {
+				want[i] = i + 1
+			}
+			if got := placeholders(sql); !slices.Equal(got, want) {
+				t.Fatalf("expected placeholders %v, got %v in %s", want, got, sql)
+			}
+			if hasVector := strings.Contains(sql, "embedding <=>"); hasVector != (len(tc.embedding) > 0) {
+				t.Fatalf("expected vector ranking only with an embedding, got %s", sql)
+			}
+			if hasLexical := strings.Contains(sql, "search_tsv @@ q"); hasLexical != (tc.text != "") {
+				t.Fatalf("expected lexical ranking only with query text, got %s", sql)
+			}
+			if tc.text != "" && (!strings.Contains(sql, " <% search_text") || strings.Contains(sql, "<%%")) {
+				t.Fatalf("expected the trigram operator to be unescaped, got %s", sql)
+			}
+			if !strings.Contains(sql, "FULL JOIN lexical_hits l USING (id)") {
+				t.Fatalf("expected the rankings to be fused, got %s", sql)
+			}
+		})
+	}
+}
+
+func TestHybridSearchSQLPassesFusionSettingsInOrder(t *testing.T) {
+	sql, args := hybridSearchSQL(types.MemoryQuery{
+		UserID:         "user",
+		TopK:           5,
+		Candidates:     3,
+		RRFK:           0,
+		VectorWeight:   0.7,
+		LexicalWeight:  0.4,
+		SalienceWeight: 0.2,
+	}, "猫")
+
+	// 候选数不少于 TopK，RRF 常数至少为 1。
+	if len(args) != 9 {
+		t.Fatalf("expected 9 arguments, got %d: %v", len(args), args)
+	}
+	if args[0] != "user" || args[1] != 5 || args[2] != "猫" || args[3] != "'猫'" {
+		t.Fatalf("unexpected filter and lexical arguments %v", args[:4])
+	}
+	if args[4] != 1 || args[5] != 0.7 || args[6] != 0.4 || args[7] != 0.2 || args[8] != 5 {
+		t.Fatalf("unexpected fusion arguments %v", args[4:])
+	}
+	if !strings.Contains(sql, "$6::float8 / ($5 + v.rank)") || !strings.Contains(sql, "$7::float8 / ($5 + l.rank)") || !strings.Contains(sql, "$8::float8 / ($5 + row_number()") || !strings.Contains(sql, "LIMIT $9") {
+		t.Fatalf("expected weights and k to be wired into the RRF terms, got %s", sql)
+	}
+}
@@ -5,6 +5,9 @@ import (
 	"fmt"
 
 	"github.com/easeaico/project-her/internal/agent"
+	"github.com/easeaico/project-her/internal/callback"
+	"github.com/easeaico/project-her/internal/card"
+	"github.com/easeaico/project-her/internal/lorebook"
 	"github.com/easeaico/project-her/internal/memory"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -14,8 +17,12 @@ import (
 type Store struct {
 	db            *gorm.DB
 	Characters    agent.CharacterRepo
+	Cards         card.Repo
+	Lorebook      lorebook.Repo
+	Profiles      callback.UserProfileRepo
 	Memories      memory.MemoryRepo
 	ChatHistories memory.ChatHistoryRepo
+	SummaryJobs   memory.SummaryJobRepo
 }
 
 // NewStore initializes the PostgreSQL pool and repositories.
@@ -37,8 +44,12 @@ func NewStore(ctx context.Context, databaseURL string) (*Store, error) {
 	store := &Store{
 		db:            db,
 		Characters:    NewCharacterRepo(db),
+		Cards:         NewCardRepo(db),
+		Lorebook:      NewLorebookRepo(db),
+		Profiles:      NewUserProfileRepo(db),
 		Memories:      NewMemoryRepo(db),
 		ChatHistories: NewChatHistoryRepo(db),
+		SummaryJobs:   NewSummaryJobRepo(db),
 	}
 	return store, nil
 }
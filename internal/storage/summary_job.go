@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/easeaico/project-her/internal/memory"
+	"github.com/easeaico/project-her/internal/types"
+)
+
+// summaryJobModel maps to the summary_jobs table.
+type summaryJobModel struct {
+	ID            int64
+	ChatHistoryID int
+	UserID        string
+	AppName       string
+	Kind          string
+	Status        string
+	Attempts      int
+	LastError     *string
+	RunAt         time.Time
+	LockedUntil   *time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+func (summaryJobModel) TableName() string {
+	return "summary_jobs"
+}
+
+// summaryJobRepo is the Postgres summarization queue. Claims use
+// FOR UPDATE SKIP LOCKED, so several replicas can share the table.
+type summaryJobRepo struct {
+	db *gorm.DB
+}
+
+// NewSummaryJobRepo returns a SummaryJobRepo.
+func NewSummaryJobRepo(db *gorm.DB) memory.SummaryJobRepo {
+	return &summaryJobRepo{db: db}
+}
+
+func (r *summaryJobRepo) Enqueue(ctx context.Context, job types.SummaryJob) error {
+	record := summaryJobModel{
+		ChatHistoryID: job.ChatHistoryID,
+		UserID:        job.UserID,
+		AppName:       job.AppName,
+		Kind:          job.Kind,
+		Status:        types.SummaryJobPending,
+		RunAt:         time.Now(),
+	}
+	if record.Kind == "" {
+		record.Kind = types.SummaryJobKindSummary
+	}
+	if !job.RunAt.IsZero() {
+		record.RunAt = job.RunAt
+	}
+	err := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "chat_history_id"}},
+		DoNothing: true,
+	}).Create(&record).Error
+	if err != nil {
+		return fmt.Errorf("failed to enqueue summary job: %w", err)
+	}
+	return nil
+}
+
+func (r *summaryJobRepo) Claim(ctx context.Context, lease time.Duration) (*types.SummaryJob, error) {
+	var records []summaryJobModel
+	err := r.db.WithContext(ctx).Raw(`
+		UPDATE summary_jobs
+		SET status = ?, attempts = attempts + 1,
+		    locked_until = now() + make_interval(secs => ?), updated_at = now()
+		WHERE id = (
+			SELECT id FROM summary_jobs
+			WHERE (status = ? AND run_at <= now())
+			   OR (status = ? AND locked_until < now())
+			ORDER BY run_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		types.SummaryJobRunning, lease.Seconds(), types.SummaryJobPending, types.SummaryJobRunning,
+	).Scan(&records).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim summary job: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	job := summaryJobFromModel(records[0])
+	return &job, nil
+}
+
+func (r *summaryJobRepo) Complete(ctx context.Context, id int64) error {
+	return r.update(ctx, id, map[string]any{
+		"status":       types.SummaryJobDone,
+		"locked_until": nil,
+		"last_error":   nil,
+	})
+}
+
+func (r *summaryJobRepo) Retry(ctx context.Context, id int64, lastError string, runAt time.Time) error {
+	return r.update(ctx, id, map[string]any{
+		"status":       types.SummaryJobPending,
+		"locked_until": nil,
+		"last_error":   lastError,
+		"run_at":       runAt,
+	})
+}
+
+func (r *summaryJobRepo) Bury(ctx context.Context, id int64, lastError string) error {
+	return r.update(ctx, id, map[string]any{
+		"status":       types.SummaryJobDead,
+		"locked_until": nil,
+		"last_error":   lastError,
+	})
+}
+
+func (r *summaryJobRepo) EnqueueOrphans(ctx context.Context, minTurns int) (int, error) {
+	result := r.db.WithContext(ctx).Exec(`
+		INSERT INTO summary_jobs (chat_history_id, user_id, app_name)
+		SELECT h.id, h.user_id, h.app_name
+		FROM chat_histories h
+		WHERE NOT h.summarized
+		  AND h.turn_count >= ?
+		  AND NOT EXISTS (SELECT 1 FROM summary_jobs j WHERE j.chat_history_id = h.id)
+		  AND (
+		      h.closed_at IS NOT NULL
+		      OR EXISTS (
+		          SELECT 1 FROM chat_histories n
+		          WHERE n.user_id = h.user_id AND n.app_name = h.app_name AND n.id > h.id
+		      )
+		  )
+		ON CONFLICT (chat_history_id) DO NOTHING`, minTurns)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to enqueue orphaned windows: %w", result.Error)
+	}
+	count := int(result.RowsAffected)
+
+	// Closed windows too short to summarize only need their facts extracted.
+	result = r.db.WithContext(ctx).Exec(`
+		INSERT INTO summary_jobs (chat_history_id, user_id, app_name, kind)
+		SELECT h.id, h.user_id, h.app_name, ?
+		FROM chat_histories h
+		WHERE NOT h.summarized
+		  AND h.turn_count < ?
+		  AND h.closed_at IS NOT NULL
+		  AND NOT EXISTS (SELECT 1 FROM summary_jobs j WHERE j.chat_history_id = h.id)
+		ON CONFLICT (chat_history_id) DO NOTHING`, types.SummaryJobKindFacts, minTurns)
+	if result.Error != nil {
+		return count, fmt.Errorf("failed to enqueue orphaned fact jobs: %w", result.Error)
+	}
+	return count + int(result.RowsAffected), nil
+}
+
+func (r *summaryJobRepo) update(ctx context.Context, id int64, values map[string]any) error {
+	values["updated_at"] = time.Now()
+	if err := r.db.WithContext(ctx).
+		Model(&summaryJobModel{}).
+		Where("id = ?", id).
+		Updates(values).Error; err != nil {
+		return fmt.Errorf("failed to update summary job: %w", err)
+	}
+	return nil
+}
+
+func summaryJobFromModel(model summaryJobModel) types.SummaryJob {
+	job := types.SummaryJob{
+		ID:            model.ID,
+		ChatHistoryID: model.ChatHistoryID,
+		UserID:        model.UserID,
+		AppName:       model.AppName,
+		Kind:          model.Kind,
+		Status:        model.Status,
+		Attempts:      model.Attempts,
+		RunAt:         model.RunAt,
+		CreatedAt:     model.CreatedAt,
+	}
+	if model.LastError != nil {
+		job.LastError = *model.LastError
+	}
+	return job
+}
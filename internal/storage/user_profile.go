@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/easeaico/project-her/internal/callback"
+	"github.com/easeaico/project-her/internal/types"
+)
+
+// userProfileModel maps to the user_profiles table.
+type userProfileModel struct {
+	UserID      string `gorm:"primaryKey"`
+	DisplayName string
+	Pronouns    string
+	Description string
+	Language    string
+	Timezone    string
+	Persona     string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (userProfileModel) TableName() string {
+	return "user_profiles"
+}
+
+// userProfileRepo accesses user profiles.
+type userProfileRepo struct {
+	db *gorm.DB
+}
+
+// NewUserProfileRepo returns a UserProfileRepo.
+func NewUserProfileRepo(db *gorm.DB) callback.UserProfileRepo {
+	return &userProfileRepo{db: db}
+}
+
+func (r *userProfileRepo) GetProfile(ctx context.Context, userID string) (*types.UserProfile, error) {
+	var model userProfileModel
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).First(&model).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user profile: %w", err)
+	}
+	return &types.UserProfile{
+		UserID:      model.UserID,
+		DisplayName: model.DisplayName,
+		Pronouns:    model.Pronouns,
+		Description: model.Description,
+		Language:    model.Language,
+		Timezone:    model.Timezone,
+		Persona:     model.Persona,
+		CreatedAt:   model.CreatedAt,
+		UpdatedAt:   model.UpdatedAt,
+	}, nil
+}
+
+func (r *userProfileRepo) SaveProfile(ctx context.Context, profile *types.UserProfile) error {
+	model := userProfileModel{
+		UserID:      profile.UserID,
+		DisplayName: profile.DisplayName,
+		Pronouns:    profile.Pronouns,
+		Description: profile.Description,
+		Language:    profile.Language,
+		Timezone:    profile.Timezone,
+		Persona:     profile.Persona,
+	}
+	err := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"display_name", "pronouns", "description", "language", "timezone", "persona", "updated_at"}),
+	}).Create(&model).Error
+	if err != nil {
+		return fmt.Errorf("failed to save user profile: %w", err)
+	}
+	return nil
+}
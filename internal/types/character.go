@@ -1,20 +1,64 @@
 package types
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // Character is the persisted profile.
 type Character struct {
-	ID             int       `json:"id"`
-	Name           string    `json:"name"`
-	Description    string    `json:"description"`
-	Personality    string    `json:"personality"`
-	Scenario       string    `json:"scenario"`
-	FirstMessage   string    `json:"first_mes"`
-	MessageExample string    `json:"mes_example"`
-	SystemPrompt   string    `json:"system_prompt"`
-	Avatar         string    `json:"avatar"`
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
+	ID             int    `json:"id"`
+	Name           string `json:"name"`
+	Description    string `json:"description"`
+	Personality    string `json:"personality"`
+	Scenario       string `json:"scenario"`
+	FirstMessage   string `json:"first_mes"`
+	MessageExample string `json:"mes_example"`
+	SystemPrompt   string `json:"system_prompt"`
+	Avatar         string `json:"avatar"`
+	// Character card fields (Character Card V2/V3).
+	PostHistoryInstructions string   `json:"post_history_instructions,omitempty"`
+	AlternateGreetings      []string `json:"alternate_greetings,omitempty"`
+	Tags                    []string `json:"tags,omitempty"`
+	Creator                 string   `json:"creator,omitempty"`
+	CreatorNotes            string   `json:"creator_notes,omitempty"`
+	CharacterVersion        string   `json:"character_version,omitempty"`
+	// CharacterBook is the card's embedded lorebook, kept verbatim.
+	CharacterBook json.RawMessage `json:"character_book,omitempty"`
+	// Extensions holds card extension data, kept verbatim for export.
+	Extensions json.RawMessage `json:"extensions,omitempty"`
+	// Generation holds the character's sampling settings.
+	Generation GenerationProfile `json:"generation"`
+	// PromptSections override the default prompt sections for this character.
+	PromptSections []PromptSection `json:"prompt_sections,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
+
+// GenerationProfile is a per-character set of sampling parameters.
+// Nil or empty fields fall back to the provider defaults.
+type GenerationProfile struct {
+	Temperature      *float32 `json:"temperature,omitempty"`
+	TopP             *float32 `json:"top_p,omitempty"`
+	PresencePenalty  *float32 `json:"presence_penalty,omitempty"`
+	FrequencyPenalty *float32 `json:"frequency_penalty,omitempty"`
+	StopSequences    []string `json:"stop_sequences,omitempty"`
+	Seed             *int32   `json:"seed,omitempty"`
+	// MaxOutputTokens caps the reply length; 0 means no limit.
+	MaxOutputTokens int32 `json:"max_output_tokens,omitempty"`
+}
+
+// PromptSection overrides one layered prompt section of a character.
+type PromptSection struct {
+	// Section is the section name: system, persona, world, memory, few_shot,
+	// history or anchor.
+	Section string `json:"section"`
+	// Template replaces the default template; empty keeps the default.
+	Template string `json:"template,omitempty"`
+	// Enabled false drops the section from the prompt.
+	Enabled bool `json:"enabled"`
+	// MaxTokens replaces the default token budget; 0 keeps the default.
+	MaxTokens int `json:"max_tokens,omitempty"`
 }
 
 const (
@@ -26,6 +70,9 @@ const (
 	MemoryTypeFacts = "facts"
 	// MemoryTypeEvents stores notable events.
 	MemoryTypeEvents = "events"
+	// MemoryTypeTurn is a single exchange, searchable until its chat window
+	// has been summarized.
+	MemoryTypeTurn = "turn"
 )
 
 // Memory is a stored memory record, designed for retrieval and summarization.
@@ -45,20 +92,38 @@ type Memory struct {
 	// TimeRange describes the period covered by the window.
 	TimeRange TimeRange `json:"time_range"`
 	// Salience is a 0-1 score indicating memory importance.
-	Salience  float64   `json:"salience_score"`
-	Embedding []float32 `json:"-"` // embedding vectors, not serialized
-	CreatedAt time.Time `json:"created_at"`
+	Salience float64 `json:"salience_score"`
+	// ChatHistoryID is the chat window a turn memory belongs to; turn memories
+	// are retired once that window has been summarized.
+	ChatHistoryID int `json:"chat_history_id,omitempty"`
+	// FactKey names what a fact memory is about (e.g. home_city); a user has
+	// at most one valid fact per key.
+	FactKey string `json:"fact_key,omitempty"`
+	// ValidFrom/ValidUntil bound the period a fact memory held; ValidUntil is
+	// nil while the fact is current.
+	ValidFrom  *time.Time `json:"valid_from,omitempty"`
+	ValidUntil *time.Time `json:"valid_until,omitempty"`
+	Embedding  []float32  `json:"-"` // embedding vectors, not serialized
+	CreatedAt  time.Time  `json:"created_at"`
 }
 
 // ChatHistory is a bundled chat window stored separately from memories.
 type ChatHistory struct {
-	ID         int       `json:"id"`
-	UserID     string    `json:"user_id"`
-	AppName    string    `json:"app_name"`
-	Content    string    `json:"content"`
-	TurnCount  int       `json:"turn_count"`
-	Summarized bool      `json:"summarized"`
-	CreatedAt  time.Time `json:"created_at"`
+	ID      int    `json:"id"`
+	UserID  string `json:"user_id"`
+	AppName string `json:"app_name"`
+	// SessionID is the session the window was opened in; another session
+	// closes it.
+	SessionID  string `json:"session_id,omitempty"`
+	Content    string `json:"content"`
+	TurnCount  int    `json:"turn_count"`
+	Summarized bool   `json:"summarized"`
+	// ClosedAt is set once the window takes no more turns (full, idle, session
+	// ended or end of day); a closed window is summarized unless too short.
+	ClosedAt  *time.Time `json:"closed_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	// UpdatedAt is the time of the latest turn.
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 // TimeRange describes the covered period of a memory window.
@@ -81,9 +146,34 @@ type MemorySummary struct {
 
 // RetrievedMemory is a retrieved memory snippet.
 type RetrievedMemory struct {
-	Content    string    `json:"content"`
-	Role       string    `json:"role"`
-	Type       string    `json:"type"`
-	Similarity float64   `json:"similarity"`
-	CreatedAt  time.Time `json:"created_at"`
+	Content    string  `json:"content"`
+	Role       string  `json:"role"`
+	Type       string  `json:"type"`
+	Similarity float64 `json:"similarity"`
+	// Score is the fused retrieval score; only the order is meaningful.
+	Score     float64   `json:"score"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MemoryQuery describes a hybrid memory search: a vector ranking and a
+// lexical (full-text and trigram) ranking fused with reciprocal rank fusion.
+type MemoryQuery struct {
+	UserID  string
+	AppName string
+	// Types limits the search to these memory types; empty means any type.
+	Types     []string
+	Text      string
+	Embedding []float32
+	TopK      int
+	// Candidates is how many hits each ranking contributes to the fusion.
+	Candidates int
+	// SimilarityThreshold is the minimum cosine similarity of vector hits;
+	// LexicalThreshold is the minimum trigram word similarity of lexical hits.
+	SimilarityThreshold float64
+	LexicalThreshold    float64
+	// Each ranking adds weight / (RRFK + rank); salience ranks the fused hits.
+	VectorWeight   float64
+	LexicalWeight  float64
+	SalienceWeight float64
+	RRFK           int
 }
@@ -0,0 +1,33 @@
+package types
+
+// LoreEntry is one world info entry. Entries with a nil CharacterID are global
+// and apply to every character.
+type LoreEntry struct {
+	ID          int    `json:"id"`
+	CharacterID *int   `json:"character_id,omitempty"`
+	Name        string `json:"name,omitempty"`
+	// Keys trigger the entry when any of them appears in the scanned text.
+	// A key written as /pattern/flags is a regular expression.
+	Keys []string `json:"keys"`
+	// SecondaryKeys, when set, additionally require one of them to match.
+	SecondaryKeys []string `json:"secondary_keys,omitempty"`
+	Content       string   `json:"content"`
+	// Constant entries are always inserted, without matching keys.
+	Constant      bool `json:"constant,omitempty"`
+	CaseSensitive bool `json:"case_sensitive,omitempty"`
+	// Order sorts inserted entries (ascending) and decides which entries are
+	// kept first when the token budget runs out (descending).
+	Order int `json:"insertion_order"`
+	// Depth nil inserts the entry into the lore prompt section; otherwise the
+	// entry is inserted into the history, Depth messages from the end.
+	Depth *int `json:"depth,omitempty"`
+	// Probability is the chance (1-100) that a triggered entry is inserted;
+	// 0 and 100 both mean always.
+	Probability int `json:"probability,omitempty"`
+	// ScanDepth overrides how many recent messages are scanned; 0 uses the default.
+	ScanDepth int `json:"scan_depth,omitempty"`
+	// PreventRecursion stops this entry's content from triggering other entries.
+	PreventRecursion bool `json:"prevent_recursion,omitempty"`
+	// ExcludeRecursion stops this entry from being triggered by other entries.
+	ExcludeRecursion bool `json:"exclude_recursion,omitempty"`
+}
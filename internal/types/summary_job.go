@@ -0,0 +1,37 @@
+package types
+
+import "time"
+
+// Summary job states.
+const (
+	// SummaryJobPending jobs wait for RunAt to be claimed by a worker.
+	SummaryJobPending = "pending"
+	// SummaryJobRunning jobs are leased by a worker until LockedUntil.
+	SummaryJobRunning = "running"
+	// SummaryJobDone jobs have written their summary.
+	SummaryJobDone = "done"
+	// SummaryJobDead jobs failed every attempt and are kept for inspection.
+	SummaryJobDead = "dead"
+)
+
+// Summary job kinds.
+const (
+	// SummaryJobKindSummary jobs summarize the window and extract its facts.
+	SummaryJobKindSummary = "summary"
+	// SummaryJobKindFacts jobs only extract facts from windows too short to summarize.
+	SummaryJobKindFacts = "facts"
+)
+
+// SummaryJob is a queued request to summarize one chat window.
+type SummaryJob struct {
+	ID            int64     `json:"id"`
+	ChatHistoryID int       `json:"chat_history_id"`
+	UserID        string    `json:"user_id"`
+	AppName       string    `json:"app_name"`
+	Kind          string    `json:"kind"`
+	Status        string    `json:"status"`
+	Attempts      int       `json:"attempts"`
+	LastError     string    `json:"last_error,omitempty"`
+	RunAt         time.Time `json:"run_at"`
+	CreatedAt     time.Time `json:"created_at"`
+}
@@ -0,0 +1,20 @@
+package types
+
+import "time"
+
+// UserProfile is how a user wants to be addressed and described to every
+// character. Empty fields are left out of the prompt.
+type UserProfile struct {
+	UserID      string `json:"user_id"`
+	DisplayName string `json:"display_name,omitempty"`
+	Pronouns    string `json:"pronouns,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Language is the preferred reply language, e.g. zh-CN.
+	Language string `json:"language,omitempty"`
+	// Timezone is an IANA time zone name, e.g. Asia/Shanghai.
+	Timezone string `json:"timezone,omitempty"`
+	// Persona is free-form text about the user, injected as written.
+	Persona   string    `json:"persona,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -1,27 +1,113 @@
 package utils
 
 import (
+	"net/http"
+	"path"
+	"regexp"
 	"strings"
+	"unicode/utf8"
 
 	"google.golang.org/genai"
 )
 
+// maxImageCaptionRunes 限制图片说明的长度，避免文件名过长污染记忆窗口。
+const maxImageCaptionRunes = 40
+
+// ExtractContentText 拼接内容中的文本，并为图片附件追加简短说明。
+// 模型的思考内容（Thought part）仅用于调试，不计入文本。
 func ExtractContentText(content *genai.Content) string {
 	if content == nil {
 		return ""
 	}
 	var sb strings.Builder
+	var notes []string
 	for _, part := range content.Parts {
-		if part != nil && part.Text != "" {
+		if part == nil || part.Thought {
+			continue
+		}
+		if part.Text != "" {
 			sb.WriteString(part.Text)
+			continue
+		}
+		if IsImagePart(part) {
+			notes = append(notes, ImageNote(part))
 		}
 	}
+	// 图片说明追加在文本之后，保证 /image 等命令前缀不受影响。
+	for _, note := range notes {
+		if sb.Len() > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(note)
+	}
 	return sb.String()
 }
 
+// IsImagePart 判断 part 是否为图片附件（内联数据或文件引用）。
+func IsImagePart(part *genai.Part) bool {
+	if part == nil {
+		return false
+	}
+	if part.InlineData != nil {
+		mimeType := part.InlineData.MIMEType
+		if mimeType == "" && len(part.InlineData.Data) > 0 {
+			mimeType = http.DetectContentType(part.InlineData.Data)
+		}
+		return strings.HasPrefix(strings.ToLower(mimeType), "image/")
+	}
+	if part.FileData != nil {
+		return strings.HasPrefix(strings.ToLower(part.FileData.MIMEType), "image/")
+	}
+	return false
+}
+
+// ImageNote 返回用于文本通道的图片占位说明，例如 "[Image shared: cat.jpg]"。
+func ImageNote(part *genai.Part) string {
+	return "[Image shared: " + ImageCaption(part) + "]"
+}
+
+// ImageCaption 返回图片的简短说明，优先使用展示名，其次为文件名与 MIME 类型。
+func ImageCaption(part *genai.Part) string {
+	var caption, uri, mimeType string
+	switch {
+	case part == nil:
+	case part.InlineData != nil:
+		caption = part.InlineData.DisplayName
+		mimeType = part.InlineData.MIMEType
+	case part.FileData != nil:
+		caption = part.FileData.DisplayName
+		uri = part.FileData.FileURI
+		mimeType = part.FileData.MIMEType
+	}
+
+	caption = strings.TrimSpace(caption)
+	if caption == "" && uri != "" && !strings.HasPrefix(uri, "data:") {
+		if base := path.Base(strings.SplitN(uri, "?", 2)[0]); base != "." && base != "/" {
+			caption = base
+		}
+	}
+	if caption == "" {
+		caption = strings.TrimSpace(mimeType)
+	}
+	if caption == "" {
+		caption = "image"
+	}
+	if utf8.RuneCountInString(caption) > maxImageCaptionRunes {
+		caption = string([]rune(caption)[:maxImageCaptionRunes]) + "…"
+	}
+	return caption
+}
+
+// 角色卡中常见的宏写法：{{char}}/{{user}} 大小写不一，旧版卡片使用 <BOT>/<USER>。
+var (
+	charMacro = regexp.MustCompile(`(?i)\{\{char\}\}|<bot>`)
+	userMacro = regexp.MustCompile(`(?i)\{\{user\}\}|<user>`)
+)
+
+// NormalizePromptText 将角色文本中的宏替换为角色名与用户名，并还原转义的换行与引号。
 func NormalizePromptText(text string, charName, userName string) string {
-	text = strings.ReplaceAll(text, "{{char}}", charName)
-	text = strings.ReplaceAll(text, "{{user}}", userName)
+	text = charMacro.ReplaceAllLiteralString(text, charName)
+	text = userMacro.ReplaceAllLiteralString(text, userName)
 	text = strings.ReplaceAll(text, "\\r\\n", "\n")
 	text = strings.ReplaceAll(text, "\\n", "\n")
 	text = strings.ReplaceAll(text, "\\\"", "\"")
@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"encoding/json"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"google.golang.org/genai"
+)
+
+const (
+	// contentOverheadTokens 为每条消息的角色与分隔符开销。
+	contentOverheadTokens = 4
+	// imageTokens 为单张图片的估算 token 数，各家视觉模型大致在几百到一千多之间。
+	imageTokens = 1000
+)
+
+// EstimateTokens 粗略估算文本的 token 数，不依赖具体分词器：
+// 中日韩字符按每字 1 个 token，其余字符按每 4 字节 1 个 token。
+// 结果只用于预算控制，宁可略微高估。
+func EstimateTokens(text string) int {
+	cjk, other := 0, 0
+	for _, r := range text {
+		if isCJK(r) {
+			cjk++
+		} else {
+			other += utf8.RuneLen(r)
+		}
+	}
+	return cjk + (other+3)/4
+}
+
+// EstimateContentTokens 估算一条消息的 token 数，包括文本、图片与工具调用参数。
+func EstimateContentTokens(content *genai.Content) int {
+	if content == nil {
+		return 0
+	}
+	total := contentOverheadTokens
+	for _, part := range content.Parts {
+		switch {
+		case part == nil:
+		case part.Text != "":
+			total += EstimateTokens(part.Text)
+		case IsImagePart(part):
+			total += imageTokens
+		case part.FunctionCall != nil:
+			raw, _ := json.Marshal(part.FunctionCall.Args)
+			total += EstimateTokens(part.FunctionCall.Name) + EstimateTokens(string(raw))
+		case part.FunctionResponse != nil:
+			raw, _ := json.Marshal(part.FunctionResponse.Response)
+			total += EstimateTokens(part.FunctionResponse.Name) + EstimateTokens(string(raw))
+		}
+	}
+	return total
+}
+
+// TruncateToTokens 将文本截断到估算 token 数不超过 maxTokens，优先在换行处截断；
+// maxTokens 不大于 0 时原样返回。
+func TruncateToTokens(text string, maxTokens int) string {
+	if maxTokens <= 0 || EstimateTokens(text) <= maxTokens {
+		return text
+	}
+	cjk, other, end := 0, 0, 0
+	for i, r := range text {
+		if isCJK(r) {
+			cjk++
+		} else {
+			other += utf8.RuneLen(r)
+		}
+		if cjk+(other+3)/4 > maxTokens {
+			break
+		}
+		end = i + utf8.RuneLen(r)
+	}
+	truncated := text[:end]
+	if idx := strings.LastIndex(truncated, "\n"); idx > len(truncated)/2 {
+		truncated = truncated[:idx]
+	}
+	return strings.TrimSpace(truncated)
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
@@ -0,0 +1,10 @@
+-- per-character generation profile; NULL falls back to provider defaults
+ALTER TABLE characters
+    ADD COLUMN IF NOT EXISTS temperature REAL,
+    ADD COLUMN IF NOT EXISTS top_p REAL,
+    ADD COLUMN IF NOT EXISTS presence_penalty REAL,
+    ADD COLUMN IF NOT EXISTS frequency_penalty REAL,
+    -- stop_sequences: JSON array of strings
+    ADD COLUMN IF NOT EXISTS stop_sequences JSONB,
+    ADD COLUMN IF NOT EXISTS seed INT,
+    ADD COLUMN IF NOT EXISTS max_output_tokens INT;
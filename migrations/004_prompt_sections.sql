@@ -0,0 +1,13 @@
+-- per-character overrides of the layered prompt sections
+-- section: system/persona/world/memory/few_shot/history/anchor
+CREATE TABLE IF NOT EXISTS character_prompt_sections (
+    character_id INT NOT NULL REFERENCES characters(id) ON DELETE CASCADE,
+    section VARCHAR(32) NOT NULL,
+    -- template: text/template source; NULL or empty keeps the default
+    template TEXT,
+    -- enabled: FALSE drops the section from the prompt
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    -- max_tokens: section token budget; NULL keeps the default
+    max_tokens INT,
+    PRIMARY KEY (character_id, section)
+);
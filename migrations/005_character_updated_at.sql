@@ -0,0 +1,27 @@
+-- keep characters.updated_at current so running services can hot-reload
+-- character definitions by polling it
+CREATE OR REPLACE FUNCTION touch_character_updated_at() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at = CURRENT_TIMESTAMP;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS characters_touch_updated_at ON characters;
+CREATE TRIGGER characters_touch_updated_at
+    BEFORE UPDATE ON characters
+    FOR EACH ROW EXECUTE FUNCTION touch_character_updated_at();
+
+-- prompt section overrides are part of the character definition
+CREATE OR REPLACE FUNCTION touch_character_from_prompt_section() RETURNS TRIGGER AS $$
+BEGIN
+    UPDATE characters SET updated_at = CURRENT_TIMESTAMP
+    WHERE id = COALESCE(NEW.character_id, OLD.character_id);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS character_prompt_sections_touch_character ON character_prompt_sections;
+CREATE TRIGGER character_prompt_sections_touch_character
+    AFTER INSERT OR UPDATE OR DELETE ON character_prompt_sections
+    FOR EACH ROW EXECUTE FUNCTION touch_character_from_prompt_section();
@@ -0,0 +1,18 @@
+-- Character Card V2/V3 fields, kept so imported cards can be exported again
+ALTER TABLE characters
+    ADD COLUMN IF NOT EXISTS post_history_instructions TEXT,
+    -- alternate_greetings/tags: JSON arrays of strings
+    ADD COLUMN IF NOT EXISTS alternate_greetings JSONB,
+    ADD COLUMN IF NOT EXISTS tags JSONB,
+    ADD COLUMN IF NOT EXISTS creator VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS creator_notes TEXT,
+    ADD COLUMN IF NOT EXISTS character_version VARCHAR(64),
+    -- character_book/extensions: card objects stored verbatim
+    ADD COLUMN IF NOT EXISTS character_book JSONB,
+    ADD COLUMN IF NOT EXISTS extensions JSONB,
+    -- avatar_image: the card's avatar (PNG without card chunks)
+    ADD COLUMN IF NOT EXISTS avatar_image BYTEA;
+
+-- 002_data.sql inserts explicit ids; move the sequence past them so imported
+-- cards get fresh ids
+SELECT setval(pg_get_serial_sequence('characters', 'id'), COALESCE((SELECT MAX(id) FROM characters), 0) + 1, false);
@@ -0,0 +1,28 @@
+-- lorebook_entries: world info entries; character_id NULL applies to every character
+CREATE TABLE IF NOT EXISTS lorebook_entries (
+    id SERIAL PRIMARY KEY,
+    character_id INT REFERENCES characters(id) ON DELETE CASCADE,
+    name VARCHAR(255),
+    -- keys/secondary_keys: JSON arrays; a key written as /pattern/flags is a regex
+    keys JSONB NOT NULL DEFAULT '[]',
+    secondary_keys JSONB,
+    content TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    -- constant: always inserted, without matching keys
+    constant BOOLEAN NOT NULL DEFAULT FALSE,
+    case_sensitive BOOLEAN NOT NULL DEFAULT FALSE,
+    -- insertion_order: ascending in the prompt; higher values win the token budget
+    insertion_order INT NOT NULL DEFAULT 100,
+    -- depth: NULL inserts into the lore prompt section, N inserts N messages from the end of history
+    depth INT CHECK (depth >= 0),
+    -- probability: chance (1-100) that a triggered entry is inserted
+    probability INT NOT NULL DEFAULT 100 CHECK (probability BETWEEN 1 AND 100),
+    -- scan_depth: recent messages to scan; NULL uses LOREBOOK_SCAN_DEPTH
+    scan_depth INT,
+    prevent_recursion BOOLEAN NOT NULL DEFAULT FALSE,
+    exclude_recursion BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_lorebook_entries_character ON lorebook_entries (character_id) WHERE enabled;
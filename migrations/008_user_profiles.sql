@@ -0,0 +1,15 @@
+-- user_profiles: how each user wants to be addressed, shared by all characters
+CREATE TABLE IF NOT EXISTS user_profiles (
+    user_id VARCHAR(255) PRIMARY KEY,
+    display_name VARCHAR(64) NOT NULL DEFAULT '',
+    pronouns VARCHAR(32) NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT '',
+    -- language: preferred reply language, e.g. zh-CN
+    language VARCHAR(32) NOT NULL DEFAULT '',
+    -- timezone: IANA name, e.g. Asia/Shanghai
+    timezone VARCHAR(64) NOT NULL DEFAULT '',
+    -- persona: free-form text about the user
+    persona TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,6 @@
+-- turn memories: each exchange is embedded right away and retired once its
+-- chat window has been summarized
+ALTER TABLE memories
+    ADD COLUMN IF NOT EXISTS chat_history_id INT REFERENCES chat_histories(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_memories_chat_history ON memories (chat_history_id);
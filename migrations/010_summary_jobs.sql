@@ -0,0 +1,46 @@
+-- summary_jobs: durable queue of chat windows waiting to be summarized
+CREATE TABLE IF NOT EXISTS summary_jobs (
+    id BIGSERIAL PRIMARY KEY,
+    -- one job per window, so enqueueing and the backfill sweep are idempotent
+    chat_history_id INT NOT NULL UNIQUE REFERENCES chat_histories(id) ON DELETE CASCADE,
+    user_id VARCHAR(64),
+    app_name VARCHAR(255),
+    -- status: pending/running/done/dead
+    status VARCHAR(16) NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    -- run_at: earliest time the job may be claimed (retry backoff)
+    run_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    -- locked_until: lease of a running job; expired leases are claimed again
+    locked_until TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_summary_jobs_claim ON summary_jobs (status, run_at);
+
+-- Windows rotated before summaries were tracked were never marked summarized.
+-- Treat a rotated window as summarized when a chat memory was written while it
+-- was the latest window, i.e. before the next window opened, so the backfill
+-- sweep does not summarize it a second time. Windows whose summary failed have
+-- no such memory and are left to the sweep.
+UPDATE chat_histories h
+SET summarized = TRUE
+FROM (
+    SELECT w.id, (
+        SELECT n.created_at FROM chat_histories n
+        WHERE n.user_id = w.user_id AND n.app_name = w.app_name AND n.id > w.id
+        ORDER BY n.id
+        LIMIT 1
+    ) AS next_created_at
+    FROM chat_histories w
+    WHERE NOT w.summarized
+) next
+WHERE h.id = next.id
+  AND next.next_created_at IS NOT NULL
+  AND EXISTS (
+      SELECT 1 FROM memories m
+      WHERE m.type = 'chat' AND m.user_id = h.user_id AND m.app_name = h.app_name
+        AND m.created_at >= h.created_at
+        AND m.created_at < next.next_created_at
+  );
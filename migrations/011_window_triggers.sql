@@ -0,0 +1,14 @@
+-- chat window triggers: windows are closed (and summarized) when idle, at
+-- session end or at the end of the day, not only when full
+ALTER TABLE chat_histories
+    ADD COLUMN IF NOT EXISTS session_id VARCHAR(255),
+    -- updated_at: time of the latest turn, for the idle trigger
+    ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP,
+    -- closed_at: set once the window takes no more turns
+    ADD COLUMN IF NOT EXISTS closed_at TIMESTAMP;
+
+UPDATE chat_histories SET updated_at = created_at WHERE updated_at IS NULL;
+ALTER TABLE chat_histories ALTER COLUMN updated_at SET DEFAULT CURRENT_TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_chat_histories_open ON chat_histories (updated_at)
+    WHERE NOT summarized AND closed_at IS NULL;
@@ -0,0 +1,12 @@
+-- fact memories: each durable user fact is its own memory (type = 'facts').
+-- A changed fact closes the validity period of the previous one instead of
+-- overwriting it.
+ALTER TABLE memories
+    -- fact_key: what the fact is about, e.g. home_city; one active fact per key
+    ADD COLUMN IF NOT EXISTS fact_key VARCHAR(128),
+    ADD COLUMN IF NOT EXISTS valid_from TIMESTAMP,
+    -- valid_until: set when a newer fact with the same key supersedes this one
+    ADD COLUMN IF NOT EXISTS valid_until TIMESTAMP;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_memories_active_fact ON memories (user_id, app_name, fact_key)
+    WHERE type = 'facts' AND valid_until IS NULL;
@@ -0,0 +1,28 @@
+-- hybrid memory search: full-text and trigram indexes next to the vector index.
+-- search_text/search_tsv cover the summary and the extracted facts. The
+-- 'simple' configuration does not stem, so names match as written; trigrams
+-- also match Chinese text, which has no spaces between words.
+-- pg_trgm only keeps characters that the database LC_CTYPE classifies as
+-- alphanumeric. Under the C or POSIX locale CJK characters are dropped, so
+-- Chinese text only matches through the vector search; create the database
+-- with a UTF-8 locale such as en_US.UTF-8 or zh_CN.UTF-8.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+DO $$
+DECLARE
+    ctype TEXT;
+BEGIN
+    SELECT datctype INTO ctype FROM pg_database WHERE datname = current_database();
+    IF ctype NOT ILIKE '%utf%8%' THEN
+        RAISE WARNING 'database LC_CTYPE is %, pg_trgm will ignore CJK characters; use a UTF-8 locale', ctype;
+    END IF;
+END $$;
+
+ALTER TABLE memories
+    ADD COLUMN IF NOT EXISTS search_text TEXT
+        GENERATED ALWAYS AS (COALESCE(summary, '') || ' ' || COALESCE(facts::text, '')) STORED,
+    ADD COLUMN IF NOT EXISTS search_tsv TSVECTOR
+        GENERATED ALWAYS AS (to_tsvector('simple', COALESCE(summary, '') || ' ' || COALESCE(facts::text, ''))) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_memories_search_tsv ON memories USING gin (search_tsv);
+CREATE INDEX IF NOT EXISTS idx_memories_search_trgm ON memories USING gin (search_text gin_trgm_ops);
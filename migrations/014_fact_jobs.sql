@@ -0,0 +1,5 @@
+-- fact jobs: windows closed below SUMMARY_MIN_TURNS are not summarized, but
+-- their user facts are still extracted through the summary_jobs queue.
+ALTER TABLE summary_jobs
+    -- kind: summary (summarize and extract facts) or facts (extract facts only)
+    ADD COLUMN IF NOT EXISTS kind VARCHAR(16) NOT NULL DEFAULT 'summary';